@@ -0,0 +1,249 @@
+// Package admin is an HTTP API for inspecting a running proxydhcp.
+//
+// All endpoints return JSON:
+//
+//	GET  /requests          recent requests, most recent first. Filter by mac address with ?mac=
+//	GET  /sessions          boot sessions, most recently updated first
+//	GET  /sessions/<mac>    the boot session of a mac address
+//	GET  /config            the effective configuration and architecture to iPXE binary mapping
+//	GET  /backend           the authorization backend's health
+//	POST /backend/reload    reload the authorization backend
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/authz"
+	"github.com/jacobweinstock/proxydhcp/authz/cache"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// Server serves the admin API.
+type Server struct {
+	// Recorder holds the recent requests.
+	Recorder *Recorder
+	// Sessions holds the boot sessions.
+	Sessions *proxy.SessionTracker
+	// Backend is the authorization backend.
+	Backend proxy.Allower
+	// Config is the effective configuration, it is served as JSON so it must not hold secrets.
+	Config interface{}
+	// Bootfiles is the effective architecture to iPXE binary mapping.
+	Bootfiles proxy.BootfileMap
+	Log       logr.Logger
+}
+
+// Handler returns the http.Handler for the admin API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/requests", get(s.requests))
+	mux.HandleFunc("/sessions", get(s.sessions))
+	mux.HandleFunc("/sessions/", get(s.session))
+	mux.HandleFunc("/config", get(s.config))
+	mux.HandleFunc("/backend", get(s.backend))
+	mux.HandleFunc("/backend/reload", s.reload)
+	return mux
+}
+
+// Request is a recent request as served by the API.
+type Request struct {
+	Time            time.Time `json:"time"`
+	Listener        string    `json:"listener"`
+	Peer            string    `json:"peer,omitempty"`
+	MAC             string    `json:"mac,omitempty"`
+	TransactionID   string    `json:"xid,omitempty"`
+	MessageType     string    `json:"messageType,omitempty"`
+	Arch            string    `json:"arch,omitempty"`
+	ClientType      string    `json:"clientType,omitempty"`
+	UserClass       string    `json:"userClass,omitempty"`
+	Outcome         string    `json:"outcome"`
+	IgnoreReason    string    `json:"ignoreReason,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Decision        *Decision `json:"decision,omitempty"`
+	Bootfile        string    `json:"bootfile,omitempty"`
+	Script          bool      `json:"script,omitempty"`
+	BackendDuration string    `json:"backendDuration,omitempty"`
+	Duration        string    `json:"duration"`
+	Request         string    `json:"request,omitempty"`
+	Reply           string    `json:"reply,omitempty"`
+}
+
+// Decision is the boot decision of a Request.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+	Source string `json:"source"`
+	Rule   string `json:"rule,omitempty"`
+}
+
+// NewRequest converts an Event into a Request.
+func NewRequest(e proxy.Event) Request {
+	r := Request{
+		Time:          e.Time,
+		Listener:      e.Listener,
+		TransactionID: e.TransactionID,
+		MessageType:   e.MessageType,
+		Arch:          e.Arch,
+		ClientType:    e.ClientType,
+		UserClass:     e.UserClass,
+		Outcome:       string(e.Outcome),
+		IgnoreReason:  e.IgnoreReason,
+		Bootfile:      e.Bootfile,
+		Script:        e.Script,
+		Duration:      e.Duration.String(),
+	}
+	if e.Peer != nil {
+		r.Peer = e.Peer.String()
+	}
+	if len(e.MAC) > 0 {
+		r.MAC = e.MAC.String()
+	}
+	if e.Err != nil {
+		r.Error = e.Err.Error()
+	}
+	if e.Decision.Source != "" {
+		r.Decision = &Decision{Allow: e.Decision.Allow, Reason: e.Decision.Reason, Source: e.Decision.Source, Rule: e.Decision.Rule}
+		r.BackendDuration = e.BackendDuration.String()
+	}
+	if e.Request != nil {
+		r.Request = e.Request.Summary()
+	}
+	if e.Reply != nil {
+		r.Reply = e.Reply.Summary()
+	}
+	return r
+}
+
+// Bootfile is an entry of the architecture to iPXE binary mapping.
+type Bootfile struct {
+	Arch int    `json:"arch"`
+	Name string `json:"name"`
+	proxy.Bootfile
+}
+
+// Backend is the health of the authorization backend.
+type Backend struct {
+	Type      string        `json:"type"`
+	Healthy   bool          `json:"healthy"`
+	Error     string        `json:"error,omitempty"`
+	LastError *BackendError `json:"lastError,omitempty"`
+	Reloads   bool          `json:"reloads"`
+	Cache     *cache.Stats  `json:"cache,omitempty"`
+}
+
+func (s *Server) requests(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("mac")
+	if filter != "" {
+		mac, err := net.ParseMAC(filter)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter = mac.String()
+	}
+	out := []Request{}
+	for _, e := range s.Recorder.Events() {
+		if filter != "" && e.MAC.String() != filter {
+			continue
+		}
+		out = append(out, NewRequest(e))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) sessions(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.Sessions.Sessions())
+}
+
+func (s *Server) session(w http.ResponseWriter, r *http.Request) {
+	mac, err := net.ParseMAC(strings.TrimPrefix(r.URL.Path, "/sessions/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	sess, ok := s.Sessions.Session(mac.String())
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no boot session for %v", mac))
+		return
+	}
+	writeJSON(w, http.StatusOK, sess)
+}
+
+func (s *Server) config(w http.ResponseWriter, _ *http.Request) {
+	bfs := make([]Bootfile, 0, len(s.Bootfiles))
+	for arch, bf := range s.Bootfiles {
+		bfs = append(bfs, Bootfile{Arch: int(arch), Name: arch.String(), Bootfile: bf})
+	}
+	sort.Slice(bfs, func(i, j int) bool { return bfs[i].Arch < bfs[j].Arch })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"config": s.Config, "bootfiles": bfs})
+}
+
+func (s *Server) backend(w http.ResponseWriter, r *http.Request) {
+	b := Backend{Type: fmt.Sprintf("%T", s.Backend), Healthy: true}
+	if c, ok := s.Backend.(*cache.Cache); ok {
+		stats := c.Stats()
+		b.Cache = &stats
+		b.Type = fmt.Sprintf("%T", c.Backend)
+	}
+	if h, ok := s.Backend.(authz.HealthChecker); ok {
+		if err := h.Healthy(r.Context()); err != nil {
+			b.Healthy, b.Error = false, err.Error()
+		}
+	}
+	if last, ok := s.Recorder.LastBackendError(); ok {
+		b.LastError = &last
+	}
+	_, b.Reloads = s.Backend.(authz.Reloader)
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	rl, ok := s.Backend.(authz.Reloader)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("the authorization backend does not support reloading"))
+		return
+	}
+	if err := rl.Reload(); err != nil {
+		s.Log.Error(err, "admin API reload of the authorization backend failed, keeping the current data")
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.Log.Info("admin API reloaded the authorization backend")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
+
+// get only allows GET and HEAD requests to h.
+func get(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
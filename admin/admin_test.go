@@ -0,0 +1,177 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+func mac(b byte) net.HardwareAddr {
+	return net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, b}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(3)
+	for i := 0; i < 5; i++ {
+		r.Observe(proxy.Event{MAC: mac(byte(i))})
+	}
+	got := r.Events()
+	if len(got) != 3 {
+		t.Fatalf("got %v events, want 3", len(got))
+	}
+	for i, want := range []byte{4, 3, 2} {
+		if got[i].MAC.String() != mac(want).String() {
+			t.Fatalf("event %v: got %v, want %v", i, got[i].MAC, mac(want))
+		}
+	}
+	if _, ok := r.LastBackendError(); ok {
+		t.Fatal("expected no backend error")
+	}
+	r.Observe(proxy.Event{Time: time.Now(), MAC: mac(9), Outcome: proxy.OutcomeIgnored, IgnoreReason: proxy.IgnoreBackendError})
+	if last, ok := r.LastBackendError(); !ok || last.MAC != mac(9).String() || last.Reason != proxy.ReasonBackendError {
+		t.Fatalf("got last backend error %+v", last)
+	}
+	r.Observe(proxy.Event{Time: time.Now(), MAC: mac(10), Outcome: proxy.OutcomeDenied, Decision: proxy.Decision{Reason: proxy.ReasonBackendError}, Err: errors.New("timeout")})
+	if last, ok := r.LastBackendError(); !ok || last.MAC != mac(10).String() || last.Reason != proxy.ReasonBackendError+": timeout" {
+		t.Fatalf("got last backend error %+v", last)
+	}
+}
+
+// reloader is an Allower that can be reloaded and reports its health.
+type reloader struct {
+	err    error
+	reload int
+}
+
+func (r *reloader) Allow(context.Context, net.HardwareAddr) bool { return true }
+
+func (r *reloader) Reload() error {
+	r.reload++
+	return r.err
+}
+
+func (r *reloader) Healthy(context.Context) error { return r.err }
+
+func newServer(backend proxy.Allower) (*Server, *httptest.Server) {
+	s := &Server{
+		Recorder:  NewRecorder(10),
+		Sessions:  proxy.NewSessionTracker(),
+		Backend:   backend,
+		Config:    map[string]string{"tftpAddr": "192.168.2.5:69"},
+		Bootfiles: proxy.BootfileMap{7: {Default: "ipxe.efi"}},
+		Log:       logr.Discard(),
+	}
+	return s, httptest.NewServer(s.Handler())
+}
+
+func do(t *testing.T, method, url string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method, url, http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestRequests(t *testing.T) {
+	s, ts := newServer(proxy.AllowAll{})
+	defer ts.Close()
+	for _, e := range []proxy.Event{
+		{MAC: mac(1), Arch: "EFI x86-64", Outcome: proxy.OutcomeOffer, Decision: proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: "file"}},
+		{MAC: mac(2), Outcome: proxy.OutcomeIgnored, IgnoreReason: "option60_missing", Err: proxy.ErrOpt60Missing},
+	} {
+		s.Recorder.Observe(e)
+		s.Sessions.Observe(e)
+	}
+
+	var all []Request
+	if code := do(t, http.MethodGet, ts.URL+"/requests", &all); code != http.StatusOK || len(all) != 2 {
+		t.Fatalf("got %v %+v", code, all)
+	}
+	var one []Request
+	do(t, http.MethodGet, ts.URL+"/requests?mac="+mac(1).String(), &one)
+	if len(one) != 1 || one[0].Decision == nil || !one[0].Decision.Allow || one[0].Decision.Source != "file" {
+		t.Fatalf("got %+v", one)
+	}
+	if code := do(t, http.MethodGet, ts.URL+"/requests?mac=nope", nil); code != http.StatusBadRequest {
+		t.Fatalf("got status %v, want %v", code, http.StatusBadRequest)
+	}
+
+	var sess proxy.Session
+	if code := do(t, http.MethodGet, ts.URL+"/sessions/"+mac(1).String(), &sess); code != http.StatusOK || len(sess.Stages) != 1 {
+		t.Fatalf("got %v %+v", code, sess)
+	}
+	// clients that are not PXE clients have no session.
+	for _, m := range []net.HardwareAddr{mac(2), mac(3)} {
+		if code := do(t, http.MethodGet, ts.URL+"/sessions/"+m.String(), nil); code != http.StatusNotFound {
+			t.Fatalf("%v: got status %v, want %v", m, code, http.StatusNotFound)
+		}
+	}
+	if code := do(t, http.MethodPost, ts.URL+"/sessions", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %v, want %v", code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	_, ts := newServer(proxy.AllowAll{})
+	defer ts.Close()
+	var got struct {
+		Config    map[string]string `json:"config"`
+		Bootfiles []Bootfile        `json:"bootfiles"`
+	}
+	do(t, http.MethodGet, ts.URL+"/config", &got)
+	if got.Config["tftpAddr"] != "192.168.2.5:69" || len(got.Bootfiles) != 1 || got.Bootfiles[0].Arch != 7 || got.Bootfiles[0].Default != "ipxe.efi" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestBackend(t *testing.T) {
+	r := &reloader{}
+	_, ts := newServer(r)
+	defer ts.Close()
+
+	var b Backend
+	do(t, http.MethodGet, ts.URL+"/backend", &b)
+	if !b.Healthy || !b.Reloads {
+		t.Fatalf("got %+v", b)
+	}
+	if code := do(t, http.MethodPost, ts.URL+"/backend/reload", nil); code != http.StatusOK || r.reload != 1 {
+		t.Fatalf("got status %v, reloads %v", code, r.reload)
+	}
+
+	r.err = errors.New("bad file")
+	do(t, http.MethodGet, ts.URL+"/backend", &b)
+	if b.Healthy || b.Error != "bad file" {
+		t.Fatalf("got %+v", b)
+	}
+	if code := do(t, http.MethodPost, ts.URL+"/backend/reload", nil); code != http.StatusInternalServerError {
+		t.Fatalf("got status %v, want %v", code, http.StatusInternalServerError)
+	}
+	if code := do(t, http.MethodGet, ts.URL+"/backend/reload", nil); code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %v, want %v", code, http.StatusMethodNotAllowed)
+	}
+
+	_, ts2 := newServer(proxy.AllowAll{})
+	defer ts2.Close()
+	if code := do(t, http.MethodPost, ts2.URL+"/backend/reload", nil); code != http.StatusNotImplemented {
+		t.Fatalf("got status %v, want %v", code, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// DefaultHistory is the default number of requests a Recorder keeps.
+const DefaultHistory = 500
+
+// Recorder is a proxy.Observer that keeps the most recent requests in a ring buffer.
+type Recorder struct {
+	mu      sync.Mutex
+	events  []proxy.Event
+	next    int
+	full    bool
+	lastErr BackendError
+}
+
+// BackendError is the last time the authorization backend failed to make a decision.
+type BackendError struct {
+	Time   time.Time `json:"time"`
+	MAC    string    `json:"mac"`
+	Reason string    `json:"reason"`
+}
+
+// NewRecorder returns a Recorder that keeps the last size requests.
+func NewRecorder(size int) *Recorder {
+	if size <= 0 {
+		size = DefaultHistory
+	}
+	return &Recorder{events: make([]proxy.Event, size)}
+}
+
+// Observe records a request.
+func (r *Recorder) Observe(e proxy.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+	if e.IgnoreReason == proxy.IgnoreBackendError || e.Decision.Reason == proxy.ReasonBackendError {
+		reason := proxy.ReasonBackendError
+		if e.Err != nil {
+			reason = fmt.Sprintf("%v: %v", reason, e.Err)
+		}
+		r.lastErr = BackendError{Time: e.Time, MAC: e.MAC.String(), Reason: reason}
+	}
+}
+
+// Events returns the recorded requests, most recent first.
+func (r *Recorder) Events() []proxy.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.events)
+	}
+	out := make([]proxy.Event, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.events[(r.next-i+len(r.events))%len(r.events)])
+	}
+	return out
+}
+
+// LastBackendError returns the last backend failure seen, if any.
+func (r *Recorder) LastBackendError() (BackendError, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastErr, !r.lastErr.Time.IsZero()
+}
@@ -0,0 +1,175 @@
+// Package audit writes a machine-parseable record of every boot decision, separate from the human-oriented logs.
+//
+// Every reply and every ignored packet from a PXE client is written as a single line of JSON to one or more sinks,
+// i.e. a rotating File or syslog. Packets that are not from PXE clients (regular DHCP traffic) are not recorded.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-multierror"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+var (
+	// ErrSyslogAddr is used when a syslog address is not "local" or a udp:// or tcp:// URL.
+	ErrSyslogAddr = errors.New(`syslog address must be "local" or a udp:// or tcp:// URL`)
+	// ErrSyslogUnsupported is used when syslog is not available on the platform.
+	ErrSyslogUnsupported = errors.New("syslog is not supported on this platform")
+)
+
+// Record is a single audit log entry.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Host is the name of the proxydhcp server that handled the packet.
+	Host          string    `json:"host,omitempty"`
+	Listener      string    `json:"listener"`
+	Interface     string    `json:"interface,omitempty"`
+	Peer          string    `json:"peer,omitempty"`
+	GatewayAddr   string    `json:"giaddr,omitempty"`
+	MAC           string    `json:"mac"`
+	TransactionID string    `json:"xid"`
+	MessageType   string    `json:"messageType"`
+	Arch          string    `json:"arch"`
+	ClientType    string    `json:"clientType,omitempty"`
+	UserClass     string    `json:"userClass,omitempty"`
+	Outcome       string    `json:"outcome"`
+	IgnoreReason  string    `json:"ignoreReason,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Decision      *Decision `json:"decision,omitempty"`
+	Bootfile      string    `json:"bootfile,omitempty"`
+	NextServer    string    `json:"nextServer,omitempty"`
+	Script        bool      `json:"script,omitempty"`
+}
+
+// Decision is the authorization backend's boot decision.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+	Source string `json:"source"`
+	// Rule is the name of the relay rule that matched the request, if any.
+	Rule string `json:"rule,omitempty"`
+}
+
+// NewRecord converts an Event into a Record.
+func NewRecord(e proxy.Event, host string) Record {
+	r := Record{
+		Time:          e.Time.UTC(),
+		Host:          host,
+		Listener:      e.Listener,
+		Interface:     e.Interface,
+		TransactionID: e.TransactionID,
+		MessageType:   e.MessageType,
+		Arch:          e.Arch,
+		ClientType:    e.ClientType,
+		UserClass:     e.UserClass,
+		Outcome:       string(e.Outcome),
+		IgnoreReason:  e.IgnoreReason,
+		Bootfile:      e.Bootfile,
+		Script:        e.Script,
+	}
+	if e.Peer != nil {
+		r.Peer = e.Peer.String()
+	}
+	if e.GatewayAddr != nil {
+		r.GatewayAddr = e.GatewayAddr.String()
+	}
+	if len(e.MAC) > 0 {
+		r.MAC = e.MAC.String()
+	}
+	if e.Err != nil {
+		r.Error = e.Err.Error()
+	}
+	if e.Decision.Source != "" {
+		r.Decision = &Decision{Allow: e.Decision.Allow, Reason: e.Decision.Reason, Source: e.Decision.Source, Rule: e.Decision.Rule}
+	}
+	if e.NextServer != nil && !e.NextServer.IsUnspecified() {
+		r.NextServer = e.NextServer.String()
+	}
+	return r
+}
+
+// Logger is a proxy.Observer that writes a Record to its sinks for every reply and every ignored packet from a PXE client.
+type Logger struct {
+	// Log is where failures to write a Record are logged.
+	Log logr.Logger
+	// Host is the name of this server, written to every Record.
+	Host string
+
+	mu    sync.Mutex
+	sinks []io.WriteCloser
+}
+
+// Option for setting Logger values.
+type Option func(*Logger)
+
+// WithLogger sets the logger that write failures are logged to.
+func WithLogger(l logr.Logger) Option {
+	return func(a *Logger) { a.Log = l }
+}
+
+// WithHost sets the name of this server written to every Record.
+func WithHost(host string) Option {
+	return func(a *Logger) { a.Host = host }
+}
+
+// WithSink adds a sink. Every Record is written to it as a single line of JSON.
+func WithSink(w io.WriteCloser) Option {
+	return func(a *Logger) { a.sinks = append(a.sinks, w) }
+}
+
+// New returns an audit Logger. Defaults can be overridden by passing in options.
+func New(opts ...Option) *Logger {
+	a := &Logger{Log: logr.Discard()}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Observe writes a Record of the packet to all sinks.
+func (a *Logger) Observe(e proxy.Event) {
+	// packets from other DHCP clients are not recorded, every reply to and deliberate ignore of a PXE client is.
+	if e.NotPXE() {
+		return
+	}
+	b, err := json.Marshal(NewRecord(e, a.Host))
+	if err != nil {
+		a.Log.Error(err, "failed to encode audit record", "mac", macString(e.MAC))
+		return
+	}
+	b = append(b, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, s := range a.sinks {
+		if _, err := s.Write(b); err != nil {
+			a.Log.Error(err, "failed to write audit record", "mac", macString(e.MAC), "xid", e.TransactionID)
+		}
+	}
+}
+
+// Close closes all sinks.
+func (a *Logger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var result *multierror.Error
+	for _, s := range a.sinks {
+		result = multierror.Append(result, s.Close())
+	}
+	a.sinks = nil
+	return result.ErrorOrNil()
+}
+
+func macString(m net.HardwareAddr) string {
+	if len(m) == 0 {
+		return ""
+	}
+	return m.String()
+}
@@ -0,0 +1,247 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// buffer is an in memory sink.
+type buffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *buffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestObserve(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	mac := net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	events := []proxy.Event{
+		{
+			Time:          now,
+			Listener:      "67",
+			Interface:     "eth0",
+			Peer:          &net.UDPAddr{IP: net.IPv4(192, 168, 2, 1), Port: 67},
+			GatewayAddr:   net.IPv4(192, 168, 2, 1),
+			MAC:           mac,
+			TransactionID: "0x01020304",
+			MessageType:   "DISCOVER",
+			Arch:          "EFI x86-64",
+			ClientType:    "PXEClient",
+			Outcome:       proxy.OutcomeOffer,
+			Decision:      proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: "file", Rule: "rack-a"},
+			Bootfile:      "ipxe.efi",
+			NextServer:    net.IPv4(192, 168, 2, 5),
+		},
+		// not from a PXE client, not recorded.
+		{Time: now, Listener: "67", MAC: mac, MessageType: "DISCOVER", Outcome: proxy.OutcomeIgnored, IgnoreReason: "option60_missing", Err: proxy.ErrOpt60Missing},
+		{Time: now, Listener: "67", MAC: mac, MessageType: "INFORM", Outcome: proxy.OutcomeIgnored, IgnoreReason: "invalid_message_type", Err: proxy.ErrInvalidMsgType{Invalid: dhcpv4.MessageTypeInform}},
+		// a PXE client ignored before its architecture is known, recorded.
+		{Time: now, Listener: "67", MAC: mac, MessageType: "DISCOVER", Outcome: proxy.OutcomeIgnored, IgnoreReason: "option97_invalid", Err: proxy.ErrOpt97WrongSize},
+		{
+			Time:          now,
+			Listener:      "547",
+			MAC:           mac,
+			TransactionID: "0x010203",
+			MessageType:   "SOLICIT",
+			Arch:          "EFI x86-64",
+			UserClass:     "iPXE",
+			Outcome:       proxy.OutcomeIgnored,
+			IgnoreReason:  proxy.IgnoreBackendError,
+			Err:           errors.New("tink: timeout"),
+		},
+	}
+	sink := &buffer{}
+	a := New(WithHost("proxydhcp-1"), WithSink(sink))
+	for _, e := range events {
+		a.Observe(e)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.closed {
+		t.Fatal("sink was not closed")
+	}
+
+	want := []Record{
+		{
+			Time:          now,
+			Host:          "proxydhcp-1",
+			Listener:      "67",
+			Interface:     "eth0",
+			Peer:          "192.168.2.1:67",
+			GatewayAddr:   "192.168.2.1",
+			MAC:           mac.String(),
+			TransactionID: "0x01020304",
+			MessageType:   "DISCOVER",
+			Arch:          "EFI x86-64",
+			ClientType:    "PXEClient",
+			Outcome:       "offer",
+			Decision:      &Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: "file", Rule: "rack-a"},
+			Bootfile:      "ipxe.efi",
+			NextServer:    "192.168.2.5",
+		},
+		{
+			Time:         now,
+			Host:         "proxydhcp-1",
+			Listener:     "67",
+			MAC:          mac.String(),
+			MessageType:  "DISCOVER",
+			Outcome:      "ignored",
+			IgnoreReason: "option97_invalid",
+			Error:        proxy.ErrOpt97WrongSize.Error(),
+		},
+		{
+			Time:          now,
+			Host:          "proxydhcp-1",
+			Listener:      "547",
+			MAC:           mac.String(),
+			TransactionID: "0x010203",
+			MessageType:   "SOLICIT",
+			Arch:          "EFI x86-64",
+			UserClass:     "iPXE",
+			Outcome:       "ignored",
+			IgnoreReason:  proxy.IgnoreBackendError,
+			Error:         "tink: timeout",
+		},
+	}
+	var got []Record
+	sc := bufio.NewScanner(&sink.Buffer)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		got = append(got, r)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFileRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// every line fills a file, so each write after the first rotates.
+	for _, line := range []string{"one\n", "two two\n", "three\n", "four\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{
+		path:        "four\n",
+		path + ".1": "three\n",
+		path + ".2": "two two\n",
+	}
+	for name, content := range want {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Fatalf("%v: got %q, want %q", name, b, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only 2 backups, got error %v", err)
+	}
+
+	// an existing file is appended to, and its size counted.
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = OpenFile(path, 10, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("five\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("six\n")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "six\n" {
+		t.Fatalf("got %q, want %q", b, "six\n")
+	}
+	b, err = os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "four\nfive\n" {
+		t.Fatalf("got %q, want %q", b, "four\nfive\n")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("seven\n")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("got %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func TestFileRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// the oldest backup, <path>.2, can't be removed, so rotating fails.
+	if err := os.MkdirAll(filepath.Join(path+".2", "busy"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("two two\n")); err == nil {
+		t.Fatal("expected the rotation error")
+	}
+	// records are still written, and rotation works again once it can.
+	if err := os.RemoveAll(path + ".2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("three\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		path:        "three\n",
+		path + ".1": "one\ntwo two\n",
+	}
+	for name, content := range want {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Fatalf("%v: got %q, want %q", name, b, content)
+		}
+	}
+}
+
+func TestDialSyslogAddr(t *testing.T) {
+	for _, addr := range []string{"192.168.2.10:514", "http://192.168.2.10:514", "udp://"} {
+		if _, err := DialSyslog(addr, "proxydhcp"); !errors.Is(err, ErrSyslogAddr) && !errors.Is(err, ErrSyslogUnsupported) {
+			t.Fatalf("%v: got %v, want %v", addr, err, ErrSyslogAddr)
+		}
+	}
+}
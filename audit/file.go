@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	// DefaultMaxSize is the default size, in bytes, a File is rotated at.
+	DefaultMaxSize = 100 << 20
+	// DefaultMaxBackups is the default number of rotated files kept.
+	DefaultMaxBackups = 5
+)
+
+// File is an append only file that is rotated once it reaches MaxSize bytes.
+// Rotated files are renamed to <path>.1, <path>.2, ... with <path>.1 being the most recent. At most MaxBackups are kept.
+type File struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	closed bool
+}
+
+// OpenFile opens, or creates, the audit log at path. A maxSize of 0 disables rotation.
+func OpenFile(path string, maxSize int64, maxBackups int) (*File, error) {
+	f := &File{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p to the file, rotating it first if p would grow it past MaxSize.
+// p is never split across files. When rotating fails p is still appended to the file, and the error returned,
+// so that records are not lost while i.e. the disk is full.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.f == nil {
+		// a failed rotation could not reopen the file, try again.
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	var rerr error
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		if rerr = f.rotate(); rerr != nil && f.f == nil {
+			return 0, rerr
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	if err == nil && rerr != nil {
+		err = fmt.Errorf("written without rotating %v: %w", f.Path, rerr)
+	}
+	return n, err
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
+
+func (f *File) open() error {
+	fd, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	f.f, f.size = fd, info.Size()
+	return nil
+}
+
+// rotate shifts the backups up by one, dropping the oldest, moves the current file to <path>.1 and opens a new one.
+// When that fails <path> is reopened, f.f is nil if that fails too. f.mu must be held.
+func (f *File) rotate() (err error) {
+	defer func() {
+		if err != nil && f.f == nil {
+			_ = f.open()
+		}
+	}()
+	err = f.f.Close()
+	f.f = nil
+	if err != nil {
+		return err
+	}
+	if f.MaxBackups <= 0 {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+	if err := os.Remove(f.backup(f.MaxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := f.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.Path, f.backup(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *File) backup(n int) string {
+	return fmt.Sprintf("%v.%d", f.Path, n)
+}
@@ -0,0 +1,23 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+)
+
+// DialSyslog connects to a syslog server. Records are sent with the daemon facility and info severity.
+// addr is "local" for the local syslog daemon or a URL, i.e. "udp://192.168.2.10:514" or "tcp://192.168.2.10:514".
+func DialSyslog(addr, tag string) (io.WriteCloser, error) {
+	if addr == "local" {
+		return syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" || (u.Scheme != "udp" && u.Scheme != "tcp") {
+		return nil, fmt.Errorf("%w: %v", ErrSyslogAddr, addr)
+	}
+	return syslog.Dial(u.Scheme, u.Host, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package audit
+
+import "io"
+
+// DialSyslog is not supported on this platform.
+func DialSyslog(_, _ string) (io.WriteCloser, error) {
+	return nil, ErrSyslogUnsupported
+}
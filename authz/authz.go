@@ -0,0 +1,36 @@
+// Package authz holds functionality shared by the authorization backends.
+package authz
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/tinkerbell/tink/protos/hardware"
+)
+
+// Reloader is implemented by authorization backends that can reload their data while running.
+type Reloader interface {
+	// Reload replaces the backend's data. On error, the current data is kept.
+	Reload() error
+}
+
+// HealthChecker is implemented by authorization backends that can report whether they are able to make decisions.
+type HealthChecker interface {
+	// Healthy returns an error describing why the backend is not able to make decisions, or nil.
+	Healthy(ctx context.Context) error
+}
+
+// Decision translates the netboot settings of a hardware interface into a boot decision.
+// netboot.allow_pxe is whether the machine is allowed to PXE boot and
+// netboot.ipxe.url, when set, is the iPXE script served to the machine.
+func Decision(iface *hardware.Hardware_Network_Interface) proxy.Decision {
+	d := proxy.Decision{Allow: iface.GetNetboot().GetAllowPxe(), Reason: proxy.ReasonPXEDisabled}
+	if d.Allow {
+		d.Reason = proxy.ReasonAllowed
+	}
+	if u, err := url.Parse(iface.GetNetboot().GetIpxe().GetUrl()); err == nil && u.Host != "" {
+		d.IPXEScriptURL = u
+	}
+	return d
+}
@@ -0,0 +1,241 @@
+// Package cache implements an authorization backend that caches the decisions of another backend.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/authz"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// Cache is a proxy.Allower that caches the decisions of a backend Allower per mac address.
+// A backend that is a proxy.ClientResolver gets everything known about a client, its decisions are cached per client instead,
+// see key. Allowed decisions are cached for TTL and not allowed decisions for NegativeTTL.
+// When the backend fails, an expired decision is used for up to StaleTTL after it expired (stale-if-error).
+// The least recently used decision is evicted when the cache holds MaxSize decisions. Use New to create a Cache.
+type Cache struct {
+	Backend     proxy.Allower
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	StaleTTL    time.Duration
+	// MaxSize is the maximum number of cached decisions, 0 is unlimited.
+	MaxSize int
+	Log     logr.Logger
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+	stats   counters
+}
+
+// Stats are the counters of a Cache.
+type Stats struct {
+	// Hits is the number of decisions served from the cache.
+	Hits uint64 `json:"hits"`
+	// Misses is the number of decisions that had to be asked of the backend.
+	Misses uint64 `json:"misses"`
+	// StaleHits is the number of expired decisions served because the backend failed (stale-if-error).
+	StaleHits uint64 `json:"staleHits"`
+	// Errors is the number of backend failures.
+	Errors uint64 `json:"errors"`
+	// Evictions is the number of decisions evicted to stay within MaxSize.
+	Evictions uint64 `json:"evictions"`
+	// Size is the number of cached decisions.
+	Size int `json:"size"`
+}
+
+type counters struct {
+	hits, misses, staleHits, errors, evictions uint64
+}
+
+type entry struct {
+	key     string
+	d       proxy.Decision
+	expires time.Time
+}
+
+// Option for setting Cache values.
+type Option func(*Cache)
+
+// WithTTL sets how long allowed decisions are cached.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *Cache) { c.TTL = ttl }
+}
+
+// WithNegativeTTL sets how long not allowed decisions are cached.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *Cache) { c.NegativeTTL = ttl }
+}
+
+// WithStaleTTL sets how long after expiring a decision can still be used when the backend fails (stale-if-error).
+// Expired decisions are never used while the backend is healthy.
+func WithStaleTTL(ttl time.Duration) Option {
+	return func(c *Cache) { c.StaleTTL = ttl }
+}
+
+// WithMaxSize sets the maximum number of cached decisions.
+func WithMaxSize(n int) Option {
+	return func(c *Cache) { c.MaxSize = n }
+}
+
+// WithLogger sets the logger.
+func WithLogger(l logr.Logger) Option {
+	return func(c *Cache) { c.Log = l }
+}
+
+// New returns a Cache in front of the backend.
+func New(backend proxy.Allower, opts ...Option) *Cache {
+	c := &Cache{
+		Backend: backend,
+		Log:     logr.Discard(),
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Allow returns whether the mac address is allowed to PXE boot.
+func (c *Cache) Allow(ctx context.Context, mac net.HardwareAddr) bool {
+	d, err := c.ResolveClient(ctx, proxy.Client{MAC: mac})
+	if err != nil {
+		c.Log.Error(err, "backend failed to make a decision", "mac", mac.String())
+		return false
+	}
+	return d.Allow
+}
+
+// Resolve returns the boot decision for the mac address.
+func (c *Cache) Resolve(ctx context.Context, mac net.HardwareAddr) (proxy.Decision, error) {
+	return c.ResolveClient(ctx, proxy.Client{MAC: mac})
+}
+
+// ResolveClient returns the cached boot decision for the client or asks the backend.
+// Backend errors are not cached.
+func (c *Cache) ResolveClient(ctx context.Context, cl proxy.Client) (proxy.Decision, error) {
+	key := c.key(cl)
+	now := c.now()
+	cached, found := c.get(key)
+	if found && now.Before(cached.expires) {
+		atomic.AddUint64(&c.stats.hits, 1)
+		return cached.d, nil
+	}
+	atomic.AddUint64(&c.stats.misses, 1)
+
+	d, err := proxy.Resolve(ctx, c.Backend, cl)
+	if err != nil {
+		atomic.AddUint64(&c.stats.errors, 1)
+		if found && now.Before(cached.expires.Add(c.StaleTTL)) {
+			atomic.AddUint64(&c.stats.staleHits, 1)
+			c.Log.Info("backend failed to make a decision, using the expired cached decision", "mac", cl.MAC.String(), "error", err.Error(), "expired", cached.expires)
+			return cached.d, nil
+		}
+		return d, err
+	}
+	ttl := c.TTL
+	if !d.Allow {
+		ttl = c.NegativeTTL
+	}
+	if ttl > 0 {
+		c.set(entry{key: key, d: d, expires: now.Add(ttl)})
+	}
+	return d, nil
+}
+
+// key returns the cache key of a client, made of everything the backend's decision can depend on.
+// A proxy.Resolver decides on the mac address, and the GUID when it is a proxy.GUIDResolver.
+// A proxy.ClientResolver can decide on any field of the client, i.e. the firmware and iPXE requests of a machine
+// (different user classes) or the same machine behind different relay agents get their own decisions.
+// The peer address is left out, a client's source port is not part of who it is.
+func (c *Cache) key(cl proxy.Client) string {
+	if _, ok := c.Backend.(proxy.ClientResolver); ok {
+		k := fmt.Sprintf("%v|%d|%q|%q|%q|%q|%q|%q", cl.MAC, cl.Arch, cl.UserClass, cl.VendorClass, cl.GUID, cl.MessageType, cl.Interface, cl.ListenAddr)
+		if r := cl.Relay; r != nil {
+			k += fmt.Sprintf("|%v|%x|%x|%v|%x", r.GatewayAddr, r.CircuitID, r.RemoteID, r.LinkSelection, r.SubscriberID)
+		}
+		return k
+	}
+	if _, ok := c.Backend.(proxy.GUIDResolver); ok && cl.GUID != "" {
+		return cl.MAC.String() + "|" + cl.GUID
+	}
+	return cl.MAC.String()
+}
+
+// Reload purges the cache and reloads the backend, if it supports reloading.
+func (c *Cache) Reload() error {
+	c.Purge()
+	if r, ok := c.Backend.(authz.Reloader); ok {
+		return r.Reload()
+	}
+	return nil
+}
+
+// Healthy reports the health of the backend, if it supports it.
+func (c *Cache) Healthy(ctx context.Context) error {
+	if h, ok := c.Backend.(authz.HealthChecker); ok {
+		return h.Healthy(ctx)
+	}
+	return nil
+}
+
+// Purge removes all cached decisions.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Stats returns the cache counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.stats.hits),
+		Misses:    atomic.LoadUint64(&c.stats.misses),
+		StaleHits: atomic.LoadUint64(&c.stats.staleHits),
+		Errors:    atomic.LoadUint64(&c.stats.errors),
+		Evictions: atomic.LoadUint64(&c.stats.evictions),
+		Size:      size,
+	}
+}
+
+func (c *Cache) get(key string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, found := c.entries[key]
+	if !found {
+		return entry{}, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(entry), true
+}
+
+func (c *Cache) set(e entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, found := c.entries[e.key]; found {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.MaxSize > 0 && c.lru.Len() > c.MaxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(entry).key)
+		atomic.AddUint64(&c.stats.evictions, 1)
+	}
+}
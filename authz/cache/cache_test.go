@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// backend is a proxy.Resolver that counts calls and returns a configurable decision or error.
+type backend struct {
+	calls int
+	allow bool
+	err   error
+}
+
+func (b *backend) Allow(_ context.Context, _ net.HardwareAddr) bool {
+	return b.allow
+}
+
+func (b *backend) Resolve(_ context.Context, _ net.HardwareAddr) (proxy.Decision, error) {
+	b.calls++
+	if b.err != nil {
+		return proxy.Decision{}, b.err
+	}
+	return proxy.Decision{Allow: b.allow}, nil
+}
+
+var (
+	mac1 = net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	mac2 = net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x06}
+	mac3 = net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x07}
+)
+
+// clock is a manually advanced time source.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newCache(b proxy.Allower, clk *clock, opts ...Option) *Cache {
+	c := New(b, opts...)
+	c.now = clk.now
+	return c
+}
+
+func TestTTL(t *testing.T) {
+	clk := &clock{t: time.Unix(0, 0)}
+	b := &backend{allow: true}
+	c := newCache(b, clk, WithTTL(time.Minute), WithNegativeTTL(time.Second))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if !c.Allow(ctx, mac1) {
+			t.Fatal("expected allowed")
+		}
+	}
+	if b.calls != 1 {
+		t.Fatalf("backend calls = %v, want 1", b.calls)
+	}
+	clk.t = clk.t.Add(2 * time.Minute)
+	b.allow = false
+	if c.Allow(ctx, mac1) {
+		t.Fatal("expected the expired decision to be refreshed")
+	}
+	// not allowed decisions use the negative ttl.
+	clk.t = clk.t.Add(2 * time.Second)
+	c.Allow(ctx, mac1)
+	if b.calls != 3 {
+		t.Fatalf("backend calls = %v, want 3", b.calls)
+	}
+	want := Stats{Hits: 2, Misses: 3, Size: 1}
+	if diff := cmp.Diff(c.Stats(), want); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestStale(t *testing.T) {
+	clk := &clock{t: time.Unix(0, 0)}
+	b := &backend{allow: true}
+	c := newCache(b, clk, WithTTL(time.Minute), WithStaleTTL(time.Hour))
+	ctx := context.Background()
+
+	c.Allow(ctx, mac1)
+	b.err = errors.New("unavailable")
+	clk.t = clk.t.Add(30 * time.Minute)
+	d, err := c.Resolve(ctx, mac1)
+	if err != nil || !d.Allow {
+		t.Fatalf("expected the stale decision, got %+v, %v", d, err)
+	}
+	clk.t = clk.t.Add(2 * time.Hour)
+	if _, err := c.Resolve(ctx, mac1); err == nil {
+		t.Fatal("expected an error once the stale ttl has passed")
+	}
+	// errors are not cached.
+	if _, err := c.Resolve(ctx, mac2); err == nil {
+		t.Fatal("expected an error for an uncached mac")
+	}
+	want := Stats{Misses: 4, StaleHits: 1, Errors: 3, Size: 1}
+	if diff := cmp.Diff(c.Stats(), want); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	clk := &clock{t: time.Unix(0, 0)}
+	b := &backend{allow: true}
+	c := newCache(b, clk, WithTTL(time.Minute), WithMaxSize(2))
+	ctx := context.Background()
+
+	c.Allow(ctx, mac1)
+	c.Allow(ctx, mac2)
+	c.Allow(ctx, mac1) // mac2 is now the least recently used.
+	c.Allow(ctx, mac3)
+	c.Allow(ctx, mac1)
+	if b.calls != 3 {
+		t.Fatalf("backend calls = %v, want 3", b.calls)
+	}
+	c.Allow(ctx, mac2)
+	if b.calls != 4 {
+		t.Fatalf("backend calls = %v, want 4, mac2 should have been evicted", b.calls)
+	}
+	if got := c.Stats(); got.Evictions != 2 || got.Size != 2 {
+		t.Fatalf("stats = %+v", got)
+	}
+}
+
+func TestReload(t *testing.T) {
+	b := &backend{allow: true}
+	c := New(b, WithTTL(time.Minute))
+	c.Allow(context.Background(), mac1)
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	c.Allow(context.Background(), mac1)
+	if b.calls != 2 {
+		t.Fatalf("backend calls = %v, want 2", b.calls)
+	}
+}
+
+// clientBackend is a proxy.ClientResolver that counts calls and allows clients that are not running iPXE.
+type clientBackend struct {
+	calls int
+}
+
+func (b *clientBackend) Allow(_ context.Context, _ net.HardwareAddr) bool {
+	return true
+}
+
+func (b *clientBackend) ResolveClient(_ context.Context, cl proxy.Client) (proxy.Decision, error) {
+	b.calls++
+	return proxy.Decision{Allow: cl.UserClass != "iPXE"}, nil
+}
+
+func TestClientResolverKey(t *testing.T) {
+	clk := &clock{t: time.Unix(0, 0)}
+	b := &clientBackend{}
+	c := newCache(b, clk, WithTTL(time.Minute), WithNegativeTTL(time.Minute))
+	ctx := context.Background()
+
+	firmware := proxy.Client{MAC: mac1, MessageType: "DISCOVER"}
+	ipxe := proxy.Client{MAC: mac1, MessageType: "DISCOVER", UserClass: "iPXE"}
+	relayed := proxy.Client{MAC: mac1, MessageType: "DISCOVER", Relay: &proxy.RelayInfo{CircuitID: []byte("switch1/eth1")}}
+	for _, tt := range []struct {
+		cl        proxy.Client
+		wantAllow bool
+		wantCalls int
+	}{
+		{cl: firmware, wantAllow: true, wantCalls: 1},
+		{cl: ipxe, wantAllow: false, wantCalls: 2},
+		{cl: relayed, wantAllow: true, wantCalls: 3},
+		{cl: firmware, wantAllow: true, wantCalls: 3},
+		{cl: ipxe, wantAllow: false, wantCalls: 3},
+	} {
+		d, err := c.ResolveClient(ctx, tt.cl)
+		if err != nil || d.Allow != tt.wantAllow || b.calls != tt.wantCalls {
+			t.Fatalf("ResolveClient(%+v) = %+v, %v with %v calls, want allow %v with %v calls", tt.cl, d, err, b.calls, tt.wantAllow, tt.wantCalls)
+		}
+	}
+	// a different source port is the same client.
+	firmware.Peer = "0.0.0.0:68"
+	if _, err := c.ResolveClient(ctx, firmware); err != nil || b.calls != 3 {
+		t.Fatalf("ResolveClient() = %v with %v calls, want 3 calls", err, b.calls)
+	}
+}
@@ -3,26 +3,159 @@ package file
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strings"
 
+	"github.com/jacobweinstock/proxydhcp/authz"
+	"github.com/jacobweinstock/proxydhcp/proxy"
 	"github.com/tinkerbell/tink/protos/hardware"
 )
 
+// Source is the name of this backend in boot decisions.
+const Source = "file"
+
 // File holds a slice of hardware records.
+// Use NewFile to index the records by mac address and id, otherwise every look up scans all records.
 type File struct {
 	DB []*hardware.Hardware
+	// macs maps normalized mac addresses to their interface.
+	macs map[string]*hardware.Hardware_Network_Interface
+	// ids maps lower cased hardware ids to their record.
+	ids map[string]*hardware.Hardware
+}
+
+// ErrDuplicateMAC is used when more than one hardware record interface has the same mac address.
+type ErrDuplicateMAC struct {
+	MAC string
+	// IDs are the ids of the hardware records with the mac address.
+	IDs [2]string
+}
+
+// Error returns the string representation of ErrDuplicateMAC.
+func (e ErrDuplicateMAC) Error() string {
+	return fmt.Sprintf("mac address %v is used by more than one interface, hardware ids: %q, %q", e.MAC, e.IDs[0], e.IDs[1])
+}
+
+// ErrDuplicateID is used when more than one hardware record has the same id.
+type ErrDuplicateID struct {
+	ID string
+}
+
+// Error returns the string representation of ErrDuplicateID.
+func (e ErrDuplicateID) Error() string {
+	return fmt.Sprintf("hardware id %q is used by more than one hardware record", e.ID)
+}
+
+// ErrInvalidMAC is used when a hardware record interface has a mac address that can't be parsed.
+type ErrInvalidMAC struct {
+	MAC    string
+	ID     string
+	Detail string
+}
+
+// Error returns the string representation of ErrInvalidMAC.
+func (e ErrInvalidMAC) Error() string {
+	return fmt.Sprintf("hardware id %q: invalid mac address %q: %v", e.ID, e.MAC, e.Detail)
+}
+
+// NewFile indexes the hardware records by mac address and id.
+// Interfaces without a mac address are ignored. Invalid and duplicate mac addresses and duplicate ids are an error.
+func NewFile(db []*hardware.Hardware) (File, error) {
+	f := File{
+		DB:   db,
+		macs: make(map[string]*hardware.Hardware_Network_Interface),
+		ids:  make(map[string]*hardware.Hardware),
+	}
+	owner := make(map[string]string)
+	for _, hw := range db {
+		if id := strings.ToLower(hw.GetId()); id != "" {
+			if _, found := f.ids[id]; found {
+				return File{}, ErrDuplicateID{ID: hw.GetId()}
+			}
+			f.ids[id] = hw
+		}
+		for _, iface := range hw.GetNetwork().GetInterfaces() {
+			m := iface.GetDhcp().GetMac()
+			if m == "" {
+				continue
+			}
+			mac, err := net.ParseMAC(m)
+			if err != nil {
+				return File{}, ErrInvalidMAC{MAC: m, ID: hw.GetId(), Detail: err.Error()}
+			}
+			if _, found := f.macs[mac.String()]; found {
+				return File{}, ErrDuplicateMAC{MAC: mac.String(), IDs: [2]string{owner[mac.String()], hw.GetId()}}
+			}
+			f.macs[mac.String()] = iface
+			owner[mac.String()] = hw.GetId()
+		}
+	}
+	return f, nil
 }
 
 // Allow checks if a mac address exists in the DB and returns it's allow_pxe field or false.
-func (f File) Allow(_ context.Context, mac net.HardwareAddr) bool {
+func (f File) Allow(ctx context.Context, mac net.HardwareAddr) bool {
+	d, _ := f.Resolve(ctx, mac)
+	return d.Allow
+}
+
+// Resolve returns the boot decision from the hardware record interface with the mac address.
+// A mac address not found in the DB is not allowed to PXE boot.
+func (f File) Resolve(_ context.Context, mac net.HardwareAddr) (proxy.Decision, error) {
+	iface, found := f.LookupMAC(mac)
+	if !found {
+		return proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}, nil
+	}
+	d := authz.Decision(iface)
+	d.Source = Source
+	return d, nil
+}
+
+// ResolveGUID returns the boot decision from the first interface of the hardware record with the id guid.
+func (f File) ResolveGUID(_ context.Context, guid string) (proxy.Decision, error) {
+	hw, found := f.LookupGUID(guid)
+	if !found || len(hw.GetNetwork().GetInterfaces()) == 0 {
+		return proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}, nil
+	}
+	d := authz.Decision(hw.GetNetwork().GetInterfaces()[0])
+	d.Source = Source
+	return d, nil
+}
+
+// LookupMAC returns the hardware record interface with the mac address.
+func (f File) LookupMAC(mac net.HardwareAddr) (*hardware.Hardware_Network_Interface, bool) {
+	if f.macs != nil {
+		iface, found := f.macs[mac.String()]
+		return iface, found
+	}
 	for _, v := range f.DB {
-		for _, hip := range v.Network.Interfaces {
-			if hw, err := net.ParseMAC(hip.Dhcp.Mac); err == nil {
+		for _, hip := range v.GetNetwork().GetInterfaces() {
+			if hw, err := net.ParseMAC(hip.GetDhcp().GetMac()); err == nil {
 				if hw.String() == mac.String() {
-					return hip.Netboot.AllowPxe
+					return hip, true
 				}
 			}
 		}
 	}
-	return false
+	return nil, false
+}
+
+// LookupGUID returns the hardware record whose id is the client machine identifier (DHCP option 97).
+// The comparison is case insensitive.
+func (f File) LookupGUID(guid string) (*hardware.Hardware, bool) {
+	guid = strings.ToLower(guid)
+	if guid == "" {
+		return nil, false
+	}
+	if f.ids != nil {
+		hw, found := f.ids[guid]
+		return hw, found
+	}
+	for _, hw := range f.DB {
+		if strings.ToLower(hw.GetId()) == guid {
+			return hw, true
+		}
+	}
+	return nil, false
 }
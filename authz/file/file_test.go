@@ -3,10 +3,14 @@ package file
 import (
 	"context"
 	"net"
+	"net/url"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jacobweinstock/proxydhcp/proxy"
 	"github.com/tinkerbell/tink/protos/hardware"
+	"inet.af/netaddr"
 )
 
 func TestAllow(t *testing.T) {
@@ -41,3 +45,101 @@ func TestAllow(t *testing.T) {
 		})
 	}
 }
+
+func TestResolve(t *testing.T) {
+	record := File{DB: []*hardware.Hardware{{
+		Network: &hardware.Hardware_Network{
+			Interfaces: []*hardware.Hardware_Network_Interface{
+				{
+					Dhcp: &hardware.Hardware_DHCP{Mac: "0a:00:27:00:00:00"},
+					Netboot: &hardware.Hardware_Netboot{
+						AllowPxe: true,
+						Ipxe:     &hardware.Hardware_Netboot_IPXE{Url: "http://192.168.2.3/custom.ipxe"},
+					},
+				},
+			},
+		},
+	}}}
+	tests := map[string]struct {
+		mac  string
+		want proxy.Decision
+	}{
+		"ipxe script url": {"0a:00:27:00:00:00", proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: Source, IPXEScriptURL: &url.URL{Scheme: "http", Host: "192.168.2.3", Path: "/custom.ipxe"}}},
+		"not found":       {"0a:00:27:00:00:01", proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hw, _ := net.ParseMAC(tc.mac)
+			got, err := record.Resolve(context.TODO(), hw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tc.want, cmpopts.IgnoreUnexported(netaddr.IPPort{})); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func hw(id string, macs ...string) *hardware.Hardware {
+	h := &hardware.Hardware{Id: id, Network: &hardware.Hardware_Network{}}
+	for _, m := range macs {
+		h.Network.Interfaces = append(h.Network.Interfaces, &hardware.Hardware_Network_Interface{
+			Dhcp:    &hardware.Hardware_DHCP{Mac: m},
+			Netboot: &hardware.Hardware_Netboot{AllowPxe: true},
+		})
+	}
+	return h
+}
+
+func TestNewFile(t *testing.T) {
+	tests := map[string]struct {
+		db      []*hardware.Hardware
+		wantErr error
+	}{
+		"success":                     {db: []*hardware.Hardware{hw("a", "0a:00:27:00:00:00", ""), hw("b", "0a:00:27:00:00:01")}},
+		"duplicate mac across record": {db: []*hardware.Hardware{hw("a", "0a:00:27:00:00:00"), hw("b", "0A-00-27-00-00-00")}, wantErr: ErrDuplicateMAC{MAC: "0a:00:27:00:00:00", IDs: [2]string{"a", "b"}}},
+		"duplicate mac in record":     {db: []*hardware.Hardware{hw("a", "0a:00:27:00:00:00", "0a:00:27:00:00:00")}, wantErr: ErrDuplicateMAC{MAC: "0a:00:27:00:00:00", IDs: [2]string{"a", "a"}}},
+		"duplicate id":                {db: []*hardware.Hardware{hw("a", "0a:00:27:00:00:00"), hw("A", "0a:00:27:00:00:01")}, wantErr: ErrDuplicateID{ID: "A"}},
+		"invalid mac":                 {db: []*hardware.Hardware{hw("a", "not-a-mac")}, wantErr: ErrInvalidMAC{MAC: "not-a-mac", ID: "a", Detail: "address not-a-mac: invalid MAC address"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewFile(tc.db)
+			if diff := cmp.Diff(err, tc.wantErr, cmpopts.EquateErrors()); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	db := []*hardware.Hardware{hw("a"), hw("4C4C4544-0042-3510-8052-B7C04F4E3732", "0a:00:27:00:00:00", "0a:00:27:00:00:01")}
+	indexed, err := NewFile(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, f := range map[string]File{"indexed": indexed, "not indexed": {DB: db}} {
+		t.Run(name, func(t *testing.T) {
+			mac, _ := net.ParseMAC("0A:00:27:00:00:01")
+			iface, found := f.LookupMAC(mac)
+			if !found || iface != db[1].Network.Interfaces[1] {
+				t.Fatalf("LookupMAC() = %v, %v", iface, found)
+			}
+			if _, found := f.LookupMAC(net.HardwareAddr{0, 0, 0, 0, 0, 0}); found {
+				t.Fatal("LookupMAC() found an unknown mac")
+			}
+			got, found := f.LookupGUID("4c4c4544-0042-3510-8052-b7c04f4e3732")
+			if !found || got != db[1] {
+				t.Fatalf("LookupGUID() = %v, %v", got, found)
+			}
+			d, err := f.ResolveGUID(context.Background(), "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(d, proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}, cmpopts.IgnoreUnexported(netaddr.IPPort{})); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/pkg/errors"
+	"github.com/tinkerbell/tink/protos/hardware"
+)
+
+// DefaultPollInterval is how often the file is checked for changes when inotify is not used.
+const DefaultPollInterval = 5 * time.Second
+
+// Watcher is an authorization backend for a file of hardware records that can be reloaded while running.
+// The records are swapped atomically, so in flight requests always see either the old or the new records.
+type Watcher struct {
+	// Filename is the JSON file of hardware records.
+	Filename string
+	// PollInterval, when set, checks the file for changes at this interval instead of using inotify.
+	// inotify is only available on Linux, other platforms always poll (DefaultPollInterval when not set).
+	PollInterval time.Duration
+	Log          logr.Logger
+
+	mu      sync.RWMutex
+	file    File
+	lastErr error
+}
+
+// NewWatcher returns a Watcher with the hardware records in filename loaded.
+func NewWatcher(filename string, log logr.Logger) (*Watcher, error) {
+	w := &Watcher{Filename: filename, Log: log}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Load reads a JSON file of hardware records.
+func Load(filename string) ([]*hardware.Hardware, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read file %q", filename)
+	}
+	db := []*hardware.Hardware{}
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse configuration file %q", filename)
+	}
+	return db, nil
+}
+
+// Reload reads the file and swaps in its hardware records.
+// If the file can't be loaded, the current records are kept and the error is returned.
+func (w *Watcher) Reload() error {
+	f, err := w.load()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastErr = err
+	if err != nil {
+		return err
+	}
+	w.file = f
+	return nil
+}
+
+// load reads and indexes the hardware records in the file.
+func (w *Watcher) load() (File, error) {
+	db, err := Load(w.Filename)
+	if err != nil {
+		return File{}, err
+	}
+	f, err := NewFile(db)
+	if err != nil {
+		return File{}, fmt.Errorf("invalid hardware records in %q: %w", w.Filename, err)
+	}
+	return f, nil
+}
+
+// Healthy returns the error of the last reload, if it failed. The records from before the failure are still being used.
+func (w *Watcher) Healthy(_ context.Context) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.lastErr != nil {
+		return fmt.Errorf("last reload failed, using the previous records: %w", w.lastErr)
+	}
+	return nil
+}
+
+// Allow checks if a mac address exists in the current records and returns it's allow_pxe field or false.
+func (w *Watcher) Allow(ctx context.Context, mac net.HardwareAddr) bool {
+	return w.current().Allow(ctx, mac)
+}
+
+// Resolve returns the boot decision from the current records.
+func (w *Watcher) Resolve(ctx context.Context, mac net.HardwareAddr) (proxy.Decision, error) {
+	return w.current().Resolve(ctx, mac)
+}
+
+// ResolveGUID returns the boot decision from the current records.
+func (w *Watcher) ResolveGUID(ctx context.Context, guid string) (proxy.Decision, error) {
+	return w.current().ResolveGUID(ctx, guid)
+}
+
+func (w *Watcher) current() File {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.file
+}
+
+// Watch reloads the records whenever the file changes. It blocks until the context is canceled.
+// A file that fails to load is logged and the current records are kept.
+func (w *Watcher) Watch(ctx context.Context) error {
+	if w.PollInterval > 0 {
+		return w.poll(ctx, w.PollInterval)
+	}
+	return w.watch(ctx)
+}
+
+// poll checks the file at every interval and reloads it when it changed, see changed.
+func (w *Watcher) poll(ctx context.Context, interval time.Duration) error {
+	last, _ := os.Stat(w.Filename)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+		fi, err := os.Stat(w.Filename)
+		if err != nil {
+			w.Log.Error(err, "unable to check file for changes", "filename", w.Filename)
+			continue
+		}
+		if !changed(last, fi) {
+			continue
+		}
+		last = fi
+		w.reload()
+	}
+}
+
+// changed returns true if fi is a different file than last, i.e. the target of a swapped symlink, or it was modified.
+func changed(last, fi os.FileInfo) bool {
+	return last == nil || !os.SameFile(last, fi) || !fi.ModTime().Equal(last.ModTime()) || fi.Size() != last.Size()
+}
+
+// reload calls Reload and logs the outcome.
+func (w *Watcher) reload() {
+	if err := w.Reload(); err != nil {
+		w.Log.Error(err, "failed to reload file, keeping the current hardware records", "filename", w.Filename)
+		return
+	}
+	w.Log.Info("reloaded hardware records", "filename", w.Filename)
+}
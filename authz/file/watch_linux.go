@@ -0,0 +1,57 @@
+//go:build linux
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// watch uses inotify to reload the records when the file changes.
+// The directory is watched, not the file, so that files replaced by a rename (editors, kubectl cp, etc) are picked up.
+// Any event in the directory checks the file, as a Kubernetes ConfigMap mount is updated by swapping the ..data
+// symlink that the file points through, no event names the file itself.
+// If inotify can't be used, it falls back to polling.
+func (w *Watcher) watch(ctx context.Context) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		w.Log.Error(err, "unable to use inotify, falling back to polling", "interval", DefaultPollInterval.String())
+		return w.poll(ctx, DefaultPollInterval)
+	}
+	// a non-blocking fd is added to the runtime poller, so Close unblocks Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+	if _, err := unix.InotifyAddWatch(fd, filepath.Dir(w.Filename), unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO|unix.IN_CREATE); err != nil {
+		w.Log.Error(err, "unable to use inotify, falling back to polling", "interval", DefaultPollInterval.String())
+		return w.poll(ctx, DefaultPollInterval)
+	}
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	last, _ := os.Stat(w.Filename)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		if _, err := f.Read(buf); err != nil {
+			if ctx.Err() != nil || errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		fi, err := os.Stat(w.Filename)
+		if err != nil {
+			// the file is being replaced, the event that completes it follows.
+			continue
+		}
+		if !changed(last, fi) {
+			continue
+		}
+		last = fi
+		w.reload()
+	}
+}
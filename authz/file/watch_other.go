@@ -0,0 +1,10 @@
+//go:build !linux
+
+package file
+
+import "context"
+
+// watch falls back to polling as inotify is only available on Linux.
+func (w *Watcher) watch(ctx context.Context) error {
+	return w.poll(ctx, DefaultPollInterval)
+}
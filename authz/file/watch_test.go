@@ -0,0 +1,157 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	allowedRecord = `[{"network":{"interfaces":[{"dhcp":{"mac":"0a:00:27:00:00:00"},"netboot":{"allow_pxe":true}}]}}]`
+	deniedRecord  = `[{"network":{"interfaces":[{"dhcp":{"mac":"0a:00:27:00:00:00"},"netboot":{"allow_pxe":false}}]}}]`
+)
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	// write then rename so the file is never seen half written.
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hardware.json")
+	writeFile(t, name, allowedRecord)
+	w, err := NewWatcher(name, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, _ := net.ParseMAC("0a:00:27:00:00:00")
+	if !w.Allow(context.Background(), mac) {
+		t.Fatal("expected mac to be allowed")
+	}
+
+	// a broken file keeps the current records.
+	writeFile(t, name, `[{"network":`)
+	if err := w.Reload(); err == nil {
+		t.Fatal("expected an error reloading a broken file")
+	}
+	if !w.Allow(context.Background(), mac) {
+		t.Fatal("expected mac to still be allowed after a failed reload")
+	}
+
+	writeFile(t, name, deniedRecord)
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Allow(context.Background(), mac) {
+		t.Fatal("expected mac to not be allowed after reload")
+	}
+}
+
+func TestWatcherWatch(t *testing.T) {
+	tests := map[string]time.Duration{
+		"default": 0,
+		"poll":    10 * time.Millisecond,
+	}
+	for name, interval := range tests {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "hardware.json")
+			writeFile(t, filename, allowedRecord)
+			w, err := NewWatcher(filename, logr.Discard())
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.PollInterval = interval
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() { done <- w.Watch(ctx) }()
+
+			mac, _ := net.ParseMAC("0a:00:27:00:00:00")
+			deadline := time.After(10 * time.Second)
+			for w.Allow(ctx, mac) {
+				// rewrite until seen, the watcher may not be watching yet.
+				writeFile(t, filename, deniedRecord)
+				select {
+				case <-deadline:
+					t.Fatal("timed out waiting for the file to be reloaded")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestWatcherWatchConfigMap updates the file the way the kubelet updates a ConfigMap mount:
+// the file is a symlink through ..data to a timestamped directory, and ..data is swapped to a new directory.
+func TestWatcherWatchConfigMap(t *testing.T) {
+	tests := map[string]time.Duration{
+		"default": 0,
+		"poll":    10 * time.Millisecond,
+	}
+	for name, interval := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			version := func(n int, data string) string {
+				v := fmt.Sprintf("..2022_01_01_00_00_%02d.%d", n, n)
+				if err := os.Mkdir(filepath.Join(dir, v), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, filepath.Join(dir, v, "hardware.json"), data)
+				return v
+			}
+			swap := func(v string) {
+				tmp := filepath.Join(dir, "..data_tmp")
+				if err := os.Symlink(v, tmp); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			swap(version(0, allowedRecord))
+			filename := filepath.Join(dir, "hardware.json")
+			if err := os.Symlink(filepath.Join("..data", "hardware.json"), filename); err != nil {
+				t.Fatal(err)
+			}
+			w, err := NewWatcher(filename, logr.Discard())
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.PollInterval = interval
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() { done <- w.Watch(ctx) }()
+
+			mac, _ := net.ParseMAC("0a:00:27:00:00:00")
+			deadline := time.After(10 * time.Second)
+			for n := 1; w.Allow(ctx, mac); n++ {
+				// swap until seen, the watcher may not be watching yet.
+				swap(version(n, deniedRecord))
+				select {
+				case <-deadline:
+					t.Fatal("timed out waiting for the file to be reloaded")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package kube is an authorization backend that uses Tinkerbell Hardware custom resources in Kubernetes.
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/tinkerbell/tink/pkg/apis/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+)
+
+// Source is the name of this backend in boot decisions.
+const Source = "kube"
+
+// MACAddrIndex is the cache index of Hardware resources by the normalized mac addresses of their interfaces.
+const MACAddrIndex = ".Spec.Interfaces.MAC"
+
+// Kube looks up Hardware resources by mac address.
+type Kube struct {
+	// Client reads Hardware resources. Use NewCluster for an informer cache backed client indexed by MACAddrIndex.
+	Client client.Reader
+	// Namespace, when set, only Hardware resources in this namespace are considered.
+	Namespace string
+	Log       logr.Logger
+}
+
+// RESTConfig returns the config for connecting to the Kubernetes API.
+// The kubeconfig file and the API server URL are optional, the default kubeconfig loading rules and then
+// the in-cluster config are used when not set.
+func RESTConfig(kubeconfig, api string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.ClusterInfo.Server = api
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
+
+// NewCluster returns a cluster whose cache watches Hardware resources, indexed by MACAddrIndex.
+// An empty namespace watches all namespaces. The cluster must be started (cluster.Start) before its cache is used.
+func NewCluster(cfg *rest.Config, namespace string) (cluster.Cluster, error) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	c, err := cluster.New(cfg, func(o *cluster.Options) {
+		o.Scheme = scheme
+		o.Namespace = namespace
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.Hardware{}, MACAddrIndex, MACAddrs); err != nil {
+		return nil, fmt.Errorf("failed to index Hardware by mac address: %w", err)
+	}
+	return c, nil
+}
+
+// MACAddrs returns the normalized mac addresses of a Hardware resource's interfaces. It is the index func for MACAddrIndex.
+func MACAddrs(obj client.Object) []string {
+	hw, ok := obj.(*v1alpha1.Hardware)
+	if !ok {
+		return nil
+	}
+	var macs []string
+	for _, iface := range hw.Spec.Interfaces {
+		if iface.DHCP == nil {
+			continue
+		}
+		if mac, err := net.ParseMAC(iface.DHCP.MAC); err == nil {
+			macs = append(macs, mac.String())
+		}
+	}
+	return macs
+}
+
+// Allow returns the netboot.allowPXE field of the Hardware interface with the mac address or false.
+func (k *Kube) Allow(ctx context.Context, mac net.HardwareAddr) bool {
+	d, err := k.Resolve(ctx, mac)
+	if err != nil {
+		k.Log.Error(err, "failed to get hardware", "mac", mac.String())
+		return false
+	}
+	return d.Allow
+}
+
+// Resolve returns the boot decision from the Hardware interface with the mac address.
+// A mac address found in more than one Hardware resource is not allowed to PXE boot.
+func (k *Kube) Resolve(ctx context.Context, mac net.HardwareAddr) (proxy.Decision, error) {
+	hws := &v1alpha1.HardwareList{}
+	opts := []client.ListOption{client.MatchingFields{MACAddrIndex: mac.String()}}
+	if k.Namespace != "" {
+		opts = append(opts, client.InNamespace(k.Namespace))
+	}
+	if err := k.Client.List(ctx, hws, opts...); err != nil {
+		return proxy.Decision{Source: Source}, fmt.Errorf("failed to list hardware: %w", err)
+	}
+
+	var found []v1alpha1.Interface
+	var names []string
+	for _, hw := range hws.Items {
+		for _, iface := range hw.Spec.Interfaces {
+			if iface.DHCP == nil {
+				continue
+			}
+			if m, err := net.ParseMAC(iface.DHCP.MAC); err == nil && m.String() == mac.String() {
+				found = append(found, iface)
+				names = append(names, hw.Namespace+"/"+hw.Name)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}, nil
+	case 1:
+		return decision(found[0]), nil
+	default:
+		return proxy.Decision{Reason: fmt.Sprintf("mac address found in more than one hardware interface: %v", names), Source: Source}, nil
+	}
+}
+
+// decision translates the netboot settings of a Hardware interface into a boot decision.
+func decision(iface v1alpha1.Interface) proxy.Decision {
+	d := proxy.Decision{Reason: proxy.ReasonPXEDisabled, Source: Source}
+	if iface.Netboot == nil {
+		return d
+	}
+	if iface.Netboot.AllowPXE != nil && *iface.Netboot.AllowPXE {
+		d.Allow = true
+		d.Reason = proxy.ReasonAllowed
+	}
+	if iface.Netboot.IPXE != nil {
+		if u, err := url.Parse(iface.Netboot.IPXE.URL); err == nil && u.Host != "" {
+			d.IPXEScriptURL = u
+		}
+	}
+	return d
+}
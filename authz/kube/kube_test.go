@@ -0,0 +1,137 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/tinkerbell/tink/pkg/apis/core/v1alpha1"
+	"inet.af/netaddr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func hardware(namespace, name string, allowPXE bool, ipxeURL string, macs ...string) *v1alpha1.Hardware {
+	hw := &v1alpha1.Hardware{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	for _, m := range macs {
+		hw.Spec.Interfaces = append(hw.Spec.Interfaces, v1alpha1.Interface{
+			DHCP:    &v1alpha1.DHCP{MAC: m},
+			Netboot: &v1alpha1.Netboot{AllowPXE: &allowPXE, IPXE: &v1alpha1.IPXE{URL: ipxeURL}},
+		})
+	}
+	return hw
+}
+
+func newClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return indexedClient{fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+}
+
+// indexedClient lists Hardware by MACAddrIndex like the informer cache of NewCluster does.
+// The fake client ignores field selectors, so without it the index would never be used.
+type indexedClient struct {
+	client.Client
+}
+
+func (c indexedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	lo := (&client.ListOptions{}).ApplyOptions(opts)
+	if lo.FieldSelector == nil {
+		return fmt.Errorf("hardware must be listed by the %v index", MACAddrIndex)
+	}
+	mac, ok := lo.FieldSelector.RequiresExactMatch(MACAddrIndex)
+	if !ok {
+		return fmt.Errorf("hardware must be listed by the %v index, got %v", MACAddrIndex, lo.FieldSelector)
+	}
+	hws, ok := list.(*v1alpha1.HardwareList)
+	if !ok {
+		return fmt.Errorf("unexpected list type %T", list)
+	}
+	if err := c.Client.List(ctx, hws, client.InNamespace(lo.Namespace)); err != nil {
+		return err
+	}
+	var items []v1alpha1.Hardware
+	for i := range hws.Items {
+		for _, m := range MACAddrs(&hws.Items[i]) {
+			if m == mac {
+				items = append(items, hws.Items[i])
+				break
+			}
+		}
+	}
+	hws.Items = items
+	return nil
+}
+
+func TestResolve(t *testing.T) {
+	c := newClient(t,
+		hardware("default", "allowed", true, "http://192.168.2.3/custom.ipxe", "0a:00:27:00:00:00"),
+		hardware("default", "denied", false, "", "0A-00-27-00-00-01"),
+		hardware("default", "dup1", true, "", "0a:00:27:00:00:02"),
+		hardware("other", "dup2", true, "", "0a:00:27:00:00:02"),
+	)
+	tests := map[string]struct {
+		namespace string
+		mac       string
+		want      proxy.Decision
+	}{
+		"allowed": {
+			mac:  "0a:00:27:00:00:00",
+			want: proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: Source, IPXEScriptURL: &url.URL{Scheme: "http", Host: "192.168.2.3", Path: "/custom.ipxe"}},
+		},
+		"denied":    {mac: "0a:00:27:00:00:01", want: proxy.Decision{Reason: proxy.ReasonPXEDisabled, Source: Source}},
+		"not found": {mac: "0a:00:27:00:00:03", want: proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}},
+		"duplicate": {
+			mac:  "0a:00:27:00:00:02",
+			want: proxy.Decision{Reason: "mac address found in more than one hardware interface: [default/dup1 other/dup2]", Source: Source},
+		},
+		"namespaced":           {namespace: "other", mac: "0a:00:27:00:00:02", want: proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: Source}},
+		"not in the namespace": {namespace: "other", mac: "0a:00:27:00:00:00", want: proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			k := &Kube{Client: c, Namespace: tt.namespace}
+			mac, _ := net.ParseMAC(tt.mac)
+			got, err := k.Resolve(context.Background(), mac)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.IgnoreUnexported(netaddr.IPPort{})); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestMACAddrs(t *testing.T) {
+	noDHCP := hardware("default", "hw", true, "", "0a:00:27:00:00:02")
+	noDHCP.Spec.Interfaces[0].DHCP = nil
+	tests := map[string]struct {
+		obj  client.Object
+		want []string
+	}{
+		"normalized": {
+			obj:  hardware("default", "hw", true, "", "0A-00-27-00-00-00", "not-a-mac", "0a:00:27:00:00:01"),
+			want: []string{"0a:00:27:00:00:00", "0a:00:27:00:00:01"},
+		},
+		"interface without dhcp": {obj: noDHCP},
+		"not hardware":           {obj: &v1alpha1.Template{}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(MACAddrs(tt.obj), tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
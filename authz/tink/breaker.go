@@ -0,0 +1,98 @@
+package tink
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker is not letting calls through to the Tink server.
+var ErrCircuitOpen = errors.New("tink server circuit breaker is open")
+
+// errCircuitOpen is the gRPC status error of calls failed by an open breaker.
+var errCircuitOpen = status.Error(codes.Unavailable, ErrCircuitOpen.Error())
+
+// Breaker is a circuit breaker for calls to the Tink server.
+// After Threshold consecutive failures it opens and fails calls immediately for Cooldown,
+// then lets a single call through to probe whether the Tink server has recovered.
+type Breaker struct {
+	// Threshold is the number of consecutive failures that opens the breaker.
+	Threshold int
+	// Cooldown is how long the breaker stays open before letting a probe call through.
+	Cooldown time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// NewBreaker returns a closed Breaker.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Allow returns ErrCircuitOpen if a call should not be made to the Tink server.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Threshold <= 0 || b.failures < b.Threshold {
+		return nil
+	}
+	if b.probing || b.clock().Sub(b.openedAt) < b.Cooldown {
+		return ErrCircuitOpen
+	}
+	// half open, let one call through.
+	b.probing = true
+	return nil
+}
+
+// Success records a successful call and closes the breaker. closed is true if the breaker was open.
+func (b *Breaker) Success() (closed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	closed = b.Threshold > 0 && b.failures >= b.Threshold
+	b.failures = 0
+	b.probing = false
+	return closed
+}
+
+// Failure records a failed call, opening the breaker once Threshold is reached.
+// opened is true if this call opened the breaker, a failed probe of an open breaker does not.
+func (b *Breaker) Failure() (opened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.Threshold > 0 && b.failures >= b.Threshold {
+		b.openedAt = b.clock()
+		return b.failures == b.Threshold
+	}
+	return false
+}
+
+// Release ends a call that was cancelled by its caller without recording a success or a failure,
+// the Tink server's health is unknown. A half open breaker lets the next call probe.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Open reports whether the breaker is currently failing calls.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
@@ -7,21 +7,32 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/authz"
+	"github.com/jacobweinstock/proxydhcp/proxy"
 	"github.com/pkg/errors"
 	"github.com/tinkerbell/tink/protos/hardware"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/status"
 )
 
+// Source is the name of this backend in boot decisions.
+const Source = "tink"
+
 const (
 	schemeFile  = "file"
 	schemeHTTP  = "http"
@@ -32,22 +43,44 @@ const (
 type Tinkerbell struct {
 	Client hardware.HardwareServiceClient
 	Log    logr.Logger
+	// Timeout is the deadline for a single call to the Tink server. 0 means no deadline other than the caller's.
+	Timeout time.Duration
+	// Retries is how many times a call that failed with a transient error is retried.
+	Retries int
+	// RetryBackoff is the base delay between retries. It doubles every retry and is fully jittered.
+	RetryBackoff time.Duration
+	// Breaker, when not nil, stops calls to the Tink server after consecutive failures.
+	Breaker *Breaker
 }
 
 // Allow handles communicating with Tink server to determine if a MAC address should be allowed to PXE boot or not.
 func (t Tinkerbell) Allow(ctx context.Context, mac net.HardwareAddr) bool {
-	hw, err := t.Client.ByMAC(ctx, &hardware.GetRequest{Mac: mac.String()})
+	d, err := t.Resolve(ctx, mac)
 	if err != nil {
-		fmt.Println("==========")
-		fmt.Printf("%T\n", err)
-		errStatus, _ := status.FromError(err)
-		fmt.Println(errStatus.Message())
-		fmt.Println(errStatus.Code())
-		fmt.Println("==========")
-		err = errors.Wrap(err, errStatus.Code().String())
-		t.Log.Error(err, "failed to get hardware info")
 		return false
-		// return false, fmt.Errorf("failed to get hardware info: %w", err)
+	}
+	return d.Allow
+}
+
+// Resolve handles communicating with Tink server to determine how a MAC address should PXE boot.
+func (t Tinkerbell) Resolve(ctx context.Context, mac net.HardwareAddr) (proxy.Decision, error) {
+	hw, err := t.byMAC(ctx, mac)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.NotFound:
+		t.Log.V(1).Info("hardware not found in tink server", "mac", mac.String())
+		return proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}, nil
+	case codes.Unavailable:
+		if errors.Is(err, errCircuitOpen) {
+			// the breaker logs when it opens and closes, not every call it fails.
+			t.Log.V(1).Info("tink server circuit breaker is open", "mac", mac.String())
+			return proxy.Decision{Source: Source}, err
+		}
+		t.Log.Error(err, "tink server unavailable", "mac", mac.String())
+		return proxy.Decision{Source: Source}, err
+	default:
+		t.Log.Error(err, "failed to get hardware from tink server", "mac", mac.String(), "code", status.Code(err).String())
+		return proxy.Decision{Source: Source}, err
 	}
 	for _, elem := range hw.GetNetwork().GetInterfaces() {
 		found, err := net.ParseMAC(elem.GetDhcp().GetMac())
@@ -55,17 +88,108 @@ func (t Tinkerbell) Allow(ctx context.Context, mac net.HardwareAddr) bool {
 			continue
 		}
 		if found.String() == mac.String() {
-			return elem.GetNetboot().GetAllowPxe()
+			d := authz.Decision(elem)
+			d.Source = Source
+			return d, nil
+		}
+	}
+
+	return proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source}, nil
+}
+
+// Healthy returns ErrCircuitOpen while the circuit breaker is failing calls to the Tink server.
+func (t Tinkerbell) Healthy(_ context.Context) error {
+	if t.Breaker != nil && t.Breaker.Open() {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// byMAC gets the hardware for a MAC address from the Tink server.
+// Transient errors are retried up to t.Retries times and every call goes through t.Breaker.
+// A call cancelled by ctx is not recorded by the breaker, unless it already failed and was waiting to be retried.
+func (t Tinkerbell) byMAC(ctx context.Context, mac net.HardwareAddr) (*hardware.Hardware, error) {
+	if t.Breaker != nil {
+		if err := t.Breaker.Allow(); err != nil {
+			return nil, errCircuitOpen
+		}
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		var hw *hardware.Hardware
+		hw, err = t.call(ctx, mac)
+		if err != nil && ctx.Err() != nil {
+			// the caller gave up before the Tink server answered, that says nothing about its health.
+			if t.Breaker != nil {
+				t.Breaker.Release()
+			}
+			return nil, err
 		}
+		if !transient(err) {
+			// NotFound and other non transient errors mean the Tink server is up.
+			if t.Breaker != nil && t.Breaker.Success() {
+				t.Log.Info("tink server recovered, circuit breaker closed")
+			}
+			return hw, err
+		}
+		if attempt >= t.Retries || ctx.Err() != nil {
+			break
+		}
+		delay := jitter(t.RetryBackoff, attempt)
+		t.Log.V(1).Info("retrying call to tink server", "mac", mac.String(), "attempt", attempt+1, "delay", delay.String(), "error", err.Error())
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+			continue
+		}
+		// the call failed, it must be recorded so a half open breaker can probe again.
+		break
+	}
+	if t.Breaker != nil && t.Breaker.Failure() {
+		t.Log.Error(err, "tink server circuit breaker opened, calls are stopped", "cooldown", t.Breaker.Cooldown.String())
+	}
+	return nil, err
+}
+
+// call does a single ByMAC call, bounded by t.Timeout.
+func (t Tinkerbell) call(ctx context.Context, mac net.HardwareAddr) (*hardware.Hardware, error) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
 	}
+	return t.Client.ByMAC(ctx, &hardware.GetRequest{Mac: mac.String()})
+}
 
+// transient reports whether a gRPC error is worth retrying.
+func transient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
 	return false
 }
 
-// SetupClient is a small control loop to create a tink server client.
-// it keeps trying so that if the problem is temporary or can be resolved and the
-// this doesn't stop and need to be restarted by an outside process or person.
-func SetupClient(ctx context.Context, log logr.Logger, tlsVal string, tink string) (*grpc.ClientConn, error) {
+// jitter returns a random delay in [0, base*2^attempt).
+func jitter(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	ceiling := base << uint(attempt)
+	if ceiling <= 0 {
+		ceiling = base
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) //nolint:gosec // jitter does not need a secure random number.
+}
+
+// SetupClient creates a tink server client.
+// The connection is established in the background and re-established with backoff if it drops.
+// keepaliveTime is how often the connection is pinged while calls are in flight, 0 disables keepalive pings.
+// A gRPC server's default enforcement policy closes connections pinged more often than every 5 minutes, or without calls in flight.
+func SetupClient(ctx context.Context, log logr.Logger, tlsVal string, tink string, keepaliveTime time.Duration) (*grpc.ClientConn, error) {
 	if tink == "" {
 		return nil, errors.New("tink server address is required")
 	}
@@ -76,7 +200,19 @@ func SetupClient(ctx context.Context, log logr.Logger, tlsVal string, tink strin
 		return nil, err
 	}
 
-	grpcClient, err := grpc.DialContext(ctx, tink, dialOpt)
+	opts := []grpc.DialOption{dialOpt, grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()), grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: time.Second, Multiplier: 1.6, Jitter: 0.2, MaxDelay: 30 * time.Second},
+		MinConnectTimeout: 5 * time.Second,
+	})}
+	if keepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                keepaliveTime,
+			Timeout:             keepaliveTime / 3,
+			PermitWithoutStream: false,
+		}))
+	}
+
+	grpcClient, err := grpc.DialContext(ctx, tink, opts...)
 	if err != nil {
 		log.Error(err, "error connecting to tink server")
 		return nil, err
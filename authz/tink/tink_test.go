@@ -0,0 +1,264 @@
+package tink
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/tinkerbell/tink/protos/hardware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"inet.af/netaddr"
+)
+
+// fakeHardware returns errs in order, then hw.
+type fakeHardware struct {
+	hardware.HardwareServiceClient
+	errs  []error
+	hw    *hardware.Hardware
+	calls int
+}
+
+func (f *fakeHardware) ByMAC(context.Context, *hardware.GetRequest, ...grpc.CallOption) (*hardware.Hardware, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return nil, f.errs[f.calls-1]
+	}
+	return f.hw, nil
+}
+
+var testMAC = net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+
+func testHardware() *hardware.Hardware {
+	return &hardware.Hardware{Network: &hardware.Hardware_Network{Interfaces: []*hardware.Hardware_Network_Interface{
+		{
+			Dhcp:    &hardware.Hardware_DHCP{Mac: testMAC.String()},
+			Netboot: &hardware.Hardware_Netboot{AllowPxe: true},
+		},
+	}}}
+}
+
+func TestResolve(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	tests := []struct {
+		name      string
+		errs      []error
+		retries   int
+		want      proxy.Decision
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		{
+			name:      "allowed",
+			want:      proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: Source},
+			wantCalls: 1,
+		},
+		{
+			name:      "not found",
+			errs:      []error{status.Error(codes.NotFound, "not found")},
+			want:      proxy.Decision{Reason: proxy.ReasonNotFound, Source: Source},
+			wantCalls: 1,
+		},
+		{
+			name:      "transient error retried",
+			errs:      []error{unavailable, status.Error(codes.DeadlineExceeded, "timeout")},
+			retries:   2,
+			want:      proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: Source},
+			wantCalls: 3,
+		},
+		{
+			name:      "retries exhausted",
+			errs:      []error{unavailable, unavailable, unavailable},
+			retries:   2,
+			want:      proxy.Decision{Source: Source},
+			wantCode:  codes.Unavailable,
+			wantCalls: 3,
+		},
+		{
+			name:      "permanent error not retried",
+			errs:      []error{status.Error(codes.PermissionDenied, "denied")},
+			retries:   2,
+			want:      proxy.Decision{Source: Source},
+			wantCode:  codes.PermissionDenied,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeHardware{errs: tt.errs, hw: testHardware()}
+			tb := Tinkerbell{Client: f, Log: logr.Discard(), Retries: tt.retries, RetryBackoff: time.Millisecond}
+			got, err := tb.Resolve(context.Background(), testMAC)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Resolve() error = %v, want code %v", err, tt.wantCode)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.IgnoreUnexported(netaddr.IPPort{})); diff != "" {
+				t.Fatal(diff)
+			}
+			if f.calls != tt.wantCalls {
+				t.Fatalf("calls: got %v, want %v", f.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestResolveTimeout(t *testing.T) {
+	tb := Tinkerbell{Client: blockingHardware{}, Log: logr.Discard(), Timeout: 10 * time.Millisecond}
+	_, err := tb.Resolve(context.Background(), testMAC)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Resolve() error = %v, want code %v", err, codes.DeadlineExceeded)
+	}
+}
+
+// blockingHardware blocks until the context is done.
+type blockingHardware struct {
+	hardware.HardwareServiceClient
+}
+
+func (blockingHardware) ByMAC(ctx context.Context, _ *hardware.GetRequest, _ ...grpc.CallOption) (*hardware.Hardware, error) {
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+	f := &fakeHardware{errs: []error{
+		status.Error(codes.Unavailable, "down"),
+		status.Error(codes.Unavailable, "down"),
+		status.Error(codes.Unavailable, "down"),
+	}, hw: testHardware()}
+	tb := Tinkerbell{Client: f, Log: logr.Discard(), Breaker: b}
+
+	for i := 0; i < 2; i++ {
+		if _, err := tb.Resolve(context.Background(), testMAC); status.Code(err) != codes.Unavailable {
+			t.Fatalf("Resolve() error = %v, want code %v", err, codes.Unavailable)
+		}
+	}
+	if !b.Open() {
+		t.Fatal("expected breaker to be open")
+	}
+	// an open breaker does not call the tink server.
+	if _, err := tb.Resolve(context.Background(), testMAC); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Resolve() error = %v, want code %v", err, codes.Unavailable)
+	}
+	if f.calls != 2 {
+		t.Fatalf("calls: got %v, want 2", f.calls)
+	}
+
+	// after the cooldown a failed probe opens the breaker again.
+	now = now.Add(time.Minute)
+	if _, err := tb.Resolve(context.Background(), testMAC); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Resolve() error = %v, want code %v", err, codes.Unavailable)
+	}
+	if f.calls != 3 || !b.Open() {
+		t.Fatalf("calls: got %v, want 3; open: %v", f.calls, b.Open())
+	}
+
+	// a successful probe closes it.
+	now = now.Add(time.Minute)
+	d, err := tb.Resolve(context.Background(), testMAC)
+	if err != nil || !d.Allow {
+		t.Fatalf("Resolve() = %+v, %v", d, err)
+	}
+	if b.Open() {
+		t.Fatal("expected breaker to be closed")
+	}
+}
+
+func TestBreakerProbeCancelled(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.Failure()
+
+	// the probe is cancelled while waiting to retry.
+	now = now.Add(time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	f := &fakeHardware{errs: []error{status.Error(codes.Unavailable, "down")}, hw: testHardware()}
+	tb := Tinkerbell{Client: f, Log: logr.Discard(), Breaker: b, Retries: 3, RetryBackoff: time.Hour}
+	if _, err := tb.Resolve(ctx, testMAC); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Resolve() error = %v, want code %v", err, codes.DeadlineExceeded)
+	}
+	if f.calls != 1 || !b.Open() {
+		t.Fatalf("calls: got %v, want 1; open: %v", f.calls, b.Open())
+	}
+
+	// the breaker must let the next probe through after the cooldown.
+	now = now.Add(time.Minute)
+	d, err := tb.Resolve(context.Background(), testMAC)
+	if err != nil || !d.Allow {
+		t.Fatalf("Resolve() = %+v, %v", d, err)
+	}
+	if b.Open() {
+		t.Fatal("expected breaker to be closed")
+	}
+}
+
+func TestBreakerCallCancelled(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.Failure()
+
+	// the half open probe is cancelled by its caller before the tink server answers.
+	now = now.Add(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	tb := Tinkerbell{Client: blockingHardware{}, Log: logr.Discard(), Breaker: b}
+	if _, err := tb.Resolve(ctx, testMAC); status.Code(err) != codes.Canceled {
+		t.Fatalf("Resolve() error = %v, want code %v", err, codes.Canceled)
+	}
+	if !b.Open() {
+		t.Fatal("expected a cancelled probe to not close the breaker")
+	}
+
+	// the next call probes without waiting for another cooldown.
+	f := &fakeHardware{hw: testHardware()}
+	tb.Client = f
+	d, err := tb.Resolve(context.Background(), testMAC)
+	if err != nil || !d.Allow || f.calls != 1 {
+		t.Fatalf("Resolve() = %+v, %v; calls %v", d, err, f.calls)
+	}
+	if b.Open() {
+		t.Fatal("expected breaker to be closed")
+	}
+
+	// a cancelled call is not a failure of a closed breaker either.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	tb.Client = blockingHardware{}
+	if _, err := tb.Resolve(ctx, testMAC); status.Code(err) != codes.Canceled {
+		t.Fatalf("Resolve() error = %v, want code %v", err, codes.Canceled)
+	}
+	if b.Open() {
+		t.Fatal("expected a cancelled call to not open the breaker")
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	b := NewBreaker(2, time.Minute)
+	if b.Failure() {
+		t.Fatal("first failure: opened = true, want false")
+	}
+	if !b.Failure() {
+		t.Fatal("second failure: opened = false, want true")
+	}
+	// a failed probe keeps the breaker open, it was not opened again.
+	if b.Failure() {
+		t.Fatal("failed probe: opened = true, want false")
+	}
+	if !b.Success() {
+		t.Fatal("successful probe: closed = false, want true")
+	}
+	if b.Success() {
+		t.Fatal("success of a closed breaker: closed = true, want false")
+	}
+}
@@ -0,0 +1,257 @@
+// Package webhook is an authorization backend that asks an HTTP endpoint how a machine should PXE boot.
+//
+// For every PXE request a Request is POSTed as JSON to the URL. The endpoint responds with
+// a 200 status code and a JSON Response. Any other status code is a backend error.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"inet.af/netaddr"
+)
+
+// Source is the name of this backend in boot decisions.
+const Source = "webhook"
+
+// maxResponseSize is the largest response body that is read.
+const maxResponseSize = 1 << 20
+
+// Webhook is the struct for communicating with the webhook endpoint.
+type Webhook struct {
+	// URL is the endpoint requests are POSTed to.
+	URL string
+	// Client is the HTTP client to use. See NewHTTPClient for timeouts and TLS.
+	Client *http.Client
+	// Token, when set, is sent as a bearer token in the Authorization header.
+	Token string
+	Log   logr.Logger
+}
+
+// Request is the JSON body POSTed to the webhook.
+type Request struct {
+	MAC string `json:"mac"`
+	// Arch is the IANA processor architecture type number (DHCP option 93).
+	Arch uint16 `json:"arch"`
+	// ArchName is the name of the processor architecture, i.e. "EFI x86-64".
+	ArchName    string `json:"archName"`
+	UserClass   string `json:"userClass,omitempty"`
+	VendorClass string `json:"vendorClass,omitempty"`
+	GUID        string `json:"guid,omitempty"`
+	MessageType string `json:"messageType,omitempty"`
+	Relay       *Relay `json:"relay,omitempty"`
+	Interface   string `json:"interface,omitempty"`
+	ListenAddr  string `json:"listenAddr,omitempty"`
+	Peer        string `json:"peer,omitempty"`
+}
+
+// Relay is the relay agent information of a relayed request. Binary sub-options are hex encoded.
+type Relay struct {
+	GatewayAddr   string `json:"gatewayAddr,omitempty"`
+	CircuitID     string `json:"circuitID,omitempty"`
+	RemoteID      string `json:"remoteID,omitempty"`
+	LinkSelection string `json:"linkSelection,omitempty"`
+	SubscriberID  string `json:"subscriberID,omitempty"`
+}
+
+// Response is the JSON body the webhook responds with. Only Allow is required.
+type Response struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+	// Bootfile is the iPXE binary to serve instead of the one mapped to the machine's architecture.
+	Bootfile string `json:"bootfile,omitempty"`
+	// IPXEScriptURL is the full URL of the iPXE script to serve.
+	IPXEScriptURL string `json:"ipxeScriptURL,omitempty"`
+	// TFTPAddr is the ip:port of the TFTP server to use.
+	TFTPAddr string `json:"tftpAddr,omitempty"`
+	// HTTPAddr is the ip:port of the HTTP server to use.
+	HTTPAddr string `json:"httpAddr,omitempty"`
+	// IPXEAddr is the URL from which iPXE binaries and scripts are served.
+	IPXEAddr string `json:"ipxeAddr,omitempty"`
+	// NextServer is the IP for the siaddr DHCP header.
+	NextServer string `json:"nextServer,omitempty"`
+}
+
+// Allow asks the webhook if a mac address is allowed to PXE boot.
+func (w *Webhook) Allow(ctx context.Context, mac net.HardwareAddr) bool {
+	d, err := w.Resolve(ctx, mac)
+	if err != nil {
+		w.Log.Error(err, "webhook request failed", "mac", mac.String())
+		return false
+	}
+	return d.Allow
+}
+
+// Resolve asks the webhook how a mac address should PXE boot.
+func (w *Webhook) Resolve(ctx context.Context, mac net.HardwareAddr) (proxy.Decision, error) {
+	return w.ResolveClient(ctx, proxy.Client{MAC: mac})
+}
+
+// ResolveClient asks the webhook how a client should PXE boot.
+func (w *Webhook) ResolveClient(ctx context.Context, c proxy.Client) (proxy.Decision, error) {
+	body, err := json.Marshal(NewRequest(c))
+	if err != nil {
+		return proxy.Decision{Source: Source}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return proxy.Decision{Source: Source}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+	// propagate the trace of the DHCP request to the webhook server.
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return proxy.Decision{Source: Source}, err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return proxy.Decision{Source: Source}, fmt.Errorf("unexpected status code from webhook: %v", resp.Status)
+	}
+	r := Response{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&r); err != nil {
+		return proxy.Decision{Source: Source}, fmt.Errorf("unable to decode webhook response: %w", err)
+	}
+	return r.Decision()
+}
+
+// NewRequest returns the webhook Request for a client.
+func NewRequest(c proxy.Client) Request {
+	r := Request{
+		Arch:        uint16(c.Arch),
+		ArchName:    c.Arch.String(),
+		UserClass:   c.UserClass,
+		VendorClass: c.VendorClass,
+		GUID:        c.GUID,
+		MessageType: c.MessageType,
+		Interface:   c.Interface,
+		ListenAddr:  c.ListenAddr,
+		Peer:        c.Peer,
+	}
+	if c.MAC != nil {
+		r.MAC = c.MAC.String()
+	}
+	if c.Relay != nil {
+		r.Relay = &Relay{
+			CircuitID:    hex.EncodeToString(c.Relay.CircuitID),
+			RemoteID:     hex.EncodeToString(c.Relay.RemoteID),
+			SubscriberID: hex.EncodeToString(c.Relay.SubscriberID),
+		}
+		if c.Relay.GatewayAddr != nil {
+			r.Relay.GatewayAddr = c.Relay.GatewayAddr.String()
+		}
+		if c.Relay.LinkSelection != nil {
+			r.Relay.LinkSelection = c.Relay.LinkSelection.String()
+		}
+	}
+	return r
+}
+
+// Decision validates the Response and translates it into a boot decision.
+func (r Response) Decision() (proxy.Decision, error) {
+	d := proxy.Decision{Allow: r.Allow, Reason: r.Reason, Source: Source, Bootfile: r.Bootfile}
+	if d.Reason == "" {
+		d.Reason = proxy.ReasonDenied
+		if d.Allow {
+			d.Reason = proxy.ReasonAllowed
+		}
+	}
+	var err error
+	if r.IPXEScriptURL != "" {
+		if d.IPXEScriptURL, err = parseURL(r.IPXEScriptURL); err != nil {
+			return proxy.Decision{Source: Source}, fmt.Errorf("invalid ipxeScriptURL in webhook response: %w", err)
+		}
+	}
+	if r.IPXEAddr != "" {
+		if d.IPXEAddr, err = parseURL(r.IPXEAddr); err != nil {
+			return proxy.Decision{Source: Source}, fmt.Errorf("invalid ipxeAddr in webhook response: %w", err)
+		}
+	}
+	if r.TFTPAddr != "" {
+		if d.TFTPAddr, err = netaddr.ParseIPPort(r.TFTPAddr); err != nil {
+			return proxy.Decision{Source: Source}, fmt.Errorf("invalid tftpAddr in webhook response: %w", err)
+		}
+	}
+	if r.HTTPAddr != "" {
+		if d.HTTPAddr, err = netaddr.ParseIPPort(r.HTTPAddr); err != nil {
+			return proxy.Decision{Source: Source}, fmt.Errorf("invalid httpAddr in webhook response: %w", err)
+		}
+	}
+	if r.NextServer != "" {
+		if d.NextServer = net.ParseIP(r.NextServer); d.NextServer == nil {
+			return proxy.Decision{Source: Source}, fmt.Errorf("invalid nextServer in webhook response: %q", r.NextServer)
+		}
+	}
+	return d, nil
+}
+
+// parseURL parses an absolute URL.
+func parseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("not an absolute url: %q", s)
+	}
+	return u, nil
+}
+
+// NewHTTPClient returns an HTTP client for the webhook.
+// caCert is a PEM file of CA certificates used to verify the webhook server, the system pool is used when empty.
+// clientCert and clientKey are PEM files used for mutual TLS, both or neither must be set.
+func NewHTTPClient(timeout time.Duration, caCert, clientCert, clientKey string, insecureSkipVerify bool) (*http.Client, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecureSkipVerify} //nolint:gosec // InsecureSkipVerify is opt-in, for testing only.
+	if caCert != "" {
+		data, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %q", caCert)
+		}
+		cfg.RootCAs = pool
+	}
+	if clientCert != "" || clientKey != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unexpected default transport type %T", http.DefaultTransport)
+	}
+	transport := t.Clone()
+	transport.TLSClientConfig = cfg
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
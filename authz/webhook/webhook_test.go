@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"inet.af/netaddr"
+)
+
+func TestResolveClient(t *testing.T) {
+	client := proxy.Client{
+		MAC:         net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+		Arch:        iana.EFI_X86_64,
+		UserClass:   "iPXE",
+		VendorClass: "PXEClient:Arch:00007:UNDI:003016",
+		GUID:        "4c4c4544-0042-3510-8052-b7c04f4e3732",
+		MessageType: "DISCOVER",
+		Relay:       &proxy.RelayInfo{GatewayAddr: net.IP{192, 168, 1, 1}, CircuitID: []byte("eth0/1")},
+	}
+	wantReq := Request{
+		MAC:         "00:01:02:03:04:05",
+		Arch:        7,
+		ArchName:    "EFI x86-64",
+		UserClass:   "iPXE",
+		VendorClass: "PXEClient:Arch:00007:UNDI:003016",
+		GUID:        "4c4c4544-0042-3510-8052-b7c04f4e3732",
+		MessageType: "DISCOVER",
+		Relay:       &Relay{GatewayAddr: "192.168.1.1", CircuitID: "657468302f31"},
+	}
+	tests := map[string]struct {
+		status  int
+		resp    string
+		want    proxy.Decision
+		wantErr bool
+	}{
+		"allowed with overrides": {
+			status: http.StatusOK,
+			resp:   `{"allow":true,"bootfile":"snp.efi","ipxeScriptURL":"http://10.0.0.7/custom.ipxe","tftpAddr":"10.0.0.5:69","nextServer":"10.0.0.6"}`,
+			want: proxy.Decision{
+				Allow:         true,
+				Reason:        proxy.ReasonAllowed,
+				Source:        Source,
+				Bootfile:      "snp.efi",
+				IPXEScriptURL: &url.URL{Scheme: "http", Host: "10.0.0.7", Path: "/custom.ipxe"},
+				TFTPAddr:      netaddr.IPPortFrom(netaddr.IPv4(10, 0, 0, 5), 69),
+				NextServer:    net.IP{10, 0, 0, 6},
+			},
+		},
+		"denied with reason": {
+			status: http.StatusOK,
+			resp:   `{"allow":false,"reason":"rack 12 is in maintenance"}`,
+			want:   proxy.Decision{Reason: "rack 12 is in maintenance", Source: Source},
+		},
+		"server error":         {status: http.StatusInternalServerError, wantErr: true, want: proxy.Decision{Source: Source}},
+		"invalid json":         {status: http.StatusOK, resp: `{"allow":`, wantErr: true, want: proxy.Decision{Source: Source}},
+		"invalid tftp address": {status: http.StatusOK, resp: `{"allow":true,"tftpAddr":"nope"}`, wantErr: true, want: proxy.Decision{Source: Source}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %v, want POST", r.Method)
+				}
+				if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("Authorization header = %q", got)
+				}
+				got := Request{}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Error(err)
+				}
+				if diff := cmp.Diff(got, wantReq); diff != "" {
+					t.Error(diff)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.resp))
+			}))
+			defer srv.Close()
+
+			w := &Webhook{URL: srv.URL, Client: srv.Client(), Token: "secret"}
+			got, err := w.ResolveClient(context.Background(), client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.IgnoreUnexported(netaddr.IPPort{})); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+	hc, err := NewHTTPClient(50*time.Millisecond, "", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Webhook{URL: srv.URL, Client: hc}
+	if _, err := w.Resolve(context.Background(), net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+}
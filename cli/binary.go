@@ -20,6 +20,7 @@ import (
 type bin struct {
 	ffcli.Command
 	jsonOut bool
+	mapping string
 }
 
 // Option for setting optional Client values.
@@ -67,7 +68,7 @@ func SupportedBins(_ context.Context, opts ...Option) *ffcli.Command {
 	defaultCfg := &bin{
 		Command: ffcli.Command{
 			Name:       name,
-			ShortUsage: fmt.Sprintf("%v returns the mapping of supported architecture to ipxe binary name", name),
+			ShortUsage: fmt.Sprintf("%v returns the effective mapping of supported architecture to ipxe binary name", name),
 			FlagSet:    fs,
 		},
 	}
@@ -93,38 +94,50 @@ func SupportedBins(_ context.Context, opts ...Option) *ffcli.Command {
 // RegisterFlags registers the binary command flags.
 func (b *bin) RegisterFlags(fs *flag.FlagSet) {
 	fs.BoolVar(&b.jsonOut, "json", false, "output in json format")
+	fs.StringVar(&b.mapping, "bootfile-mapping", "", "A YAML or JSON file of architecture to iPXE binary mappings that are merged over the defaults (optional).")
 }
 
 // Execute function for this command.
 func (b *bin) Execute(_ context.Context, _ []string) error {
+	bf, err := loadBootfiles(b.mapping)
+	if err != nil {
+		return err
+	}
 	if b.jsonOut {
-		jsonOut(os.Stdout)
+		jsonOut(os.Stdout, bf)
 	} else {
-		table(os.Stdout)
+		table(os.Stdout, bf)
 	}
 
 	return nil
 }
 
-func jsonOut(w io.Writer) {
+// sortedArchs returns the architectures in a BootfileMap in ascending order.
+func sortedArchs(bf proxy.BootfileMap) []iana.Arch {
+	archs := make([]iana.Arch, 0, len(bf))
+	for arch := range bf {
+		archs = append(archs, arch)
+	}
+	sort.Slice(archs, func(i, j int) bool { return archs[i] < archs[j] })
+	return archs
+}
+
+func jsonOut(w io.Writer, bf proxy.BootfileMap) {
 	type spec struct {
-		ID     int    `json:"id"`
-		Arch   string `json:"arch"`
-		Binary string `json:"binary"`
+		ID         int    `json:"id"`
+		Arch       string `json:"arch"`
+		Binary     string `json:"binary"`
+		PXEClient  string `json:"pxeClient,omitempty"`
+		HTTPClient string `json:"httpClient,omitempty"`
 	}
 	output := make([]spec, 0)
-	for arch, ipxe := range proxy.ArchToBootFile {
+	for _, arch := range sortedArchs(bf) {
 		output = append(output, spec{
-			ID:     int(arch),
-			Arch:   arch.String(),
-			Binary: ipxe,
-		})
-	}
-	for arch, ipxe := range proxy.ArchToBootFile {
-		output = append(output, spec{
-			ID:     int(arch),
-			Arch:   arch.String(),
-			Binary: ipxe,
+			ID:         int(arch),
+			Arch:       arch.String(),
+			Binary:     bf[arch].Default,
+			PXEClient:  bf[arch].PXEClient,
+			HTTPClient: bf[arch].HTTPClient,
 		})
 	}
 	out, err := json.Marshal(output)
@@ -134,18 +147,12 @@ func jsonOut(w io.Writer) {
 	fmt.Fprintln(w, string(out))
 }
 
-func table(w io.Writer) {
+func table(w io.Writer, bf proxy.BootfileMap) {
 	table := tablewriter.NewWriter(w)
-	table.SetHeader([]string{"ID", "Arch", "Binary"})
+	table.SetHeader([]string{"ID", "Arch", "Binary", "PXEClient", "HTTPClient"})
 
-	var unsortedDefaults []int
-	for arch := range proxy.ArchToBootFile {
-		unsortedDefaults = append(unsortedDefaults, int(arch))
-	}
-	sort.Ints(unsortedDefaults)
-	for _, elem := range unsortedDefaults {
-		ipxe := proxy.ArchToBootFile[iana.Arch(elem)]
-		table.Append([]string{strconv.Itoa(elem), iana.Arch(elem).String(), ipxe})
+	for _, arch := range sortedArchs(bf) {
+		table.Append([]string{strconv.Itoa(int(arch)), arch.String(), bf[arch].Default, bf[arch].PXEClient, bf[arch].HTTPClient})
 	}
 
 	table.Render()
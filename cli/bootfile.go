@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"io/ioutil"
+
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/pkg/errors"
+)
+
+// handlerConfig is the configuration of how the Handler boots clients that the run and inspect commands share.
+type handlerConfig struct {
+	ipxeScript string
+	userClass  string
+	// mapping, bootMenu, relayRules and subnets are files, empty when not set.
+	mapping    string
+	bootMenu   string
+	relayRules string
+	subnets    string
+}
+
+// options loads the files of the configuration and returns the Handler options it sets, and the bootfile mapping.
+func (h handlerConfig) options() ([]proxy.Option, proxy.BootfileMap, error) {
+	bf, err := loadBootfiles(h.mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		menu    *proxy.BootMenu
+		rules   proxy.RelayRules
+		subnets proxy.Subnets
+	)
+	if err := loadFile(h.bootMenu, "boot menu", func(data []byte) (err error) {
+		menu, err = proxy.ParseBootMenu(data)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	if err := loadFile(h.relayRules, "relay rules", func(data []byte) (err error) {
+		rules, err = proxy.ParseRelayRules(data)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+	if err := loadFile(h.subnets, "subnets", func(data []byte) (err error) {
+		subnets, err = proxy.ParseSubnets(data)
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	return []proxy.Option{
+		proxy.WithIPXEScript(h.ipxeScript),
+		proxy.WithUserClass(h.userClass),
+		proxy.WithBootfiles(bf),
+		proxy.WithBootMenu(menu),
+		proxy.WithRelayRules(rules),
+		proxy.WithSubnets(subnets),
+	}, bf, nil
+}
+
+// loadBootfiles returns the default architecture to iPXE binary mapping with the mappings
+// from filename merged over it. An empty filename returns the defaults.
+func loadBootfiles(filename string) (proxy.BootfileMap, error) {
+	bf := proxy.DefaultBootfiles()
+	err := loadFile(filename, "bootfile mapping", func(data []byte) error {
+		custom, err := proxy.ParseBootfileMap(data)
+		if err != nil {
+			return err
+		}
+		bf = bf.Merge(custom)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bf, nil
+}
+
+// loadFile reads filename and passes its contents to parse. what names the file in errors, i.e. "boot menu".
+// An empty filename is not read, parse is not called.
+func loadFile(filename, what string, parse func(data []byte) error) error {
+	if filename == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Wrapf(err, "could not read file %q", filename)
+	}
+	if err := parse(data); err != nil {
+		return errors.Wrapf(err, "unable to parse %v file %q", what, filename)
+	}
+
+	return nil
+}
@@ -3,16 +3,28 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"reflect"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/go-playground/validator/v10"
 	"github.com/hashicorp/go-multierror"
+	"github.com/jacobweinstock/proxydhcp/admin"
+	"github.com/jacobweinstock/proxydhcp/audit"
+	"github.com/jacobweinstock/proxydhcp/authz"
+	"github.com/jacobweinstock/proxydhcp/authz/cache"
+	"github.com/jacobweinstock/proxydhcp/metrics"
 	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/jacobweinstock/proxydhcp/tracing"
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"golang.org/x/sync/errgroup"
 	"inet.af/netaddr"
@@ -28,9 +40,27 @@ type Config struct {
 	IPXEAddr        string `vname:"-remote-ipxe" validate:"required,url"`
 	IPXEScript      string `vname:"-ipxe-script" validate:"required"`
 	ProxyAddr       string `vname:"-proxy-addr" validate:"required,ip"`
+	Listeners       []ListenerCfg
+	ProxyAddr6      string `vname:"-proxy6-addr" validate:"omitempty,ipv6"`
+	TFTPAddr6       string `vname:"-remote-tftp6" validate:"omitempty,hostname_port"`
+	HTTPAddr6       string `vname:"-remote-http6" validate:"omitempty,hostname_port"`
+	IPXEAddr6       string `vname:"-remote-ipxe6" validate:"omitempty,url"`
+	BootfileParams  string
+	BootfileMapping string
+	BootMenu        string
+	RelayRules      string
+	Subnets         string
 	CustomUserClass string
-	Log             logr.Logger
-	Authz           proxy.Allower
+	ErrorPolicy     string `vname:"-backend-error-policy" validate:"oneof=deny allow ignore"`
+	MetricsAddr     string `vname:"-metrics-addr" validate:"omitempty,hostname_port"`
+	AdminAddr       string `vname:"-admin-addr" validate:"omitempty,hostname_port"`
+	AdminHistory    int    `vname:"-admin-history" validate:"gte=0"`
+	Cache           CacheCfg
+	Tracing         TracingCfg
+	Sessions        SessionCfg
+	Audit           AuditCfg
+	Log             logr.Logger   `json:"-"`
+	Authz           proxy.Allower `json:"-"`
 }
 
 // ProxyDHCP returns the CLI command and Config struct for the proxydhcp command.
@@ -49,7 +79,7 @@ func ProxyDHCP(_ context.Context) (*ffcli.Command, *Config) {
 		ShortUsage:  fmt.Sprintf("%v runs the proxyDHCP server", appName),
 		FlagSet:     fs,
 		Exec:        cfg.exec,
-		Subcommands: []*ffcli.Command{File(), Tink()},
+		Subcommands: []*ffcli.Command{File(), Tink(), Kube(), Webhook()},
 	}, cfg
 }
 
@@ -57,11 +87,88 @@ func ProxyDHCP(_ context.Context) (*ffcli.Command, *Config) {
 func RegisterFlags(c *Config, fs *flag.FlagSet) {
 	fs.StringVar(&c.LogLevel, "loglevel", "info", "log level (optional)")
 	fs.StringVar(&c.ProxyAddr, "proxy-addr", "0.0.0.0", "IP associated to the network interface to listen on for proxydhcp requests.")
+	fs.Var(listenFlag{&c.Listeners}, "listen", "IP or network interface name to listen on for proxydhcp requests, optionally with its own remote servers: eth1,remote-tftp=10.1.0.5:69,remote-http=10.1.0.5:80,remote-ipxe=http://10.1.0.5 (optional, repeat for more listeners, overrides -proxy-addr).")
 	fs.StringVar(&c.TFTPAddr, "remote-tftp", "", "IP and URI of the TFTP server providing iPXE binaries (192.168.2.5:69).")
 	fs.StringVar(&c.HTTPAddr, "remote-http", "", "IP, port, and URI of the HTTP server providing iPXE binaries (i.e. 192.168.2.4:80).")
 	fs.StringVar(&c.IPXEAddr, "remote-ipxe", "", "A url where an iPXE script is served (i.e. http://192.168.2.3:8080).")
 	fs.StringVar(&c.IPXEScript, "remote-ipxe-script", "auto.ipxe", "The name of the iPXE script to use. used with remote-ipxe (http://192.168.2.3/<mac-addr>/auto.ipxe)")
 	fs.StringVar(&c.CustomUserClass, "user-class", "", "A custom user-class (dhcp option 77) to use to determine when to pivot to serving the ipxe script from the ipxe-url flag.")
+	fs.StringVar(&c.ProxyAddr6, "proxy6-addr", "", "IPv6 address associated to the network interface to listen on for proxydhcpv6 requests (optional, disabled when empty).")
+	fs.StringVar(&c.TFTPAddr6, "remote-tftp6", "", "IPv6 and port of the TFTP server providing iPXE binaries to DHCPv6 clients (i.e. [2001:db8::5]:69). Defaults to -remote-tftp.")
+	fs.StringVar(&c.HTTPAddr6, "remote-http6", "", "IPv6 and port of the HTTP server providing iPXE binaries to DHCPv6 clients (i.e. [2001:db8::4]:80). Defaults to -remote-http.")
+	fs.StringVar(&c.IPXEAddr6, "remote-ipxe6", "", "A url where an iPXE script is served to DHCPv6 clients (i.e. http://[2001:db8::3]:8080). Defaults to -remote-ipxe.")
+	fs.StringVar(&c.BootfileMapping, "bootfile-mapping", "", "A YAML or JSON file of architecture to iPXE binary mappings that are merged over the defaults (optional). See the binary command.")
+	fs.StringVar(&c.BootMenu, "boot-menu", "", "A YAML or JSON file with a PXE boot menu to offer legacy BIOS clients instead of a bootfile (optional). Boot server REQUESTs for the chosen item are answered on port 4011.")
+	fs.StringVar(&c.RelayRules, "relay-rules", "", "A YAML or JSON file of rules that match relayed requests on their relay agent information (option 82, giaddr) to deny booting or choose boot servers per rack or switch port (optional).")
+	fs.StringVar(&c.Subnets, "subnets", "", "A YAML or JSON file of the TFTP, HTTP and iPXE servers per subnet of the giaddr or receiving interface, so clients boot from the nearest artifact server (optional).")
+	fs.StringVar(&c.ErrorPolicy, "backend-error-policy", string(proxy.PolicyDeny), "What to do when the authorization backend fails to make a decision: deny, allow or ignore (don't reply).")
+	fs.DurationVar(&c.Cache.TTL, "cache-ttl", 0, "how long to cache allowed decisions from the authorization backend (optional, 0 disables caching)")
+	fs.DurationVar(&c.Cache.NegativeTTL, "cache-negative-ttl", 0, "how long to cache not allowed decisions from the authorization backend (optional, 0 disables caching)")
+	fs.DurationVar(&c.Cache.StaleTTL, "cache-stale-ttl", 0, "how long after expiring a cached decision is still used when the authorization backend fails, stale-if-error (optional)")
+	fs.IntVar(&c.Cache.MaxSize, "cache-size", 10000, "maximum number of cached decisions, least recently used decisions are evicted (0 is unlimited)")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "IP and port to serve Prometheus metrics on at /metrics (i.e. 0.0.0.0:9090) (optional, disabled when empty).")
+	fs.StringVar(&c.AdminAddr, "admin-addr", "", "IP and port to serve the admin API on (i.e. 127.0.0.1:9091) (optional, disabled when empty). The API has no authentication.")
+	fs.IntVar(&c.AdminHistory, "admin-history", admin.DefaultHistory, "number of recent requests kept for the admin API")
+	fs.StringVar(&c.Tracing.Endpoint, "otel-endpoint", "", "host:port of an OTLP gRPC collector to export traces to (optional, disabled when empty).")
+	fs.BoolVar(&c.Tracing.Insecure, "otel-insecure", false, "don't use TLS to connect to the OTLP collector")
+	fs.Float64Var(&c.Tracing.SampleRatio, "otel-sample-ratio", 1, "fraction of traces to record, between 0 and 1")
+	fs.IntVar(&c.Sessions.LoopThreshold, "loop-threshold", 3, "number of times a machine can be sent an iPXE binary within -loop-window before a boot loop is logged (0 disables)")
+	fs.DurationVar(&c.Sessions.LoopWindow, "loop-window", 5*time.Minute, "time window for boot loop detection")
+	fs.DurationVar(&c.Sessions.StallTimeout, "stall-timeout", 2*time.Minute, "how long a machine can go without a packet before it was sent the iPXE script before its boot is logged as stalled (0 disables)")
+	fs.StringVar(&c.Audit.File, "audit-file", "", "path of a file to write an audit record, as a line of JSON, of every boot decision to (optional, disabled when empty)")
+	fs.IntVar(&c.Audit.MaxSize, "audit-max-size", audit.DefaultMaxSize>>20, "size in megabytes the audit file is rotated at (0 disables rotation)")
+	fs.IntVar(&c.Audit.MaxBackups, "audit-max-backups", audit.DefaultMaxBackups, "number of rotated audit files to keep")
+	fs.StringVar(&c.Audit.Syslog, "audit-syslog", "", `syslog server to send audit records to: "local" or a URL, i.e. udp://192.168.2.10:514 (optional, disabled when empty)`)
+	fs.StringVar(&c.BootfileParams, "bootfile-params6", "", "Comma separated boot file parameters (dhcpv6 option 60) to send to DHCPv6 clients (optional).")
+}
+
+// CacheCfg is the configuration for caching authorization backend decisions.
+type CacheCfg struct {
+	TTL         time.Duration `vname:"-cache-ttl" validate:"gte=0"`
+	NegativeTTL time.Duration `vname:"-cache-negative-ttl" validate:"gte=0"`
+	StaleTTL    time.Duration `vname:"-cache-stale-ttl" validate:"gte=0"`
+	MaxSize     int           `vname:"-cache-size" validate:"gte=0"`
+}
+
+// TracingCfg is the configuration for exporting OpenTelemetry traces.
+type TracingCfg struct {
+	Endpoint    string  `vname:"-otel-endpoint" validate:"omitempty,hostname_port"`
+	Insecure    bool    `vname:"-otel-insecure"`
+	SampleRatio float64 `vname:"-otel-sample-ratio" validate:"gte=0,lte=1"`
+}
+
+// SessionCfg is the configuration for boot session tracking.
+type SessionCfg struct {
+	LoopThreshold int           `vname:"-loop-threshold" validate:"gte=0"`
+	LoopWindow    time.Duration `vname:"-loop-window" validate:"gte=0"`
+	StallTimeout  time.Duration `vname:"-stall-timeout" validate:"gte=0"`
+}
+
+// AuditCfg is the configuration for the audit log.
+type AuditCfg struct {
+	File       string `vname:"-audit-file"`
+	MaxSize    int    `vname:"-audit-max-size" validate:"gte=0"`
+	MaxBackups int    `vname:"-audit-max-backups" validate:"gte=0"`
+	Syslog     string `vname:"-audit-syslog"`
+}
+
+// server is a DHCPv4 or DHCPv6 listener.
+type server interface {
+	Serve() error
+	Close() error
+}
+
+// httpServer is an HTTP listener that satisfies the server interface.
+type httpServer struct {
+	*http.Server
+}
+
+// Serve listens and serves until the server is closed.
+func (s httpServer) Serve() error {
+	if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 // validateConfig validates the config struct based on its struct tags.
@@ -110,38 +217,151 @@ func (c *Config) run(ctx context.Context, _ []string) error {
 	if err != nil {
 		return err
 	}
-	opts := []proxy.Option{
-		proxy.WithLogger(c.Log),
-		proxy.WithAllower(c.Authz),
-		proxy.WithIPXEScript(c.IPXEScript),
-		proxy.WithUserClass(c.CustomUserClass),
-	}
-	h := proxy.NewHandler(ctx, ta, ha, ia, opts...)
-
-	u, err := netaddr.ParseIPPort(c.ProxyAddr + ":67")
+	hopts, bf, err := handlerConfig{
+		ipxeScript: c.IPXEScript,
+		userClass:  c.CustomUserClass,
+		mapping:    c.BootfileMapping,
+		bootMenu:   c.BootMenu,
+		relayRules: c.RelayRules,
+		subnets:    c.Subnets,
+	}.options()
 	if err != nil {
 		return err
 	}
-	rs, err := proxy.Server(ctx, u, nil, h.Redirection)
+	cfgs, err := c.listeners4()
 	if err != nil {
 		return err
 	}
-
-	h2 := proxy.NewHandler(ctx, ta, ha, ia, opts...)
-	bs, err := proxy.Server(ctx, u.WithPort(4011), nil, h2.Redirection)
+	shutdown, err := tracing.Start(ctx, tracing.Config{Endpoint: c.Tracing.Endpoint, Insecure: c.Tracing.Insecure, SampleRatio: c.Tracing.SampleRatio})
 	if err != nil {
 		return err
 	}
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(sctx); err != nil {
+			c.Log.Error(err, "failed to flush traces")
+		}
+	}()
+	if c.Cache.TTL > 0 || c.Cache.NegativeTTL > 0 {
+		c.Authz = cache.New(c.Authz,
+			cache.WithTTL(c.Cache.TTL),
+			cache.WithNegativeTTL(c.Cache.NegativeTTL),
+			cache.WithStaleTTL(c.Cache.StaleTTL),
+			cache.WithMaxSize(c.Cache.MaxSize),
+			cache.WithLogger(c.Log.WithName("cache")),
+		)
+	}
+	opts := append([]proxy.Option{
+		proxy.WithLogger(c.Log),
+		proxy.WithAllower(c.Authz),
+		proxy.WithErrorPolicy(proxy.ErrorPolicy(c.ErrorPolicy)),
+	}, hopts...)
+	sessions := proxy.NewSessionTracker(
+		proxy.WithSessionLogger(c.Log.WithName("sessions")),
+		proxy.WithLoopDetection(c.Sessions.LoopThreshold, c.Sessions.LoopWindow),
+		proxy.WithStallTimeout(c.Sessions.StallTimeout),
+	)
+	opts = append(opts, proxy.WithObserver(sessions))
+	go sessions.Run(ctx)
+	if c.Audit.File != "" || c.Audit.Syslog != "" {
+		al, err := c.auditLog()
+		if err != nil {
+			return err
+		}
+		defer al.Close()
+		opts = append(opts, proxy.WithObserver(al))
+	}
+	var as server
+	if c.AdminAddr != "" {
+		rec := admin.NewRecorder(c.AdminHistory)
+		opts = append(opts, proxy.WithObserver(rec))
+		a := &admin.Server{
+			Recorder:  rec,
+			Sessions:  sessions,
+			Backend:   c.Authz,
+			Config:    c,
+			Bootfiles: bf,
+			Log:       c.Log.WithName("admin"),
+		}
+		as = httpServer{&http.Server{Addr: c.AdminAddr, Handler: a.Handler(), ReadHeaderTimeout: 10 * time.Second}}
+	}
+	var ms server
+	if c.MetricsAddr != "" {
+		reg := metrics.NewRegistry()
+		opts = append(opts, proxy.WithObserver(metrics.New(reg, c.CustomUserClass)))
+		if cc, ok := c.Authz.(*cache.Cache); ok {
+			metrics.RegisterCache(reg, cc)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(reg))
+		ms = httpServer{&http.Server{Addr: c.MetricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}}
+	}
+	var servers []server
+	closeAll := func(err error) error {
+		result := multierror.Append(nil, err)
+		for _, s := range servers {
+			result = multierror.Append(result, s.Close())
+		}
+		return result
+	}
+	var listeners []listener4
+	ifaces := map[string]string{}
+	for _, l := range cfgs {
+		li, err := c.listen4(ctx, l, ta, ha, ia, opts...)
+		if err != nil {
+			return closeAll(err)
+		}
+		for _, port := range ports4 {
+			servers = append(servers, li.servers[port])
+		}
+		// two listeners on one interface would both reply to its clients.
+		if other, ok := ifaces[li.iface]; ok {
+			return closeAll(fmt.Errorf("-listen %v and %v are both on interface %v", other, l.Addr, li.iface))
+		}
+		ifaces[li.iface] = l.Addr
+		listeners = append(listeners, li)
+	}
+	go c.reloadOnSIGHUP(ctx)
 
 	g, ctx := errgroup.WithContext(ctx)
-	g.Go(func() error {
-		h.Log.Info("starting proxydhcp", "addr1", c.ProxyAddr, "addr2", "0.0.0.0:67")
-		return rs.Serve()
-	})
-	g.Go(func() error {
-		h.Log.Info("starting proxydhcp", "addr1", c.ProxyAddr, "addr2", "0.0.0.0:4011")
-		return bs.Serve()
-	})
+	for _, li := range listeners {
+		li := li
+		for _, port := range ports4 {
+			port, s := port, li.servers[port]
+			g.Go(func() error {
+				li.log.Info("starting proxydhcp", "addr1", li.addr, "addr2", fmt.Sprintf("0.0.0.0:%d", port))
+				return s.Serve()
+			})
+		}
+	}
+
+	if as != nil {
+		servers = append(servers, as)
+		g.Go(func() error {
+			c.Log.Info("starting admin API server", "addr", c.AdminAddr)
+			return as.Serve()
+		})
+	}
+	if ms != nil {
+		servers = append(servers, ms)
+		g.Go(func() error {
+			c.Log.Info("starting metrics server", "addr", c.MetricsAddr)
+			return ms.Serve()
+		})
+	}
+
+	if c.ProxyAddr6 != "" {
+		ss, err := c.server6(ctx, ta, ha, ia, opts...)
+		if err != nil {
+			return closeAll(err)
+		}
+		servers = append(servers, ss)
+		g.Go(func() error {
+			c.Log.Info("starting proxydhcpv6", "addr1", c.ProxyAddr6, "addr2", "[::]:547")
+			return ss.Serve()
+		})
+	}
 
 	errCh := make(chan error)
 	go func() {
@@ -151,7 +371,91 @@ func (c *Config) run(ctx context.Context, _ []string) error {
 	case err := <-errCh:
 		return err
 	case <-ctx.Done():
-		h.Log.Info("shutting down")
-		return multierror.Append(nil, rs.Close(), bs.Close()).ErrorOrNil()
+		c.Log.Info("shutting down")
+		var result *multierror.Error
+		for _, s := range servers {
+			result = multierror.Append(result, s.Close())
+		}
+		return result.ErrorOrNil()
+	}
+}
+
+// auditLog creates the audit log with the configured sinks.
+func (c *Config) auditLog() (*audit.Logger, error) {
+	host, _ := os.Hostname()
+	opts := []audit.Option{audit.WithLogger(c.Log.WithName("audit")), audit.WithHost(host)}
+	if c.Audit.Syslog != "" {
+		w, err := audit.DialSyslog(c.Audit.Syslog, "proxydhcp")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, audit.WithSink(w))
+	}
+	if c.Audit.File != "" {
+		f, err := audit.OpenFile(c.Audit.File, int64(c.Audit.MaxSize)<<20, c.Audit.MaxBackups)
+		if err != nil {
+			return nil, multierror.Append(err, audit.New(opts...).Close()).ErrorOrNil()
+		}
+		opts = append(opts, audit.WithSink(f))
+	}
+	return audit.New(opts...), nil
+}
+
+// server6 creates the proxyDHCPv6 listener. The DHCPv6 specific remote addresses default to their DHCPv4 counterparts.
+func (c *Config) server6(ctx context.Context, ta, ha netaddr.IPPort, ia *url.URL, opts ...proxy.Option) (server, error) {
+	var err error
+	if c.TFTPAddr6 != "" {
+		if ta, err = netaddr.ParseIPPort(c.TFTPAddr6); err != nil {
+			return nil, err
+		}
+	}
+	if c.HTTPAddr6 != "" {
+		if ha, err = netaddr.ParseIPPort(c.HTTPAddr6); err != nil {
+			return nil, err
+		}
+	}
+	if c.IPXEAddr6 != "" {
+		if ia, err = url.Parse(c.IPXEAddr6); err != nil {
+			return nil, err
+		}
+	}
+	ip, err := netaddr.ParseIP(c.ProxyAddr6)
+	if err != nil {
+		return nil, err
+	}
+	duid, err := proxy.DUIDFromIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, proxy.WithDUID(duid), proxy.WithInterface(proxy.InterfaceName(ip)))
+	if c.BootfileParams != "" {
+		opts = append(opts, proxy.WithBootfileParams(strings.Split(c.BootfileParams, ",")...))
+	}
+	h := proxy.NewHandler(ctx, ta, ha, ia, opts...)
+
+	return proxy.Server6(ctx, netaddr.IPPortFrom(ip, 547), nil, h.Redirection6)
+}
+
+// reloadOnSIGHUP reloads the authorization backend every time a SIGHUP is received, if the backend supports it.
+func (c *Config) reloadOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		r, ok := c.Authz.(authz.Reloader)
+		if !ok {
+			c.Log.Info("received SIGHUP, the authorization backend does not support reloading")
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			c.Log.Error(err, "received SIGHUP, failed to reload the authorization backend, keeping the current data")
+			continue
+		}
+		c.Log.Info("received SIGHUP, reloaded the authorization backend")
 	}
 }
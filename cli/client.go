@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/jacobweinstock/proxydhcp/client"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+)
+
+const clientCLI = "client"
+
+// pxeClient is the configuration for the client command.
+type pxeClient struct {
+	server     string
+	listen     string
+	mac        string
+	arch       int
+	clientType string
+	vendor     string
+	userClass  string
+	guid       string
+	request    bool
+	timeout    time.Duration
+	jsonOut    bool
+	out        io.Writer
+}
+
+// PXEClient returns the command that simulates PXE firmware to test a proxydhcp server.
+func PXEClient(_ context.Context) *ffcli.Command {
+	fs := flag.NewFlagSet(clientCLI, flag.ExitOnError)
+	c := &pxeClient{out: os.Stdout}
+	c.RegisterFlags(fs)
+
+	return &ffcli.Command{
+		Name:       clientCLI,
+		ShortUsage: fmt.Sprintf("%v sends a PXE DISCOVER, and a REQUEST to port 4011, to a proxydhcp server and prints the proxyDHCP replies", clientCLI),
+		FlagSet:    fs,
+		Exec:       c.Execute,
+	}
+}
+
+// RegisterFlags registers the client command flags.
+func (c *pxeClient) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.server, "server", "255.255.255.255:67", "address to send the DISCOVER to, the broadcast address or a proxydhcp server's IP and port 67 or 4011")
+	fs.StringVar(&c.listen, "listen", "", "local address to send from and receive replies on (default 0.0.0.0:68 when broadcasting, a random port otherwise)")
+	fs.StringVar(&c.mac, "mac", "", "mac address of the simulated client (default a random, locally administered mac address)")
+	fs.IntVar(&c.arch, "arch", int(iana.EFI_X86_64), "client architecture (option 93), see the binary command for the IDs")
+	fs.StringVar(&c.clientType, "client-type", client.PXEClient, "PXEClient or HTTPClient")
+	fs.StringVar(&c.vendor, "vendor-class", "", "vendor class (option 60) (default \"<client-type>:Arch:<arch>:UNDI:003016\")")
+	fs.StringVar(&c.userClass, "user-class", "", "user class (option 77), i.e. iPXE or Tinkerbell (optional)")
+	fs.StringVar(&c.guid, "guid", "", "client machine identifier (option 97) as a UUID (optional)")
+	fs.BoolVar(&c.request, "request", true, "send a REQUEST to port 4011 of the server that sent the first proxyDHCP OFFER")
+	fs.DurationVar(&c.timeout, "timeout", 5*time.Second, "how long to collect replies to the DISCOVER, and to wait for the reply to the REQUEST")
+	fs.BoolVar(&c.jsonOut, "json", false, "output in json format")
+}
+
+// Execute function for this command.
+func (c *pxeClient) Execute(ctx context.Context, _ []string) error {
+	pc, err := c.client()
+	if err != nil {
+		return err
+	}
+	to, err := net.ResolveUDPAddr("udp4", c.server)
+	if err != nil {
+		return err
+	}
+	listen := c.listen
+	if listen == "" {
+		listen = "0.0.0.0:0"
+		if to.IP.Equal(net.IPv4bcast) {
+			// replies to a broadcast DISCOVER are broadcast to the client port.
+			listen = fmt.Sprintf("0.0.0.0:%d", dhcpv4.ClientPort)
+		}
+	}
+	conn, err := net.ListenPacket("udp4", listen)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	discover, err := pc.Discover()
+	if err != nil {
+		return err
+	}
+	// DHCP servers answer the DISCOVER too, only the replies of proxyDHCP servers are of interest.
+	dctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	offers, err := client.ExchangeAll(dctx, conn, to, discover, client.ProxyReply)
+	if err != nil {
+		return errors.Wrap(err, "no proxyDHCP reply to DISCOVER")
+	}
+	var replies []client.Reply
+	for _, o := range offers {
+		replies = append(replies, client.NewReply(o.Reply, o.From))
+	}
+	// like PXE firmware, the REQUEST goes to the boot server of the first offer.
+	offer, from := offers[0].Reply, offers[0].From
+	if c.request && offer.MessageType() == dhcpv4.MessageTypeOffer {
+		request, err := pc.Request(offer)
+		if err != nil {
+			return err
+		}
+		ack, from, err := c.exchange(ctx, conn, bootServer(offer, from), request)
+		if err != nil {
+			c.print(replies)
+			return errors.Wrap(err, "no reply to REQUEST")
+		}
+		replies = append(replies, client.NewReply(ack, from))
+	}
+	c.print(replies)
+
+	return nil
+}
+
+// client returns the simulated firmware from the flags.
+func (c *pxeClient) client() (client.Client, error) {
+	pc := client.Client{
+		Arch:        iana.Arch(c.arch),
+		ClientType:  c.clientType,
+		VendorClass: c.vendor,
+		UserClass:   c.userClass,
+		GUID:        c.guid,
+	}
+	if c.clientType != client.PXEClient && c.clientType != client.HTTPClient {
+		return pc, fmt.Errorf("-client-type must be %v or %v, got %q: %w", client.PXEClient, client.HTTPClient, c.clientType, flag.ErrHelp)
+	}
+	if c.mac == "" {
+		pc.MAC = make(net.HardwareAddr, 6)
+		if _, err := rand.Read(pc.MAC); err != nil {
+			return pc, err
+		}
+		// unicast and locally administered.
+		pc.MAC[0] = pc.MAC[0]&0xfc | 0x02
+		return pc, nil
+	}
+	mac, err := net.ParseMAC(c.mac)
+	if err != nil {
+		return pc, err
+	}
+	pc.MAC = mac
+	return pc, nil
+}
+
+func (c *pxeClient) exchange(ctx context.Context, conn net.PacketConn, to net.Addr, pkt *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, net.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return client.Exchange(ctx, conn, to, pkt)
+}
+
+// bootServer returns the address PXE firmware sends its REQUEST to, port 4011 of the server identifier (option 54)
+// or of the server that sent the offer.
+func bootServer(offer *dhcpv4.DHCPv4, from net.Addr) *net.UDPAddr {
+	to := &net.UDPAddr{Port: 4011}
+	if sid := offer.ServerIdentifier(); sid != nil && !sid.IsUnspecified() {
+		to.IP = sid
+	} else if u, ok := from.(*net.UDPAddr); ok {
+		to.IP = u.IP
+	}
+	return to
+}
+
+func (c *pxeClient) print(replies []client.Reply) {
+	if c.jsonOut {
+		out, err := json.MarshalIndent(replies, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintln(c.out, string(out))
+		return
+	}
+	for _, r := range replies {
+		fmt.Fprintf(c.out, "%v from %v (xid %v)\n", r.MessageType, r.From, r.TransactionID)
+		fmt.Fprintf(c.out, "  server id:    %v\n", r.ServerID)
+		fmt.Fprintf(c.out, "  next server:  %v\n", r.NextServer)
+		fmt.Fprintf(c.out, "  server name:  %v\n", r.ServerName)
+		fmt.Fprintf(c.out, "  bootfile:     %v\n", r.Bootfile)
+		fmt.Fprintf(c.out, "  vendor class: %v\n", r.VendorClass)
+		if r.Message != "" {
+			fmt.Fprintf(c.out, "  message:      %v\n", r.Message)
+		}
+		fmt.Fprintln(c.out, "  options:")
+		names := make([]string, 0, len(r.Options))
+		for name := range r.Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(c.out, "    %v: %v\n", name, r.Options[name])
+		}
+	}
+}
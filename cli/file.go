@@ -2,19 +2,16 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"reflect"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
 	"github.com/imdario/mergo"
 	"github.com/jacobweinstock/proxydhcp/authz/file"
 	"github.com/peterbourgon/ff/v3/ffcli"
-	"github.com/pkg/errors"
-	"github.com/tinkerbell/tink/protos/hardware"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -24,6 +21,10 @@ const fileCLI = "file"
 // FileCfg is the configuration for the file backend.
 type FileCfg struct {
 	Filename string
+	// Watch reloads the file when it changes.
+	Watch bool
+	// PollInterval, when set, polls the file for changes instead of using inotify.
+	PollInterval time.Duration
 	Config
 }
 
@@ -47,6 +48,8 @@ func File() *ffcli.Command {
 func RegisterFlagsFile(cfg *FileCfg, fs *flag.FlagSet) {
 	RegisterFlags(&cfg.Config, fs)
 	fs.StringVar(&cfg.Filename, "filename", "", "filename to read data (required)")
+	fs.BoolVar(&cfg.Watch, "watch", true, "reload the file when it changes. The file is also reloaded on SIGHUP.")
+	fs.DurationVar(&cfg.PollInterval, "poll-interval", 0, "poll the file for changes at this interval instead of using inotify (optional, always polls every 5s on non Linux systems)")
 }
 
 type logger logr.Logger
@@ -104,16 +107,18 @@ func (f *FileCfg) Exec(ctx context.Context, _ []string) error {
 
 	f.Log.Info("starting proxydhcp")
 
-	saData, err := ioutil.ReadFile(f.Filename)
+	fb, err := file.NewWatcher(f.Filename, f.Log.WithName("file"))
 	if err != nil {
-		return errors.Wrapf(err, "could not read file %q", f.Filename)
+		return err
 	}
-	dsDB := []*hardware.Hardware{}
-	if err := json.Unmarshal(saData, &dsDB); err != nil {
-		return errors.Wrapf(err, "unable to parse configuration file %q", f.Filename)
+	fb.PollInterval = f.PollInterval
+	if f.Watch {
+		go func() {
+			if err := fb.Watch(ctx); err != nil {
+				fb.Log.Error(err, "stopped watching file for changes", "filename", f.Filename)
+			}
+		}()
 	}
-
-	fb := &file.File{DB: dsDB}
 	f.Config.Authz = fb
 	return f.Config.run(ctx, nil)
 }
@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/jacobweinstock/proxydhcp/authz/file"
+	"github.com/jacobweinstock/proxydhcp/client"
+	"github.com/jacobweinstock/proxydhcp/pcap"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+	"inet.af/netaddr"
+)
+
+const inspectCLI = "inspect"
+
+// packet formats of the inspect command.
+const (
+	formatAuto   = "auto"
+	formatHex    = "hex"
+	formatBase64 = "base64"
+	formatPcap   = "pcap"
+)
+
+// inspect is the configuration for the inspect command.
+type inspect struct {
+	format     string
+	listener   int
+	tftpAddr   string
+	httpAddr   string
+	ipxeAddr   string
+	ipxeScript string
+	userClass  string
+	mapping    string
+	bootMenu   string
+	relayRules string
+	subnets    string
+	file       string
+	jsonOut    bool
+	in         io.Reader
+	out        io.Writer
+}
+
+// Inspect returns the command that explains how proxydhcp handles a DHCP packet.
+func Inspect(_ context.Context) *ffcli.Command {
+	fs := flag.NewFlagSet(inspectCLI, flag.ExitOnError)
+	i := &inspect{in: os.Stdin, out: os.Stdout}
+	i.RegisterFlags(fs)
+
+	return &ffcli.Command{
+		Name:       inspectCLI,
+		ShortUsage: fmt.Sprintf("%v [flags] <packet or file> runs DHCP packets (hex, base64 or a pcap/pcapng file, default stdin) through proxydhcp offline and explains each step", inspectCLI),
+		FlagSet:    fs,
+		Exec:       i.Execute,
+	}
+}
+
+// RegisterFlags registers the inspect command flags.
+func (i *inspect) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&i.format, "format", formatAuto, "packet format: auto, hex, base64 or pcap (pcap and pcapng)")
+	fs.IntVar(&i.listener, "listener", 67, "port a hex or base64 packet is treated as received on, 67 or 4011")
+	fs.StringVar(&i.tftpAddr, "remote-tftp", "127.0.0.1:69", "IP and port of the TFTP server providing iPXE binaries (i.e. 192.168.2.5:69)")
+	fs.StringVar(&i.httpAddr, "remote-http", "127.0.0.1:80", "IP and port of the HTTP server providing iPXE binaries (i.e. 192.168.2.4:80)")
+	fs.StringVar(&i.ipxeAddr, "remote-ipxe", "http://127.0.0.1", "A url where an iPXE script is served (i.e. http://192.168.2.3:8080)")
+	fs.StringVar(&i.ipxeScript, "remote-ipxe-script", "auto.ipxe", "The name of the iPXE script to use")
+	fs.StringVar(&i.userClass, "user-class", "", "A custom user-class (dhcp option 77) that is treated as running iPXE")
+	fs.StringVar(&i.mapping, "bootfile-mapping", "", "A YAML or JSON file of architecture to iPXE binary mappings that are merged over the defaults (optional)")
+	fs.StringVar(&i.bootMenu, "boot-menu", "", "A YAML or JSON file with a PXE boot menu to offer legacy BIOS clients (optional)")
+	fs.StringVar(&i.relayRules, "relay-rules", "", "A YAML or JSON file of rules that match relayed requests on their relay agent information (optional)")
+	fs.StringVar(&i.subnets, "subnets", "", "A YAML or JSON file of the boot servers per subnet of the giaddr (optional)")
+	fs.StringVar(&i.file, "file", "", "hardware file, as used by the file backend, to make boot decisions with (optional, all machines are allowed when empty)")
+	fs.BoolVar(&i.jsonOut, "json", false, "output in json format")
+}
+
+// inspected is a packet and its Inspection.
+type inspected struct {
+	Packet int        `json:"packet"`
+	Time   *time.Time `json:"time,omitempty"`
+	Src    string     `json:"src"`
+	Dst    string     `json:"dst"`
+	proxy.Inspection
+	Reply *client.Reply `json:"reply,omitempty"`
+	// pkt is the packet inspected.
+	pkt *dhcpv4.DHCPv4
+}
+
+// Execute function for this command.
+func (i *inspect) Execute(ctx context.Context, args []string) error {
+	raw, err := i.read(args)
+	if err != nil {
+		return err
+	}
+	pkts, err := i.packets(raw)
+	if err != nil {
+		return err
+	}
+	h, err := i.handler(ctx)
+	if err != nil {
+		return err
+	}
+	out := make([]inspected, 0, len(pkts))
+	for n, p := range pkts {
+		m, err := dhcpv4.FromBytes(p.Payload)
+		if err != nil {
+			if i.format == formatPcap || pcap.IsPcap(raw) {
+				continue
+			}
+			return errors.Wrap(err, "not a DHCPv4 packet")
+		}
+		in := h.Inspect(m, p.Dst, p.Src)
+		r := inspected{Packet: n + 1, Src: p.Src.String(), Dst: p.Dst.String(), Inspection: in, pkt: m}
+		if !p.Time.IsZero() {
+			r.Time = &pkts[n].Time
+		}
+		if in.Reply != nil {
+			reply := client.NewReply(in.Reply, p.Dst)
+			r.Reply = &reply
+		}
+		out = append(out, r)
+	}
+	if len(out) == 0 {
+		return errors.New("no DHCPv4 packets to ports 67 or 4011 found")
+	}
+	i.print(out)
+
+	return nil
+}
+
+// read returns the packet or file from the first argument, or stdin when there is no argument or it is "-".
+func (i *inspect) read(args []string) ([]byte, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return io.ReadAll(i.in)
+	}
+	if b, err := os.ReadFile(args[0]); err == nil {
+		return b, nil
+	} else if i.format == formatPcap {
+		return nil, err
+	}
+	return []byte(strings.Join(args, "")), nil
+}
+
+// packets decodes raw into UDP packets. A hex or base64 packet is treated as sent from a client to the listener port.
+func (i *inspect) packets(raw []byte) ([]pcap.Packet, error) {
+	format := i.format
+	if format == formatAuto {
+		switch {
+		case pcap.IsPcap(raw):
+			format = formatPcap
+		case isHex(raw):
+			format = formatHex
+		default:
+			format = formatBase64
+		}
+	}
+	var (
+		payload []byte
+		err     error
+	)
+	switch format {
+	case formatPcap:
+		all, err := pcap.ReadUDP(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		var pkts []pcap.Packet
+		for _, p := range all {
+			if p.Dst.Port == dhcpv4.ServerPort || p.Dst.Port == 4011 {
+				pkts = append(pkts, p)
+			}
+		}
+		return pkts, nil
+	case formatHex:
+		payload, err = hex.DecodeString(stripSpace(raw, ":"))
+	case formatBase64:
+		payload, err = base64.StdEncoding.DecodeString(stripSpace(raw, ""))
+	default:
+		return nil, fmt.Errorf("-format must be one of %v, %v, %v or %v, got %q: %w", formatAuto, formatHex, formatBase64, formatPcap, i.format, flag.ErrHelp)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "decoding %v packet", format)
+	}
+	return []pcap.Packet{{
+		Src:     &net.UDPAddr{IP: net.IPv4zero, Port: dhcpv4.ClientPort},
+		Dst:     &net.UDPAddr{IP: net.IPv4zero, Port: i.listener},
+		Payload: payload,
+	}}, nil
+}
+
+// handler returns the Handler packets are inspected with.
+func (i *inspect) handler(ctx context.Context) (*proxy.Handler, error) {
+	ta, err := netaddr.ParseIPPort(i.tftpAddr)
+	if err != nil {
+		return nil, err
+	}
+	ha, err := netaddr.ParseIPPort(i.httpAddr)
+	if err != nil {
+		return nil, err
+	}
+	ia, err := url.Parse(i.ipxeAddr)
+	if err != nil {
+		return nil, err
+	}
+	hopts, _, err := handlerConfig{
+		ipxeScript: i.ipxeScript,
+		userClass:  i.userClass,
+		mapping:    i.mapping,
+		bootMenu:   i.bootMenu,
+		relayRules: i.relayRules,
+		subnets:    i.subnets,
+	}.options()
+	if err != nil {
+		return nil, err
+	}
+	var a proxy.Allower = proxy.AllowAll{}
+	if i.file != "" {
+		db, err := file.Load(i.file)
+		if err != nil {
+			return nil, err
+		}
+		if a, err = file.NewFile(db); err != nil {
+			return nil, err
+		}
+	}
+	opts := append([]proxy.Option{proxy.WithLogger(logr.Discard()), proxy.WithAllower(a)}, hopts...)
+	return proxy.NewHandler(ctx, ta, ha, ia, opts...), nil
+}
+
+func (i *inspect) print(out []inspected) {
+	if i.jsonOut {
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintln(i.out, string(b))
+		return
+	}
+	for _, r := range out {
+		fmt.Fprintf(i.out, "packet %d: %v from %v (xid %v), %v -> %v\n", r.Packet, r.pkt.MessageType(), r.pkt.ClientHWAddr, r.pkt.TransactionID, r.Src, r.Dst)
+		for _, s := range r.Steps {
+			status := "ok  "
+			if !s.OK {
+				status = "FAIL"
+			}
+			fmt.Fprintf(i.out, "  %v %-15v %v\n", status, s.Name, s.Detail)
+		}
+		if len(r.Log) > 0 {
+			fmt.Fprintln(i.out, "  log:")
+			for _, l := range r.Log {
+				fmt.Fprintf(i.out, "    %v\n", l)
+			}
+		}
+		if r.Inspection.Reply != nil {
+			fmt.Fprintln(i.out, "  reply:")
+			for _, l := range strings.Split(strings.TrimSpace(r.Inspection.Reply.Summary()), "\n") {
+				fmt.Fprintf(i.out, "    %v\n", l)
+			}
+		}
+		fmt.Fprintln(i.out)
+	}
+}
+
+// isHex returns true if b is hex encoded, ignoring white space and colons.
+func isHex(b []byte) bool {
+	s := stripSpace(b, ":")
+	if s == "" || len(s)%2 != 0 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// stripSpace returns b as a string without white space and the characters in cutset.
+func stripSpace(b []byte, cutset string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' || strings.ContainsRune(cutset, r) {
+			return -1
+		}
+		return r
+	}, string(b))
+}
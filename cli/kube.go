@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/imdario/mergo"
+	"github.com/jacobweinstock/proxydhcp/authz/kube"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"golang.org/x/sync/errgroup"
+)
+
+const kubeCLI = "kube"
+
+// KubeCfg is the configuration for the kube backend.
+type KubeCfg struct {
+	Config
+	// Kubeconfig is the path to a kubeconfig file. When empty, the default loading rules
+	// ($KUBECONFIG, ~/.kube/config) and then the in-cluster config are used.
+	Kubeconfig string
+	// KubeAPI is the URL of the Kubernetes API server, it overrides the server in the kubeconfig.
+	KubeAPI string
+	// Namespace restricts the Hardware resources that are watched. When empty, all namespaces are watched.
+	Namespace string
+}
+
+// Kube is the subcommand that uses Tinkerbell Hardware resources in Kubernetes for authorizing PXE boot requests.
+func Kube() *ffcli.Command {
+	cfg := &KubeCfg{}
+	fs := flag.NewFlagSet(kubeCLI, flag.ExitOnError)
+	RegisterFlagsKube(cfg, fs)
+
+	return &ffcli.Command{
+		Name:       kubeCLI,
+		ShortUsage: kubeCLI,
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			return cfg.Exec(ctx, nil)
+		},
+	}
+}
+
+// RegisterFlagsKube registers the flags for the kube subcommand.
+func RegisterFlagsKube(cfg *KubeCfg, fs *flag.FlagSet) {
+	RegisterFlags(&cfg.Config, fs)
+	fs.StringVar(&cfg.Kubeconfig, "kubeconfig", "", "path to a kubeconfig file (optional, defaults to $KUBECONFIG, ~/.kube/config and then the in-cluster config)")
+	fs.StringVar(&cfg.KubeAPI, "kube-api", "", "URL of the Kubernetes API server, overrides the server in the kubeconfig (optional)")
+	fs.StringVar(&cfg.Namespace, "kube-namespace", "", "only use Hardware resources in this namespace (optional, defaults to all namespaces)")
+}
+
+// Exec is the execution function for the kube subcommand.
+func (k *KubeCfg) Exec(ctx context.Context, _ []string) error {
+	defaults := KubeCfg{
+		Config: Config{
+			LogLevel: "info",
+			Log:      defaultLogger("info"),
+		},
+	}
+	err := mergo.Merge(k, defaults, mergo.WithTransformers(logger{}))
+	if err != nil {
+		return err
+	}
+	rc, err := kube.RESTConfig(k.Kubeconfig, k.KubeAPI)
+	if err != nil {
+		return fmt.Errorf("unable to load the Kubernetes client config: %w", err)
+	}
+	cl, err := kube.NewCluster(rc, k.Namespace)
+	if err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return cl.Start(ctx)
+	})
+	k.Log.Info("waiting for the Hardware cache to sync", "namespace", k.Namespace)
+	if !cl.GetCache().WaitForCacheSync(ctx) {
+		return fmt.Errorf("failed to sync the Hardware cache: %w", g.Wait())
+	}
+	k.Config.Authz = &kube.Kube{Client: cl.GetCache(), Namespace: k.Namespace, Log: k.Log.WithName("kube")}
+	g.Go(func() error {
+		return k.Config.run(ctx, nil)
+	})
+	return g.Wait()
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/pkg/errors"
+	"inet.af/netaddr"
+)
+
+// ListenerCfg is a DHCPv4 listener and the remote servers the clients it receives requests from boot from.
+// Remote servers that are not set default to the -remote-tftp, -remote-http and -remote-ipxe flags.
+type ListenerCfg struct {
+	// Addr is the IPv4 address or the name of the network interface to listen on.
+	Addr     string `json:"addr"`
+	TFTPAddr string `json:"remoteTFTP,omitempty"`
+	HTTPAddr string `json:"remoteHTTP,omitempty"`
+	IPXEAddr string `json:"remoteIPXE,omitempty"`
+}
+
+// listenFlag is the repeatable -listen flag, "<addr or interface>[,remote-tftp=<ip:port>][,remote-http=<ip:port>][,remote-ipxe=<url>]".
+type listenFlag struct {
+	listeners *[]ListenerCfg
+}
+
+// String returns the listen addresses of the flag.
+func (f listenFlag) String() string {
+	if f.listeners == nil {
+		return ""
+	}
+	var addrs []string
+	for _, l := range *f.listeners {
+		addrs = append(addrs, l.Addr)
+	}
+	return strings.Join(addrs, " ")
+}
+
+// Set parses a listener and adds it to the flag.
+func (f listenFlag) Set(s string) error {
+	fields := strings.Split(s, ",")
+	l := ListenerCfg{Addr: strings.TrimSpace(fields[0])}
+	if l.Addr == "" {
+		return errors.New("missing listen address or interface")
+	}
+	for _, kv := range fields[1:] {
+		k, v := kv, ""
+		if i := strings.Index(kv, "="); i >= 0 {
+			k, v = strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:])
+		}
+		var err error
+		switch k {
+		case "remote-tftp":
+			l.TFTPAddr = v
+			_, err = netaddr.ParseIPPort(v)
+		case "remote-http":
+			l.HTTPAddr = v
+			_, err = netaddr.ParseIPPort(v)
+		case "remote-ipxe":
+			l.IPXEAddr = v
+			_, err = url.ParseRequestURI(v)
+		default:
+			return fmt.Errorf("unknown listener setting %q, must be remote-tftp, remote-http or remote-ipxe", k)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "invalid %v", k)
+		}
+	}
+	*f.listeners = append(*f.listeners, l)
+	return nil
+}
+
+// ports4 are the ports of a DHCPv4 listener, proxyDHCP and PXE boot server discovery.
+var ports4 = []int{67, 4011}
+
+// listener4 is the proxyDHCP (port 67) and boot server (port 4011) listeners of a ListenerCfg.
+type listener4 struct {
+	log     logr.Logger
+	addr    netaddr.IP
+	iface   string
+	servers map[int]server
+}
+
+// listeners4 returns the configured DHCPv4 listeners, or the -proxy-addr listener when there are none.
+func (c *Config) listeners4() ([]ListenerCfg, error) {
+	if len(c.Listeners) == 0 {
+		return []ListenerCfg{{Addr: c.ProxyAddr}}, nil
+	}
+	seen := map[string]bool{}
+	for _, l := range c.Listeners {
+		if seen[l.Addr] {
+			return nil, fmt.Errorf("-listen %v is used more than once", l.Addr)
+		}
+		seen[l.Addr] = true
+		// a listener on all interfaces would get the requests of every other listener too.
+		if ip, err := netaddr.ParseIP(l.Addr); err == nil && ip.IsUnspecified() && len(c.Listeners) > 1 {
+			return nil, fmt.Errorf("-listen %v listens on all interfaces, it can't be used with other listeners", l.Addr)
+		}
+	}
+	return c.Listeners, nil
+}
+
+// listen4 creates the DHCPv4 listeners of l. Every listener has its own Handler so that clients boot from its remote servers.
+func (c *Config) listen4(ctx context.Context, l ListenerCfg, ta, ha netaddr.IPPort, ia *url.URL, opts ...proxy.Option) (listener4, error) {
+	var err error
+	if l.TFTPAddr != "" {
+		if ta, err = netaddr.ParseIPPort(l.TFTPAddr); err != nil {
+			return listener4{}, err
+		}
+	}
+	if l.HTTPAddr != "" {
+		if ha, err = netaddr.ParseIPPort(l.HTTPAddr); err != nil {
+			return listener4{}, err
+		}
+	}
+	if l.IPXEAddr != "" {
+		if ia, err = url.Parse(l.IPXEAddr); err != nil {
+			return listener4{}, err
+		}
+	}
+	ip, iface, err := proxy.ListenAddr(l.Addr)
+	if err != nil {
+		return listener4{}, errors.Wrapf(err, "invalid listen address %q", l.Addr)
+	}
+	li := listener4{log: c.Log.WithValues("listener", l.Addr, "interface", iface), addr: ip, iface: iface, servers: map[int]server{}}
+	opts = append(opts, proxy.WithLogger(li.log), proxy.WithInterface(iface))
+	for _, port := range ports4 {
+		h := proxy.NewHandler(ctx, ta, ha, ia, opts...)
+		s, err := proxy.Server(ctx, netaddr.IPPortFrom(ip, uint16(port)), nil, h.Redirection)
+		if err != nil {
+			for _, s := range li.servers {
+				s.Close()
+			}
+			return listener4{}, errors.Wrapf(err, "unable to listen on %v port %d", l.Addr, port)
+		}
+		li.servers[port] = s
+	}
+	return li, nil
+}
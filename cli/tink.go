@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"flag"
+	"time"
 
 	"github.com/imdario/mergo"
 	"github.com/jacobweinstock/proxydhcp/authz/tink"
@@ -26,6 +27,18 @@ type TinkCfg struct {
 	TLS string
 	// Tink is the URL:Port for the tink server
 	Tink string `validate:"required"`
+	// Timeout is the deadline for a single call to the tink server.
+	Timeout time.Duration
+	// Retries is how many times a call that failed with a transient error is retried.
+	Retries int
+	// RetryBackoff is the base delay between retries.
+	RetryBackoff time.Duration
+	// BreakerThreshold is the number of consecutive failed calls that stops calls to the tink server. 0 disables the breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long calls to the tink server are stopped once the breaker opens.
+	BreakerCooldown time.Duration
+	// Keepalive is how often the connection to the tink server is pinged while calls are in flight. 0 disables keepalive pings.
+	Keepalive time.Duration
 }
 
 // Tink is the subcommand that communicates with Tink server for authorizing PXE boot requests.
@@ -50,6 +63,12 @@ func RegisterFlagsTink(cfg *TinkCfg, fs *flag.FlagSet) {
 	fs.StringVar(&cfg.Tink, "tink", "", "tink server URL (required)")
 	description := "(file:///path/to/cert/tink.cert, http://tink-server:42114/cert, boolean (false - no TLS, true - tink has a cert from known CA) (optional)"
 	fs.StringVar(&cfg.TLS, "tls", "false", "tink server TLS "+description)
+	fs.DurationVar(&cfg.Timeout, "timeout", 2*time.Second, "deadline for a single call to the tink server")
+	fs.IntVar(&cfg.Retries, "retries", 2, "number of retries for a call that failed with a transient error")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", 100*time.Millisecond, "base delay between retries, doubled every retry and jittered")
+	fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", 5, "consecutive failed calls before calls to the tink server are stopped (0 disables)")
+	fs.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", 30*time.Second, "how long calls to the tink server are stopped once the breaker opens")
+	fs.DurationVar(&cfg.Keepalive, "keepalive", 0, "how often the connection to the tink server is pinged while calls are in flight (0 disables, tink servers reject pings more often than every 5m by default)")
 }
 
 // Exec is the execution function for the tink subcommand.
@@ -65,12 +84,21 @@ func (t *TinkCfg) Exec(ctx context.Context, _ []string) error {
 		return err
 	}
 	t.Log.Info("starting ipxe", "tftp-addr", t.TFTPAddr, "http-addr", t.HTTPAddr)
-	gc, err := tink.SetupClient(ctx, t.Log, t.TLS, t.Tink)
+	gc, err := tink.SetupClient(ctx, t.Log, t.TLS, t.Tink, t.Keepalive)
 	if err != nil {
 		return err
 	}
 	c := hardware.NewHardwareServiceClient(gc)
-	tb := &tink.Tinkerbell{Client: c, Log: t.Log}
+	tb := &tink.Tinkerbell{
+		Client:       c,
+		Log:          t.Log,
+		Timeout:      t.Timeout,
+		Retries:      t.Retries,
+		RetryBackoff: t.RetryBackoff,
+	}
+	if t.BreakerThreshold > 0 {
+		tb.Breaker = tink.NewBreaker(t.BreakerThreshold, t.BreakerCooldown)
+	}
 	t.Config.Authz = tb
 	return t.Config.run(ctx, nil)
 }
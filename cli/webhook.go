@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imdario/mergo"
+	"github.com/jacobweinstock/proxydhcp/authz/webhook"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/pkg/errors"
+)
+
+const webhookCLI = "webhook"
+
+// WebhookCfg is the configuration for the webhook backend.
+type WebhookCfg struct {
+	Config
+	// URL is the webhook endpoint.
+	URL string `validate:"required,url"`
+	// Timeout is the maximum time a webhook request can take.
+	Timeout time.Duration
+	// TokenFile is a file containing a bearer token to send with every request.
+	TokenFile string
+	// CACert is a PEM file of CA certificates to verify the webhook server with.
+	CACert string
+	// ClientCert and ClientKey are PEM files for mutual TLS.
+	ClientCert string
+	ClientKey  string
+	// InsecureSkipVerify disables verification of the webhook server certificate.
+	InsecureSkipVerify bool
+}
+
+// Webhook is the subcommand that asks an HTTP endpoint to authorize PXE boot requests.
+func Webhook() *ffcli.Command {
+	cfg := &WebhookCfg{}
+	fs := flag.NewFlagSet(webhookCLI, flag.ExitOnError)
+	RegisterFlagsWebhook(cfg, fs)
+
+	return &ffcli.Command{
+		Name:       webhookCLI,
+		ShortUsage: webhookCLI,
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			return cfg.Exec(ctx, nil)
+		},
+	}
+}
+
+// RegisterFlagsWebhook registers the flags for the webhook subcommand.
+func RegisterFlagsWebhook(cfg *WebhookCfg, fs *flag.FlagSet) {
+	RegisterFlags(&cfg.Config, fs)
+	fs.StringVar(&cfg.URL, "url", "", "webhook URL that PXE requests are POSTed to (required)")
+	fs.DurationVar(&cfg.Timeout, "timeout", 5*time.Second, "maximum time a webhook request can take")
+	fs.StringVar(&cfg.TokenFile, "token-file", "", "file with a bearer token to send in the Authorization header (optional)")
+	fs.StringVar(&cfg.CACert, "ca-cert", "", "PEM file of CA certificates to verify the webhook server with (optional, defaults to the system pool)")
+	fs.StringVar(&cfg.ClientCert, "client-cert", "", "PEM client certificate for mutual TLS (optional)")
+	fs.StringVar(&cfg.ClientKey, "client-key", "", "PEM client key for mutual TLS (optional)")
+	fs.BoolVar(&cfg.InsecureSkipVerify, "insecure-skip-verify", false, "do not verify the webhook server certificate")
+}
+
+// Exec is the execution function for the webhook subcommand.
+func (w *WebhookCfg) Exec(ctx context.Context, _ []string) error {
+	defaults := WebhookCfg{
+		Config: Config{
+			LogLevel: "info",
+			Log:      defaultLogger("info"),
+		},
+	}
+	err := mergo.Merge(w, defaults, mergo.WithTransformers(logger{}))
+	if err != nil {
+		return err
+	}
+	if w.URL == "" {
+		return errors.New("webhook url is required")
+	}
+	hc, err := webhook.NewHTTPClient(w.Timeout, w.CACert, w.ClientCert, w.ClientKey, w.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	var token string
+	if w.TokenFile != "" {
+		data, err := os.ReadFile(w.TokenFile)
+		if err != nil {
+			return errors.Wrapf(err, "could not read token file %q", w.TokenFile)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	w.Config.Authz = &webhook.Webhook{URL: w.URL, Client: hc, Token: token, Log: w.Log.WithName("webhook")}
+	return w.Config.run(ctx, nil)
+}
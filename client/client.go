@@ -0,0 +1,270 @@
+// Package client simulates the DHCP client of PXE and HTTP boot firmware, to test a proxydhcp server.
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+const (
+	// PXEClient is the client type of PXE firmware.
+	PXEClient = "PXEClient"
+	// HTTPClient is the client type of UEFI HTTP boot firmware.
+	HTTPClient = "HTTPClient"
+)
+
+// ErrInvalidGUID is used when a GUID is not a 16 byte UUID.
+var ErrInvalidGUID = errors.New("GUID must be a UUID, i.e. 4c4c4544-0051-3510-8051-b4c04f4e5331")
+
+// aLongTimeAgo is a deadline in the past, setting it unblocks pending reads.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// Client describes the firmware that is simulated.
+type Client struct {
+	// MAC is the client hardware address (chaddr).
+	MAC net.HardwareAddr
+	// Arch is the client system architecture (option 93).
+	Arch iana.Arch
+	// ClientType is PXEClient or HTTPClient, it is used for the default VendorClass.
+	ClientType string
+	// VendorClass is option 60. It defaults to "<ClientType>:Arch:<Arch>:UNDI:003016".
+	VendorClass string
+	// UserClass is option 77, not sent when empty.
+	UserClass string
+	// GUID is the client machine identifier (option 97) as a UUID, not sent when empty.
+	GUID string
+}
+
+// Discover returns a DISCOVER from the Client.
+func (c Client) Discover() (*dhcpv4.DHCPv4, error) {
+	mods, err := c.modifiers()
+	if err != nil {
+		return nil, err
+	}
+	return dhcpv4.NewDiscovery(c.MAC, mods...)
+}
+
+// Request returns a REQUEST from the Client in reply to an OFFER.
+// It is the REQUEST PXE firmware sends to port 4011 of the boot server.
+func (c Client) Request(offer *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
+	mods, err := c.modifiers()
+	if err != nil {
+		return nil, err
+	}
+	mods = append(mods,
+		dhcpv4.WithHwAddr(c.MAC),
+		dhcpv4.WithTransactionID(offer.TransactionID),
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeRequest),
+	)
+	if sid := offer.ServerIdentifier(); sid != nil {
+		mods = append(mods, dhcpv4.WithOption(dhcpv4.OptServerIdentifier(sid)))
+	}
+	return dhcpv4.New(mods...)
+}
+
+// modifiers returns the options PXE firmware sends in both DISCOVER and REQUEST messages.
+func (c Client) modifiers() ([]dhcpv4.Modifier, error) {
+	vc := c.VendorClass
+	if vc == "" {
+		ct := c.ClientType
+		if ct == "" {
+			ct = PXEClient
+		}
+		vc = fmt.Sprintf("%v:Arch:%05d:UNDI:003016", ct, c.Arch)
+	}
+	mods := []dhcpv4.Modifier{
+		dhcpv4.WithBroadcast(true),
+		dhcpv4.WithOption(dhcpv4.OptClassIdentifier(vc)),
+		dhcpv4.WithOption(dhcpv4.OptClientArch(c.Arch)),
+		// UNDI version 3.16
+		dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, []byte{1, 3, 16})),
+		dhcpv4.WithRequestedOptions(
+			dhcpv4.OptionSubnetMask,
+			dhcpv4.OptionRouter,
+			dhcpv4.OptionVendorSpecificInformation,
+			dhcpv4.OptionClassIdentifier,
+			dhcpv4.OptionTFTPServerName,
+			dhcpv4.OptionBootfileName,
+		),
+	}
+	if c.UserClass != "" {
+		mods = append(mods, dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionUserClassInformation, []byte(c.UserClass))))
+	}
+	if c.GUID != "" {
+		guid, err := ParseGUID(c.GUID)
+		if err != nil {
+			return nil, err
+		}
+		// option 97 is a type byte (0) followed by the 16 byte GUID.
+		mods = append(mods, dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionClientMachineIdentifier, append([]byte{0}, guid...))))
+	}
+	return mods, nil
+}
+
+// ParseGUID parses a UUID string into its 16 bytes.
+func ParseGUID(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGUID, s)
+	}
+	return b, nil
+}
+
+// Exchange sends pkt to addr and returns the first reply with the same transaction id.
+// It waits until ctx is done for a reply, replies from other transactions are skipped.
+func Exchange(ctx context.Context, conn net.PacketConn, addr net.Addr, pkt *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, net.Addr, error) {
+	var (
+		reply *dhcpv4.DHCPv4
+		from  net.Addr
+	)
+	err := exchange(ctx, conn, addr, pkt, func(m *dhcpv4.DHCPv4, peer net.Addr) bool {
+		reply, from = m, peer
+		return false
+	})
+	return reply, from, err
+}
+
+// Received is a reply and the address it was received from.
+type Received struct {
+	Reply *dhcpv4.DHCPv4
+	From  net.Addr
+}
+
+// ExchangeAll sends pkt to addr and returns every reply with the same transaction id that accept returns true for,
+// received until ctx is done. A broadcast DISCOVER is answered by DHCP servers as well as proxyDHCP servers, see ProxyReply.
+// An error is only returned when no reply was accepted.
+func ExchangeAll(ctx context.Context, conn net.PacketConn, addr net.Addr, pkt *dhcpv4.DHCPv4, accept func(*dhcpv4.DHCPv4) bool) ([]Received, error) {
+	var all []Received
+	err := exchange(ctx, conn, addr, pkt, func(m *dhcpv4.DHCPv4, peer net.Addr) bool {
+		if accept == nil || accept(m) {
+			all = append(all, Received{Reply: m, From: peer})
+		}
+		return true
+	})
+	if len(all) > 0 {
+		return all, nil
+	}
+	return nil, err
+}
+
+// ProxyReply returns true if m is from a proxyDHCP or PXE boot server: it identifies itself as a PXEClient or HTTPClient
+// (option 60) and does not assign an address (yiaddr).
+func ProxyReply(m *dhcpv4.DHCPv4) bool {
+	vc := m.ClassIdentifier()
+	if !strings.HasPrefix(vc, PXEClient) && !strings.HasPrefix(vc, HTTPClient) {
+		return false
+	}
+	return m.YourIPAddr == nil || m.YourIPAddr.IsUnspecified()
+}
+
+// exchange sends pkt to addr and passes every reply with the same transaction id to received,
+// until received returns false or ctx is done.
+func exchange(ctx context.Context, conn net.PacketConn, addr net.Addr, pkt *dhcpv4.DHCPv4, received func(*dhcpv4.DHCPv4, net.Addr) bool) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	// unblock the read when ctx is cancelled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetReadDeadline(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+
+	if _, err := conn.WriteTo(pkt.ToBytes(), addr); err != nil {
+		return err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			var ne net.Error
+			if _, ok := ctx.Deadline(); ok && errors.As(err, &ne) && ne.Timeout() {
+				return context.DeadlineExceeded
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		reply, err := dhcpv4.FromBytes(buf[:n])
+		if err != nil || reply.OpCode != dhcpv4.OpcodeBootReply || reply.TransactionID != pkt.TransactionID {
+			continue
+		}
+		if !received(reply, peer) {
+			return nil
+		}
+	}
+}
+
+// Reply is the decoded reply from a proxydhcp server.
+type Reply struct {
+	From          string `json:"from"`
+	MessageType   string `json:"messageType"`
+	TransactionID string `json:"xid"`
+	// ServerID is option 54.
+	ServerID string `json:"serverID,omitempty"`
+	// NextServer is the siaddr header.
+	NextServer string `json:"nextServer,omitempty"`
+	// ServerName is the sname header.
+	ServerName string `json:"serverName,omitempty"`
+	// Bootfile is the file header.
+	Bootfile string `json:"bootfile,omitempty"`
+	// VendorClass is option 60.
+	VendorClass string `json:"vendorClass,omitempty"`
+	// Message is option 56, why the client is not allowed to boot.
+	Message string `json:"message,omitempty"`
+	// Options are all options in the reply, keyed by option name.
+	Options map[string]string `json:"options"`
+}
+
+// NewReply decodes a reply.
+func NewReply(m *dhcpv4.DHCPv4, from net.Addr) Reply {
+	r := Reply{
+		MessageType:   m.MessageType().String(),
+		TransactionID: m.TransactionID.String(),
+		ServerName:    m.ServerHostName,
+		Bootfile:      m.BootFileName,
+		VendorClass:   m.ClassIdentifier(),
+		Message:       m.Message(),
+		Options:       map[string]string{},
+	}
+	if from != nil {
+		r.From = from.String()
+	}
+	if sid := m.ServerIdentifier(); sid != nil {
+		r.ServerID = sid.String()
+	}
+	if m.ServerIPAddr != nil && !m.ServerIPAddr.IsUnspecified() {
+		r.NextServer = m.ServerIPAddr.String()
+	}
+	for code, v := range m.Options {
+		r.Options[fmt.Sprintf("%v (%d)", dhcpv4.GenericOptionCode(code), code)] = printable(v)
+	}
+	return r
+}
+
+// printable returns b as a string when it is printable, otherwise as hex.
+func printable(b []byte) string {
+	s := string(b)
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return hex.EncodeToString(b)
+		}
+	}
+	return s
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"inet.af/netaddr"
+)
+
+// serve runs h on a loopback listener until the test ends.
+func serve(t *testing.T, h *proxy.Handler) net.Addr {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			m, err := dhcpv4.FromBytes(buf[:n])
+			if err != nil {
+				continue
+			}
+			h.Redirection(conn, peer, m)
+		}
+	}()
+	return conn.LocalAddr()
+}
+
+func TestExchange(t *testing.T) {
+	h := proxy.NewHandler(
+		context.Background(),
+		netaddr.IPPortFrom(netaddr.MustParseIP("192.168.2.5"), 69),
+		netaddr.IPPortFrom(netaddr.MustParseIP("192.168.2.4"), 80),
+		&url.URL{Scheme: "http", Host: "192.168.2.3:8080"},
+	)
+	addr := serve(t, h)
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := Client{
+		MAC:  net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+		Arch: iana.EFI_X86_64,
+		GUID: "4c4c4544-0051-3510-8051-b4c04f4e5331",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	discover, err := c.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer, from, err := Exchange(ctx, conn, addr, discover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := NewReply(offer, from)
+	want := Reply{
+		From:          addr.String(),
+		MessageType:   "OFFER",
+		TransactionID: discover.TransactionID.String(),
+		NextServer:    "192.168.2.5",
+		ServerName:    "192.168.2.5",
+		ServerID:      "192.168.2.5",
+		Bootfile:      "00:01:02:03:04:05/ipxe.efi",
+		VendorClass:   PXEClient,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Reply{}, "Options")); diff != "" {
+		t.Fatal(diff)
+	}
+
+	request, err := c.Request(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack, _, err := Exchange(ctx, conn, addr, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.MessageType() != dhcpv4.MessageTypeAck || ack.BootFileName != want.Bootfile {
+		t.Fatalf("got %v with bootfile %q", ack.MessageType(), ack.BootFileName)
+	}
+	// the GUID is mirrored back.
+	if got := ack.GetOneOption(dhcpv4.OptionClientMachineIdentifier); len(got) != 17 {
+		t.Fatalf("got option 97 %x", got)
+	}
+}
+
+func TestExchangeTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// nothing replies from this address.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	discover, err := Client{MAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, Arch: iana.INTEL_X86PC}.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := Exchange(ctx, conn, silent.LocalAddr(), discover); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDiscoverOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		client Client
+		want60 string
+		want77 string
+		err    error
+	}{
+		{name: "pxe", client: Client{Arch: iana.INTEL_X86PC}, want60: "PXEClient:Arch:00000:UNDI:003016"},
+		{name: "http", client: Client{Arch: iana.EFI_X86_64_HTTP, ClientType: HTTPClient, UserClass: "iPXE"}, want60: "HTTPClient:Arch:00016:UNDI:003016", want77: "iPXE"},
+		{name: "vendor class", client: Client{VendorClass: "PXEClient"}, want60: "PXEClient"},
+		{name: "bad guid", client: Client{GUID: "nope"}, err: ErrInvalidGUID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.client.MAC = net.HardwareAddr{0, 1, 2, 3, 4, 5}
+			d, err := tt.client.Discover()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := d.ClassIdentifier(); got != tt.want60 {
+				t.Fatalf("option 60: got %q, want %q", got, tt.want60)
+			}
+			if got := string(d.GetOneOption(dhcpv4.OptionUserClassInformation)); got != tt.want77 {
+				t.Fatalf("option 77: got %q, want %q", got, tt.want77)
+			}
+		})
+	}
+}
+
+func TestExchangeAll(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	servers, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer servers.Close()
+
+	discover, err := Client{MAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, Arch: iana.EFI_X86_64}.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a DHCP server offers an address before the proxyDHCP server replies.
+	dhcpOffer, _ := dhcpv4.NewReplyFromRequest(discover, dhcpv4.WithYourIP(net.IP{192, 168, 2, 100}), dhcpv4.WithMessageType(dhcpv4.MessageTypeOffer))
+	proxyOffer, _ := dhcpv4.NewReplyFromRequest(discover, dhcpv4.WithMessageType(dhcpv4.MessageTypeOffer), dhcpv4.WithOption(dhcpv4.OptClassIdentifier(PXEClient)))
+	other, _ := dhcpv4.NewReplyFromRequest(discover, dhcpv4.WithMessageType(dhcpv4.MessageTypeOffer), dhcpv4.WithOption(dhcpv4.OptClassIdentifier(PXEClient)))
+	other.TransactionID = dhcpv4.TransactionID{1, 2, 3, 4}
+	go func() {
+		buf := make([]byte, 1500)
+		_, peer, err := servers.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		for _, m := range []*dhcpv4.DHCPv4{dhcpOffer, other, proxyOffer, proxyOffer} {
+			_, _ = servers.WriteTo(m.ToBytes(), peer)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	got, err := ExchangeAll(ctx, conn, servers.LocalAddr(), discover, ProxyReply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every proxyDHCP reply received before the deadline, not the DHCP server's or another transaction's.
+	if len(got) != 2 || !ProxyReply(got[0].Reply) || got[0].From.String() != servers.LocalAddr().String() {
+		t.Fatalf("got %+v, want the 2 proxyDHCP replies", got)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ExchangeAll(ctx, conn, servers.LocalAddr(), discover, ProxyReply); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestProxyReply(t *testing.T) {
+	tests := []struct {
+		name string
+		mods []dhcpv4.Modifier
+		want bool
+	}{
+		{name: "proxyDHCP", mods: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier(PXEClient))}, want: true},
+		{name: "HTTP boot", mods: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier(HTTPClient))}, want: true},
+		{name: "no option 60"},
+		{name: "DHCP server with PXE options", mods: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier(PXEClient)), dhcpv4.WithYourIP(net.IP{192, 168, 2, 100})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := dhcpv4.New(tt.mods...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ProxyReply(m); got != tt.want {
+				t.Fatalf("ProxyReply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,7 +19,9 @@ import (
 func Execute(ctx context.Context) error {
 	rootCMD, rootConfig := cli.ProxyDHCP(ctx)
 	binCMD := cli.SupportedBins(ctx)
-	rootC := newCLI(rootCMD, binCMD)
+	clientCMD := cli.PXEClient(ctx)
+	inspectCMD := cli.Inspect(ctx)
+	rootC := newCLI(rootCMD, binCMD, clientCMD, inspectCMD)
 
 	if err := rootC.Parse(os.Args[1:]); err != nil {
 		return err
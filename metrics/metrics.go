@@ -0,0 +1,107 @@
+// Package metrics records Prometheus metrics for proxydhcp.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/jacobweinstock/proxydhcp/authz/cache"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "proxydhcp"
+
+// otherUserClass is the user class label for user classes that are not known, to keep the label cardinality bounded.
+const otherUserClass = "other"
+
+// Metrics is a proxy.Observer that records Prometheus metrics for every packet the Handler processes.
+type Metrics struct {
+	packets  *prometheus.CounterVec
+	backend  *prometheus.HistogramVec
+	duration *prometheus.HistogramVec
+	// userClasses are the user classes used as label values as is, all others are recorded as "other".
+	userClasses map[string]bool
+}
+
+// New creates the proxydhcp metrics and registers them with reg.
+// userClasses are custom user classes (DHCP option 77) to record as is, in addition to iPXE and Tinkerbell.
+func New(reg prometheus.Registerer, userClasses ...string) *Metrics {
+	m := &Metrics{
+		packets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "packets_total",
+			Help:      "Number of DHCP packets handled, by listener, message type, architecture, client type, user class, outcome and ignore reason.",
+		}, []string{"listener", "message_type", "arch", "client_type", "user_class", "outcome", "ignore_reason"}),
+		backend: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backend_duration_seconds",
+			Help:      "Time taken by the authorization backend to make a boot decision.",
+			Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"listener", "source"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handle_duration_seconds",
+			Help:      "Time taken to handle a DHCP packet.",
+			Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"listener", "outcome"}),
+		userClasses: map[string]bool{"": true, string(proxy.IPXE): true, string(proxy.Tinkerbell): true},
+	}
+	for _, uc := range userClasses {
+		m.userClasses[uc] = true
+	}
+	reg.MustRegister(m.packets, m.backend, m.duration)
+
+	return m
+}
+
+// Observe records the metrics for a packet.
+func (m *Metrics) Observe(e proxy.Event) {
+	uc := e.UserClass
+	if !m.userClasses[uc] {
+		uc = otherUserClass
+	}
+	m.packets.WithLabelValues(e.Listener, e.MessageType, e.Arch, e.ClientType, uc, string(e.Outcome), e.IgnoreReason).Inc()
+	m.duration.WithLabelValues(e.Listener, string(e.Outcome)).Observe(e.Duration.Seconds())
+	if e.BackendDuration > 0 {
+		m.backend.WithLabelValues(e.Listener, e.Decision.Source).Observe(e.BackendDuration.Seconds())
+	}
+}
+
+// RegisterCache registers the hit, miss and size metrics of a decision cache with reg.
+func RegisterCache(reg prometheus.Registerer, c *cache.Cache) {
+	counter := func(name, help string, f func(cache.Stats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(f(c.Stats())) })
+	}
+	reg.MustRegister(
+		counter("hits_total", "Number of boot decisions served from the cache.", func(s cache.Stats) uint64 { return s.Hits }),
+		counter("misses_total", "Number of boot decisions not found in the cache.", func(s cache.Stats) uint64 { return s.Misses }),
+		counter("stale_hits_total", "Number of expired boot decisions served because the backend failed.", func(s cache.Stats) uint64 { return s.StaleHits }),
+		counter("errors_total", "Number of backend errors seen by the cache.", func(s cache.Stats) uint64 { return s.Errors }),
+		counter("evictions_total", "Number of boot decisions evicted from the cache.", func(s cache.Stats) uint64 { return s.Evictions }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "size",
+			Help:      "Number of boot decisions in the cache.",
+		}, func() float64 { return float64(c.Stats().Size) }),
+	)
+}
+
+// NewRegistry returns a Prometheus registry with the Go runtime and process collectors registered.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return reg
+}
+
+// Handler returns an http.Handler that serves the metrics in reg.
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
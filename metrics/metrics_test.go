@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserve(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg, "custom")
+	events := []proxy.Event{
+		{Listener: "67", MessageType: "DISCOVER", Arch: "EFI x86-64", ClientType: "PXEClient", UserClass: "custom", Outcome: proxy.OutcomeOffer, BackendDuration: time.Millisecond, Decision: proxy.Decision{Allow: true, Source: "file"}},
+		{Listener: "67", MessageType: "DISCOVER", Arch: "EFI x86-64", ClientType: "PXEClient", UserClass: "something random", Outcome: proxy.OutcomeOffer},
+		{Listener: "4011", MessageType: "REQUEST", Outcome: proxy.OutcomeIgnored, IgnoreReason: "option60_missing"},
+	}
+	for _, e := range events {
+		m.Observe(e)
+	}
+
+	want := `
+# HELP proxydhcp_packets_total Number of DHCP packets handled, by listener, message type, architecture, client type, user class, outcome and ignore reason.
+# TYPE proxydhcp_packets_total counter
+proxydhcp_packets_total{arch="",client_type="",ignore_reason="option60_missing",listener="4011",message_type="REQUEST",outcome="ignored",user_class=""} 1
+proxydhcp_packets_total{arch="EFI x86-64",client_type="PXEClient",ignore_reason="",listener="67",message_type="DISCOVER",outcome="offer",user_class="custom"} 1
+proxydhcp_packets_total{arch="EFI x86-64",client_type="PXEClient",ignore_reason="",listener="67",message_type="DISCOVER",outcome="offer",user_class="other"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "proxydhcp_packets_total"); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.CollectAndCount(m.backend); got != 1 {
+		t.Fatalf("backend histograms: got %v, want 1", got)
+	}
+}
@@ -0,0 +1,256 @@
+// Package pcap reads the UDP packets from pcap and pcapng capture files, i.e. to replay or inspect DHCP traffic.
+// Ethernet, 802.1Q, Linux cooked (SLL and SLL2) and raw IP captures are supported.
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// link types, see https://www.tcpdump.org/linktypes.html
+const (
+	linkEthernet = 1
+	linkRaw      = 101
+	linkSLL      = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+const (
+	magicMicro    = 0xa1b2c3d4
+	magicNano     = 0xa1b23c4d
+	pcapngSHB     = 0x0a0d0d0a
+	pcapngIDB     = 0x00000001
+	pcapngSPB     = 0x00000003
+	pcapngEPB     = 0x00000006
+	pcapngBOMagic = 0x1a2b3c4d
+)
+
+var (
+	// ErrUnknownFormat is used when a file is neither pcap nor pcapng.
+	ErrUnknownFormat = errors.New("not a pcap or pcapng file")
+	// ErrTruncated is used when a capture file ends in the middle of a record.
+	ErrTruncated = errors.New("capture file is truncated")
+)
+
+// Packet is a UDP datagram from a capture file.
+type Packet struct {
+	// Time is when the packet was captured.
+	Time time.Time
+	Src  *net.UDPAddr
+	Dst  *net.UDPAddr
+	// Payload is the UDP payload.
+	Payload []byte
+}
+
+// IsPcap returns true if b starts with a pcap or pcapng magic number.
+func IsPcap(b []byte) bool {
+	if len(b) < 4 {
+		return false
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(b) {
+		case magicMicro, magicNano, pcapngSHB:
+			return true
+		}
+	}
+	return false
+}
+
+// ReadUDP returns all UDP packets in a pcap or pcapng capture. Packets that are not UDP over IPv4 or IPv6 are skipped.
+func ReadUDP(r io.Reader) ([]Packet, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngSHB {
+		return readPcapng(br)
+	}
+	return readPcap(br)
+}
+
+func readPcap(r io.Reader) ([]Packet, error) {
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, ErrUnknownFormat
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(hdr)
+	if magic != magicMicro && magic != magicNano {
+		order = binary.BigEndian
+		magic = order.Uint32(hdr)
+	}
+	if magic != magicMicro && magic != magicNano {
+		return nil, ErrUnknownFormat
+	}
+	link := order.Uint32(hdr[20:]) & 0x0fffffff
+	var out []Packet
+	rec := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return out, nil
+			}
+			return out, ErrTruncated
+		}
+		sec, frac := int64(order.Uint32(rec)), int64(order.Uint32(rec[4:]))
+		if magic == magicMicro {
+			frac *= int64(time.Microsecond)
+		}
+		data := make([]byte, order.Uint32(rec[8:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return out, ErrTruncated
+		}
+		if p, ok := decode(link, data); ok {
+			p.Time = time.Unix(sec, frac).UTC()
+			out = append(out, p)
+		}
+	}
+}
+
+func readPcapng(r io.Reader) ([]Packet, error) {
+	var (
+		order binary.ByteOrder = binary.LittleEndian
+		links []uint32
+		out   []Packet
+		hdr   = make([]byte, 8)
+	)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return out, nil
+			}
+			return out, ErrTruncated
+		}
+		typ := order.Uint32(hdr)
+		if typ == pcapngSHB {
+			// the byte order magic follows the block length, the block length is read again below in that order.
+			bom := make([]byte, 4)
+			if _, err := io.ReadFull(r, bom); err != nil {
+				return out, ErrTruncated
+			}
+			order = binary.LittleEndian
+			if order.Uint32(bom) != pcapngBOMagic {
+				order = binary.BigEndian
+			}
+			if order.Uint32(bom) != pcapngBOMagic {
+				return out, ErrUnknownFormat
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(order.Uint32(hdr[4:]))-12); err != nil {
+				return out, ErrTruncated
+			}
+			// interface ids are per section.
+			links = nil
+			continue
+		}
+		length := order.Uint32(hdr[4:])
+		if length < 12 {
+			return out, fmt.Errorf("%w: block length %d", ErrTruncated, length)
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return out, ErrTruncated
+		}
+		switch typ {
+		case pcapngIDB:
+			links = append(links, uint32(order.Uint16(body)))
+		case pcapngEPB:
+			if len(body) < 20 {
+				return out, ErrTruncated
+			}
+			id, caplen := order.Uint32(body), order.Uint32(body[12:])
+			if int(id) >= len(links) || int(caplen) > len(body)-20 {
+				continue
+			}
+			if p, ok := decode(links[id], body[20:20+caplen]); ok {
+				// the default timestamp resolution is microseconds.
+				ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+				p.Time = time.Unix(0, int64(ts)*int64(time.Microsecond)).UTC()
+				out = append(out, p)
+			}
+		case pcapngSPB:
+			if len(links) == 0 || len(body) < 4 {
+				continue
+			}
+			if p, ok := decode(links[0], body[4:]); ok {
+				out = append(out, p)
+			}
+		}
+	}
+}
+
+// decode returns the UDP packet in a link layer frame.
+func decode(link uint32, b []byte) (Packet, bool) {
+	var ethertype uint16
+	switch link {
+	case linkEthernet:
+		if len(b) < 14 {
+			return Packet{}, false
+		}
+		ethertype, b = binary.BigEndian.Uint16(b[12:]), b[14:]
+		// 802.1Q VLAN tags
+		for (ethertype == 0x8100 || ethertype == 0x88a8) && len(b) >= 4 {
+			ethertype, b = binary.BigEndian.Uint16(b[2:]), b[4:]
+		}
+	case linkSLL:
+		if len(b) < 16 {
+			return Packet{}, false
+		}
+		ethertype, b = binary.BigEndian.Uint16(b[14:]), b[16:]
+	case linkSLL2:
+		if len(b) < 20 {
+			return Packet{}, false
+		}
+		ethertype, b = binary.BigEndian.Uint16(b), b[20:]
+	case linkRaw, linkIPv4, linkIPv6:
+		if len(b) == 0 {
+			return Packet{}, false
+		}
+		ethertype = 0x0800
+		if b[0]>>4 == 6 {
+			ethertype = 0x86dd
+		}
+	default:
+		return Packet{}, false
+	}
+
+	var src, dst net.IP
+	switch ethertype {
+	case 0x0800:
+		if len(b) < 20 || b[0]>>4 != 4 {
+			return Packet{}, false
+		}
+		ihl := int(b[0]&0x0f) * 4
+		// only UDP, and not fragments
+		if b[9] != 17 || len(b) < ihl || binary.BigEndian.Uint16(b[6:])&0x3fff != 0 {
+			return Packet{}, false
+		}
+		src, dst, b = net.IP(b[12:16]), net.IP(b[16:20]), b[ihl:]
+	case 0x86dd:
+		if len(b) < 40 || b[6] != 17 {
+			return Packet{}, false
+		}
+		src, dst, b = net.IP(b[8:24]), net.IP(b[24:40]), b[40:]
+	default:
+		return Packet{}, false
+	}
+	if len(b) < 8 {
+		return Packet{}, false
+	}
+	l := int(binary.BigEndian.Uint16(b[4:]))
+	if l < 8 || l > len(b) {
+		l = len(b)
+	}
+	return Packet{
+		Src:     &net.UDPAddr{IP: append(net.IP(nil), src...), Port: int(binary.BigEndian.Uint16(b))},
+		Dst:     &net.UDPAddr{IP: append(net.IP(nil), dst...), Port: int(binary.BigEndian.Uint16(b[2:]))},
+		Payload: append([]byte(nil), b[8:l]...),
+	}, true
+}
@@ -0,0 +1,140 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// frame returns an Ethernet, IPv4 and UDP frame.
+func frame(src, dst *net.UDPAddr, payload []byte, vlan bool) []byte {
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp, uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	ip := make([]byte, 20)
+	ip[0], ip[9] = 0x45, 17
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+	copy(ip[12:], src.IP.To4())
+	copy(ip[16:], dst.IP.To4())
+
+	eth := make([]byte, 12, 18)
+	if vlan {
+		eth = append(eth, 0x81, 0x00, 0x00, 0x0a)
+	}
+	eth = append(eth, 0x08, 0x00)
+	return append(append(eth, ip...), udp...)
+}
+
+func pcapFile(order binary.ByteOrder, frames ...[]byte) []byte {
+	var b bytes.Buffer
+	hdr := make([]byte, 24)
+	order.PutUint32(hdr, magicMicro)
+	order.PutUint16(hdr[4:], 2)
+	order.PutUint16(hdr[6:], 4)
+	order.PutUint32(hdr[16:], 65535)
+	order.PutUint32(hdr[20:], linkEthernet)
+	b.Write(hdr)
+	for i, f := range frames {
+		rec := make([]byte, 16)
+		order.PutUint32(rec, uint32(1646128800+i))
+		order.PutUint32(rec[4:], 500)
+		order.PutUint32(rec[8:], uint32(len(f)))
+		order.PutUint32(rec[12:], uint32(len(f)))
+		b.Write(rec)
+		b.Write(f)
+	}
+	return b.Bytes()
+}
+
+func pcapngFile(frames ...[]byte) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	block := func(typ uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		hdr := make([]byte, 8)
+		le.PutUint32(hdr, typ)
+		le.PutUint32(hdr[4:], uint32(12+len(body)))
+		b.Write(hdr)
+		b.Write(body)
+		b.Write(hdr[4:8])
+	}
+	shb := make([]byte, 16)
+	le.PutUint32(shb, pcapngBOMagic)
+	le.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	block(pcapngSHB, shb)
+	idb := make([]byte, 8)
+	le.PutUint16(idb, linkEthernet)
+	block(pcapngIDB, idb)
+	for i, f := range frames {
+		epb := make([]byte, 20, 20+len(f))
+		ts := uint64(1646128800+i) * 1e6
+		le.PutUint32(epb[4:], uint32(ts>>32))
+		le.PutUint32(epb[8:], uint32(ts))
+		le.PutUint32(epb[12:], uint32(len(f)))
+		le.PutUint32(epb[16:], uint32(len(f)))
+		block(pcapngEPB, append(epb, f...))
+	}
+	return b.Bytes()
+}
+
+func TestReadUDP(t *testing.T) {
+	client := &net.UDPAddr{IP: net.IPv4(192, 168, 2, 50).To4(), Port: 68}
+	server := &net.UDPAddr{IP: net.IPv4(192, 168, 2, 225).To4(), Port: 67}
+	frames := [][]byte{
+		frame(client, server, []byte("discover"), false),
+		frame(server, client, []byte("offer"), true),
+	}
+	// not IP
+	arp := append(make([]byte, 12), 0x08, 0x06, 0, 0)
+
+	tests := map[string][]byte{
+		"pcap little endian": pcapFile(binary.LittleEndian, frames[0], arp, frames[1]),
+		"pcap big endian":    pcapFile(binary.BigEndian, frames[0], arp, frames[1]),
+		"pcapng":             pcapngFile(frames[0], arp, frames[1]),
+	}
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !IsPcap(file) {
+				t.Fatal("IsPcap() = false")
+			}
+			got, err := ReadUDP(bytes.NewReader(file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Packet{
+				{Src: client, Dst: server, Payload: []byte("discover")},
+				{Src: server, Dst: client, Payload: []byte("offer")},
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %v packets, want %v", len(got), len(want))
+			}
+			if got[0].Time.Unix() != 1646128800 || got[1].Time.Unix() != 1646128802 {
+				t.Fatalf("got times %v and %v", got[0].Time, got[1].Time)
+			}
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b time.Time) bool { return true })); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestReadUDPErrors(t *testing.T) {
+	if _, err := ReadUDP(bytes.NewReader([]byte("not a capture file at all"))); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("got %v, want %v", err, ErrUnknownFormat)
+	}
+	file := pcapFile(binary.LittleEndian, frame(&net.UDPAddr{IP: net.IPv4zero, Port: 68}, &net.UDPAddr{IP: net.IPv4bcast, Port: 67}, []byte("discover"), false))
+	if _, err := ReadUDP(bytes.NewReader(file[:len(file)-3])); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("got %v, want %v", err, ErrTruncated)
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/iana"
+	"sigs.k8s.io/yaml"
+)
+
+// maxArch is the upper bound used when looking up an architecture by name.
+// See https://www.iana.org/assignments/dhcpv6-parameters/dhcpv6-parameters.xhtml#processor-architecture
+const maxArch = 0xff
+
+// Bootfile holds the iPXE binary to serve for an architecture.
+// PXEClient and HTTPClient, when set, take precedence over Default for that client type (DHCP option 60).
+type Bootfile struct {
+	Default    string `json:"default,omitempty"`
+	PXEClient  string `json:"PXEClient,omitempty"`
+	HTTPClient string `json:"HTTPClient,omitempty"`
+}
+
+// BootfileMap maps hardware PXE architecture types to iPXE binary files.
+type BootfileMap map[iana.Arch]Bootfile
+
+// DefaultBootfiles returns a BootfileMap populated from ArchToBootFile.
+func DefaultBootfiles() BootfileMap {
+	b := make(BootfileMap, len(ArchToBootFile))
+	for arch, bin := range ArchToBootFile {
+		b[arch] = Bootfile{Default: bin}
+	}
+	return b
+}
+
+// Merge returns a new BootfileMap of b with the non empty values of over layered on top.
+func (b BootfileMap) Merge(over BootfileMap) BootfileMap {
+	merged := make(BootfileMap, len(b))
+	for arch, bf := range b {
+		merged[arch] = bf
+	}
+	for arch, bf := range over {
+		m := merged[arch]
+		if bf.Default != "" {
+			m.Default = bf.Default
+		}
+		if bf.PXEClient != "" {
+			m.PXEClient = bf.PXEClient
+		}
+		if bf.HTTPClient != "" {
+			m.HTTPClient = bf.HTTPClient
+		}
+		merged[arch] = m
+	}
+	return merged
+}
+
+// Lookup returns the iPXE binary for an architecture and client type (DHCP option 60).
+// A nil BootfileMap uses the defaults from ArchToBootFile.
+func (b BootfileMap) Lookup(arch iana.Arch, cType string) (string, bool) {
+	if b == nil {
+		bin, found := ArchToBootFile[arch]
+		return bin, found
+	}
+	bf, found := b[arch]
+	if !found {
+		return "", false
+	}
+	switch {
+	case cType == string(pxeClient) && bf.PXEClient != "":
+		return bf.PXEClient, true
+	case cType == string(httpClient) && bf.HTTPClient != "":
+		return bf.HTTPClient, true
+	case bf.Default != "":
+		return bf.Default, true
+	}
+	return "", false
+}
+
+// ParseBootfileMap parses a YAML or JSON document into a BootfileMap.
+// Keys are IANA architecture numbers or names (as shown by `proxydhcp binary`) and values
+// are either a binary name or an object keyed by client type. For example:
+//
+//	"7": ipxe.efi
+//	EFI ARM64: ipxe-arm64.efi
+//	"27":
+//	  PXEClient: ipxe-riscv64.efi
+//	  HTTPClient: ipxe-riscv64.efi
+func ParseBootfileMap(data []byte) (BootfileMap, error) {
+	raw := map[string]json.RawMessage{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	b := make(BootfileMap, len(raw))
+	for k, v := range raw {
+		arch, err := ParseArch(k)
+		if err != nil {
+			return nil, err
+		}
+		var bin string
+		if err := json.Unmarshal(v, &bin); err == nil {
+			b[arch] = Bootfile{Default: bin}
+			continue
+		}
+		bf := Bootfile{}
+		dec := json.NewDecoder(strings.NewReader(string(v)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&bf); err != nil {
+			return nil, fmt.Errorf("arch %q: value must be a binary name or an object with default, PXEClient and/or HTTPClient keys: %w", k, err)
+		}
+		b[arch] = bf
+	}
+	return b, nil
+}
+
+// ParseArch returns the architecture for an IANA architecture number or name.
+// Name matching is case insensitive.
+func ParseArch(s string) (iana.Arch, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseUint(s, 10, 16); err == nil {
+		return iana.Arch(n), nil
+	}
+	for i := 0; i <= maxArch; i++ {
+		if strings.EqualFold(iana.Arch(i).String(), s) {
+			return iana.Arch(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown architecture %q", s)
+}
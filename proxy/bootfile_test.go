@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+func TestParseBootfileMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    BootfileMap
+		wantErr bool
+	}{
+		{
+			name: "success yaml",
+			data: `
+"7": ipxe-x86_64.efi
+EFI ARM64: ipxe-arm64.efi
+"27":
+  PXEClient: ipxe-riscv64.efi
+  HTTPClient: ipxe-riscv64-http.efi
+`,
+			want: BootfileMap{
+				iana.EFI_X86_64:  {Default: "ipxe-x86_64.efi"},
+				iana.EFI_ARM64:   {Default: "ipxe-arm64.efi"},
+				iana.EFI_RISCV64: {PXEClient: "ipxe-riscv64.efi", HTTPClient: "ipxe-riscv64-http.efi"},
+			},
+		},
+		{
+			name: "success json",
+			data: `{"efi arm64 boot from http": {"default": "ipxe-arm64.efi"}}`,
+			want: BootfileMap{iana.EFI_ARM64_HTTP: {Default: "ipxe-arm64.efi"}},
+		},
+		{
+			name:    "failure unknown arch name",
+			data:    `not an arch: ipxe.efi`,
+			wantErr: true,
+		},
+		{
+			name:    "failure unknown client type",
+			data:    `{"7": {"BIOSClient": "ipxe.efi"}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBootfileMap([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBootfileMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); !tt.wantErr && diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestBootfileMapLookup(t *testing.T) {
+	custom := DefaultBootfiles().Merge(BootfileMap{
+		iana.EFI_ARM64:   {Default: "ipxe-arm64.efi", HTTPClient: "ipxe-arm64-http.efi"},
+		iana.EFI_RISCV64: {PXEClient: "ipxe-riscv64.efi"},
+	})
+	tests := []struct {
+		name      string
+		bootfiles BootfileMap
+		arch      iana.Arch
+		cType     clientType
+		want      string
+		wantFound bool
+	}{
+		{name: "nil map uses defaults", arch: iana.EFI_X86_64, cType: pxeClient, want: "ipxe.efi", wantFound: true},
+		{name: "default kept after merge", bootfiles: custom, arch: iana.INTEL_X86PC, cType: pxeClient, want: "undionly.kpxe", wantFound: true},
+		{name: "default overridden", bootfiles: custom, arch: iana.EFI_ARM64, cType: pxeClient, want: "ipxe-arm64.efi", wantFound: true},
+		{name: "client type specific", bootfiles: custom, arch: iana.EFI_ARM64, cType: httpClient, want: "ipxe-arm64-http.efi", wantFound: true},
+		{name: "new arch", bootfiles: custom, arch: iana.EFI_RISCV64, cType: pxeClient, want: "ipxe-riscv64.efi", wantFound: true},
+		{name: "new arch without a binary for client type", bootfiles: custom, arch: iana.EFI_RISCV64, cType: httpClient},
+		{name: "not found", bootfiles: custom, arch: iana.UBOOT_ARM32, cType: pxeClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := tt.bootfiles.Lookup(tt.arch, string(tt.cType))
+			if found != tt.wantFound {
+				t.Fatalf("Lookup() found = %v, want %v", found, tt.wantFound)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
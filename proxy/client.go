@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// Client describes the machine that sent a PXE request. It is what ClientResolver backends get to make a Decision.
+type Client struct {
+	// MAC is the hardware address of the client.
+	MAC net.HardwareAddr
+	// Arch is the client system architecture (DHCP option 93, DHCPv6 option 61).
+	Arch iana.Arch
+	// UserClass is DHCP option 77 (DHCPv6 option 15).
+	UserClass string
+	// VendorClass is DHCP option 60 (DHCPv6 option 16), i.e. "PXEClient:Arch:00007:UNDI:003016".
+	VendorClass string
+	// GUID is the client machine identifier (DHCP option 97 or a DHCPv6 DUID-UUID) as a lower case UUID string.
+	GUID string
+	// MessageType is the DHCP message type of the request, i.e. "DISCOVER".
+	MessageType string
+	// Relay is the relay agent information. It is nil when the request was not relayed.
+	Relay *RelayInfo
+	// Interface is the name of the network interface the request was received on, when known.
+	Interface string
+	// ListenAddr is the local address the request was received on.
+	ListenAddr string
+	// Peer is the address the request was received from.
+	Peer string
+}
+
+// RelayInfo is the relay agent information of a relayed request.
+// See https://www.rfc-editor.org/rfc/rfc3046.html and https://www.rfc-editor.org/rfc/rfc8415.html#section-9
+type RelayInfo struct {
+	// GatewayAddr is the giaddr header or, for DHCPv6, the link-address of the relay agent closest to the client.
+	GatewayAddr net.IP
+	// CircuitID is DHCP option 82 sub-option 1 (DHCPv6 option 18, interface-id).
+	CircuitID []byte
+	// RemoteID is DHCP option 82 sub-option 2 (DHCPv6 option 37).
+	RemoteID []byte
+	// LinkSelection is DHCP option 82 sub-option 5.
+	LinkSelection net.IP
+	// SubscriberID is DHCP option 82 sub-option 6 (DHCPv6 option 38).
+	SubscriberID []byte
+}
+
+// newClient returns the Client for a DHCP request.
+func (h *Handler) newClient(m *dhcpv4.DHCPv4, mach machine, conn net.PacketConn, peer net.Addr) Client {
+	c := Client{
+		MAC:         mach.mac,
+		Arch:        mach.arch,
+		UserClass:   string(mach.uClass),
+		VendorClass: string(m.GetOneOption(dhcpv4.OptionClassIdentifier)),
+		MessageType: m.MessageType().String(),
+		Interface:   h.Interface,
+		ListenAddr:  conn.LocalAddr().String(),
+		Peer:        peer.String(),
+	}
+	// option 97 is a type byte (0) followed by the 16 byte GUID.
+	if opt97 := m.GetOneOption(dhcpv4.OptionClientMachineIdentifier); len(opt97) == 17 {
+		c.GUID = formatGUID(opt97[1:])
+	}
+	rai := m.RelayAgentInfo()
+	if (m.GatewayIPAddr == nil || m.GatewayIPAddr.IsUnspecified()) && rai == nil {
+		return c
+	}
+	c.Relay = &RelayInfo{GatewayAddr: m.GatewayIPAddr}
+	if rai != nil {
+		c.Relay.CircuitID = rai.Get(dhcpv4.AgentCircuitIDSubOption)
+		c.Relay.RemoteID = rai.Get(dhcpv4.AgentRemoteIDSubOption)
+		c.Relay.SubscriberID = rai.Get(dhcpv4.SubscriberIDSubOption)
+		if ls := rai.Get(dhcpv4.LinkSelectionSubOption); len(ls) == net.IPv4len {
+			c.Relay.LinkSelection = net.IP(ls)
+		}
+	}
+	return c
+}
+
+// newClient6 returns the Client for a DHCPv6 request.
+func (h *Handler) newClient6(m dhcpv6.DHCPv6, msg *dhcpv6.Message, mach machine, conn net.PacketConn, peer net.Addr) Client {
+	c := Client{
+		MAC:         mach.mac,
+		Arch:        mach.arch,
+		UserClass:   string(mach.uClass),
+		MessageType: msg.Type().String(),
+		Interface:   h.Interface,
+		ListenAddr:  conn.LocalAddr().String(),
+		Peer:        peer.String(),
+	}
+	if vc := vendorClass(msg); vc != nil && len(vc.Data) > 0 {
+		c.VendorClass = string(vc.Data[0])
+	}
+	if cid := msg.Options.ClientID(); cid != nil && cid.Type == dhcpv6.DUID_UUID {
+		c.GUID = formatGUID(cid.Uuid)
+	}
+	relay, ok := m.(*dhcpv6.RelayMessage)
+	if !ok {
+		return c
+	}
+	// the relay agent closest to the client is the innermost relay message.
+	for {
+		inner, ok := relay.Options.RelayMessage().(*dhcpv6.RelayMessage)
+		if !ok {
+			break
+		}
+		relay = inner
+	}
+	c.Relay = &RelayInfo{
+		GatewayAddr: relay.LinkAddr,
+		CircuitID:   relay.Options.InterfaceID(),
+	}
+	if rid := relay.Options.RemoteID(); rid != nil {
+		c.Relay.RemoteID = rid.RemoteID
+	}
+	if sid := relay.GetOneOption(dhcpv6.OptionRelayAgentSubscriberID); sid != nil {
+		c.Relay.SubscriberID = sid.ToBytes()
+	}
+	return c
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+func TestNewClient(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	guid := []byte{0x00, 0x4c, 0x4c, 0x45, 0x44, 0x00, 0x42, 0x35, 0x10, 0x80, 0x52, 0xb7, 0xc0, 0x4f, 0x4e, 0x37, 0x32}
+	tests := map[string]struct {
+		mods []dhcpv4.Modifier
+		want *RelayInfo
+	}{
+		"not relayed": {},
+		"relayed": {
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithGatewayIP(net.IP{192, 168, 1, 1}),
+				dhcpv4.WithOption(dhcpv4.OptRelayAgentInfo(
+					dhcpv4.OptGeneric(dhcpv4.AgentCircuitIDSubOption, []byte("eth0/1")),
+					dhcpv4.OptGeneric(dhcpv4.AgentRemoteIDSubOption, []byte("switch1")),
+					dhcpv4.OptGeneric(dhcpv4.LinkSelectionSubOption, []byte{10, 0, 0, 0}),
+					dhcpv4.OptGeneric(dhcpv4.SubscriberIDSubOption, []byte("sub")),
+				)),
+			},
+			want: &RelayInfo{
+				GatewayAddr:   net.IP{192, 168, 1, 1},
+				CircuitID:     []byte("eth0/1"),
+				RemoteID:      []byte("switch1"),
+				LinkSelection: net.IP{10, 0, 0, 0},
+				SubscriberID:  []byte("sub"),
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mods := append([]dhcpv4.Modifier{
+				dhcpv4.WithMessageType(dhcpv4.MessageTypeDiscover),
+				dhcpv4.WithHwAddr(mac),
+				dhcpv4.WithGeneric(dhcpv4.OptionClassIdentifier, []byte("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithGeneric(dhcpv4.OptionClientMachineIdentifier, guid),
+			}, tt.mods...)
+			m, err := dhcpv4.New(mods...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := &Handler{Interface: "eth0"}
+			mach := machine{mac: mac, arch: iana.EFI_X86_64, uClass: IPXE, cType: pxeClient}
+			got := h.newClient(m, mach, &recordConn{}, &net.UDPAddr{IP: net.IPv4bcast, Port: 68})
+			want := Client{
+				MAC:         mac,
+				Arch:        iana.EFI_X86_64,
+				UserClass:   string(IPXE),
+				VendorClass: "PXEClient:Arch:00007:UNDI:003016",
+				GUID:        "4c4c4544-0042-3510-8052-b7c04f4e3732",
+				MessageType: "DISCOVER",
+				Relay:       tt.want,
+				Interface:   "eth0",
+				ListenAddr:  "[::]:547",
+				Peer:        "255.255.255.255:68",
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/go-logr/logr"
+	"inet.af/netaddr"
+)
+
+// Reasons for a Decision. Backends are free to use their own.
+const (
+	// ReasonAllowed is used when a machine is allowed to PXE boot.
+	ReasonAllowed = "allowed"
+	// ReasonDenied is used when an Allower does not allow a machine to PXE boot.
+	ReasonDenied = "denied"
+	// ReasonNotFound is used when the backend has no record of the mac address.
+	ReasonNotFound = "hardware not found"
+	// ReasonPXEDisabled is used when the hardware record has netboot.allow_pxe set to false.
+	ReasonPXEDisabled = "allow_pxe is false"
+	// ReasonBackendError is used when the backend failed to make a decision.
+	ReasonBackendError = "backend error"
+	// ReasonRelayDenied is used when a RelayRule does not allow a machine to PXE boot.
+	ReasonRelayDenied = "denied by relay rule"
+)
+
+// ErrorPolicy is what the Handler does when the Allower fails to make a decision.
+type ErrorPolicy string
+
+const (
+	// PolicyDeny replies to the client with a not-allowed boot file.
+	PolicyDeny ErrorPolicy = "deny"
+	// PolicyAllow replies to the client as if it is allowed to PXE boot.
+	PolicyAllow ErrorPolicy = "allow"
+	// PolicyIgnore does not reply to the client.
+	PolicyIgnore ErrorPolicy = "ignore"
+)
+
+// Resolver is an optional extension of the Allower interface for backends that know more about a machine
+// than whether it is allowed to PXE boot. When the Handler's Allower also implements Resolver, Resolve is used instead of Allow.
+type Resolver interface {
+	// Resolve returns the boot Decision for the mac address.
+	// An error means the backend could not make a decision, the Handler's ErrorPolicy determines what happens then.
+	Resolve(ctx context.Context, mac net.HardwareAddr) (Decision, error)
+}
+
+// ClientResolver is an optional extension of the Allower interface for backends that want everything known
+// about the client to make a Decision. It takes precedence over Resolver.
+type ClientResolver interface {
+	// ResolveClient returns the boot Decision for the client.
+	ResolveClient(ctx context.Context, c Client) (Decision, error)
+}
+
+// GUIDResolver is an optional extension of the Allower interface for backends that can find a machine by its
+// client machine identifier (DHCP option 97 or a DHCPv6 DUID-UUID). It is used when the mac address is not found.
+type GUIDResolver interface {
+	// ResolveGUID returns the boot Decision for the GUID, formatted as a lower case UUID string.
+	ResolveGUID(ctx context.Context, guid string) (Decision, error)
+}
+
+// Decision is how a single machine should network boot.
+// Zero values mean the Handler's settings are used.
+type Decision struct {
+	// Allow is true if the mac address is allowed to PXE boot.
+	Allow bool
+	// Reason is a short human readable explanation of the verdict, i.e. ReasonNotFound.
+	Reason string
+	// Source is the name of the backend that made the decision.
+	Source string
+	// Bootfile is the iPXE binary to serve instead of the one mapped to the machine's architecture.
+	Bootfile string
+	// IPXEScriptURL is the full URL of the iPXE script to serve instead of IPXEAddr/<mac>/IPXEScript.
+	IPXEScriptURL *url.URL
+	// TFTPAddr is the TFTP server to use for this machine.
+	TFTPAddr netaddr.IPPort
+	// HTTPAddr is the HTTP server to use for this machine.
+	HTTPAddr netaddr.IPPort
+	// IPXEAddr is the URL from which iPXE binaries (HTTP clients) and scripts are served for this machine.
+	IPXEAddr *url.URL
+	// NextServer is the siaddr DHCP header (IP address of next server) to use for this machine.
+	NextServer net.IP
+	// Rule is the name of the RelayRule that matched the request, if any.
+	Rule string
+}
+
+// Resolve returns the boot Decision for a client from an Allower, using the richest interface the Allower implements:
+// ClientResolver, then Resolver and finally Allower. When the mac address is not found, the GUID is tried if the Allower is a GUIDResolver.
+func Resolve(ctx context.Context, a Allower, c Client) (Decision, error) {
+	if r, ok := a.(ClientResolver); ok {
+		return r.ResolveClient(ctx, c)
+	}
+	if r, ok := a.(Resolver); ok {
+		d, err := r.Resolve(ctx, c.MAC)
+		if g, ok := a.(GUIDResolver); ok && err == nil && d.Reason == ReasonNotFound && c.GUID != "" {
+			return g.ResolveGUID(ctx, c.GUID)
+		}
+		return d, err
+	}
+	d := Decision{Allow: a.Allow(ctx, c.MAC), Reason: ReasonDenied, Source: fmt.Sprintf("%T", a)}
+	if d.Allow {
+		d.Reason = ReasonAllowed
+	}
+	return d, nil
+}
+
+// decide returns the boot Decision for a client, applying the Handler's RelayRules and,
+// when the Allower fails, its ErrorPolicy. The returned bool is false when the client should not get a reply.
+// The error is the Allower's, it is for logs and Events only: the Decision's Reason is sent to the client.
+func (h *Handler) decide(ctx context.Context, log logr.Logger, c Client) (Decision, bool, error) {
+	rule := h.RelayRules.match(c)
+	if rule != nil && rule.Deny {
+		log.Info("relay rule does not allow PXE boot", "rule", rule.Name)
+		return rule.deny(), true, nil
+	}
+	d, ok, err := h.resolve(ctx, log, c)
+	if ok && rule != nil {
+		d = rule.apply(d)
+	}
+	return d, ok, err
+}
+
+// resolve returns the Allower's boot Decision for a client, applying the Handler's ErrorPolicy when the Allower fails.
+// The Reason of a failed Allower's Decision is only ReasonBackendError, its error can hold internal addresses.
+func (h *Handler) resolve(ctx context.Context, log logr.Logger, c Client) (Decision, bool, error) {
+	d, err := Resolve(ctx, h.Allower, c)
+	if err == nil {
+		return d, true, nil
+	}
+	switch h.ErrorPolicy {
+	case PolicyIgnore:
+		log.Error(err, "backend failed to make a boot decision, ignoring packet", "policy", PolicyIgnore)
+		return Decision{}, false, err
+	case PolicyAllow:
+		log.Error(err, "backend failed to make a boot decision, allowing PXE boot", "policy", PolicyAllow)
+		return Decision{Allow: true, Reason: ReasonBackendError, Source: d.Source}, true, err
+	default:
+		log.Error(err, "backend failed to make a boot decision, not allowing PXE boot", "policy", PolicyDeny)
+		return Decision{Reason: ReasonBackendError, Source: d.Source}, true, err
+	}
+}
+
+// formatGUID returns a 16 byte GUID as a lower case UUID string, or an empty string if b is not 16 bytes.
+// The bytes are formatted in the order they are received.
+func formatGUID(b []byte) string {
+	if len(b) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
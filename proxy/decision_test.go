@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"inet.af/netaddr"
+)
+
+// errResolver is a Resolver that always fails.
+type errResolver struct {
+	AllowAll
+}
+
+func (errResolver) Resolve(_ context.Context, _ net.HardwareAddr) (Decision, error) {
+	return Decision{Source: "test"}, errors.New("unavailable")
+}
+
+// guidResolver is a Resolver that doesn't know any mac address and allows a single GUID.
+type guidResolver struct {
+	AllowAll
+	guid string
+}
+
+func (guidResolver) Resolve(_ context.Context, _ net.HardwareAddr) (Decision, error) {
+	return Decision{Reason: ReasonNotFound, Source: "test"}, nil
+}
+
+func (g guidResolver) ResolveGUID(_ context.Context, guid string) (Decision, error) {
+	if guid == g.guid {
+		return Decision{Allow: true, Reason: ReasonAllowed, Source: "test"}, nil
+	}
+	return Decision{Reason: ReasonNotFound, Source: "test"}, nil
+}
+
+// denyAll is an Allower that never allows PXE booting.
+type denyAll struct{}
+
+func (denyAll) Allow(_ context.Context, _ net.HardwareAddr) bool {
+	return false
+}
+
+func TestDecide(t *testing.T) {
+	tests := map[string]struct {
+		allower     Allower
+		policy      ErrorPolicy
+		guid        string
+		want        Decision
+		wantRespond bool
+		wantErr     string
+	}{
+		"allower allowed":     {allower: AllowAll{}, want: Decision{Allow: true, Reason: ReasonAllowed, Source: "proxy.AllowAll"}, wantRespond: true},
+		"allower denied":      {allower: denyAll{}, want: Decision{Reason: ReasonDenied, Source: "proxy.denyAll"}, wantRespond: true},
+		"error default deny":  {allower: errResolver{}, want: Decision{Reason: ReasonBackendError, Source: "test"}, wantRespond: true, wantErr: "unavailable"},
+		"error policy deny":   {allower: errResolver{}, policy: PolicyDeny, want: Decision{Reason: ReasonBackendError, Source: "test"}, wantRespond: true, wantErr: "unavailable"},
+		"error policy allow":  {allower: errResolver{}, policy: PolicyAllow, want: Decision{Allow: true, Reason: ReasonBackendError, Source: "test"}, wantRespond: true, wantErr: "unavailable"},
+		"error policy ignore": {allower: errResolver{}, policy: PolicyIgnore, want: Decision{}, wantErr: "unavailable"},
+		"guid fallback":       {allower: guidResolver{guid: "a"}, guid: "a", want: Decision{Allow: true, Reason: ReasonAllowed, Source: "test"}, wantRespond: true},
+		"guid not found":      {allower: guidResolver{guid: "a"}, guid: "b", want: Decision{Reason: ReasonNotFound, Source: "test"}, wantRespond: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := &Handler{Ctx: context.Background(), Allower: tt.allower, ErrorPolicy: tt.policy}
+			got, respond, err := h.decide(context.Background(), logr.Discard(), Client{MAC: net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}, GUID: tt.guid})
+			if respond != tt.wantRespond {
+				t.Fatalf("decide() respond = %v, want %v", respond, tt.wantRespond)
+			}
+			var gotErr string
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Fatalf("decide() error = %v, want %v", gotErr, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want, cmpopts.IgnoreUnexported(netaddr.IPPort{})); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestFormatGUID(t *testing.T) {
+	tests := map[string]struct {
+		in   []byte
+		want string
+	}{
+		"16 bytes":  {in: []byte{0x4c, 0x4c, 0x45, 0x44, 0x00, 0x42, 0x35, 0x10, 0x80, 0x52, 0xb7, 0xc0, 0x4f, 0x4e, 0x37, 0x32}, want: "4c4c4544-0042-3510-8052-b7c04f4e3732"},
+		"too short": {in: []byte{0x4c, 0x4c}},
+		"empty":     {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(formatGUID(tt.in), tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"github.com/jacobweinstock/proxydhcp/proxy/proxytest"
+	"inet.af/netaddr"
+)
+
+var (
+	e2eMAC    = net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	e2eListen = &net.UDPAddr{IP: net.IPv4(192, 168, 2, 5), Port: 67}
+	e2ePeer   = &net.UDPAddr{IP: net.IPv4zero, Port: 68}
+)
+
+func newE2EHandler(a proxy.Allower, opts ...proxy.Option) *proxy.Handler {
+	opts = append([]proxy.Option{
+		proxy.WithLogger(logr.Discard()),
+		proxy.WithAllower(a),
+		proxy.WithIPXEScript("auto.ipxe"),
+		proxy.WithInterface("eth0"),
+	}, opts...)
+	return proxy.NewHandler(
+		context.Background(),
+		netaddr.IPPortFrom(netaddr.MustParseIP("192.168.2.5"), 69),
+		netaddr.IPPortFrom(netaddr.MustParseIP("192.168.2.5"), 80),
+		&url.URL{Scheme: "http", Host: "192.168.2.5"},
+		opts...,
+	)
+}
+
+// exchange delivers m to conn and returns the reply, or nil when there is none within a short wait.
+func exchange(t *testing.T, conn *proxytest.Conn, m *dhcpv4.DHCPv4, wantReply bool) *dhcpv4.DHCPv4 {
+	t.Helper()
+	if err := conn.Deliver(e2ePeer, m.ToBytes()); err != nil {
+		t.Fatal(err)
+	}
+	timeout := 5 * time.Second
+	if !wantReply {
+		timeout = 100 * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	p, err := conn.Next(ctx)
+	if errors.Is(err, context.DeadlineExceeded) && !wantReply {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wantReply {
+		t.Fatalf("got a reply to %v, want none", m.MessageType())
+	}
+	reply, err := p.DHCPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestEndToEnd(t *testing.T) {
+	tests := []struct {
+		name         string
+		arch         iana.Arch
+		mods         []dhcpv4.Modifier
+		deny         bool
+		backendErr   error
+		wantReply    bool
+		wantBootfile string
+	}{
+		{name: "legacy bios", arch: iana.INTEL_X86PC, wantReply: true, wantBootfile: "00:01:02:03:04:05/undionly.kpxe"},
+		{name: "uefi x86_64", arch: iana.EFI_X86_64, wantReply: true, wantBootfile: "00:01:02:03:04:05/ipxe.efi"},
+		{name: "uefi arm64", arch: iana.EFI_ARM64, wantReply: true, wantBootfile: "00:01:02:03:04:05/snp.efi"},
+		{name: "uefi http boot", arch: iana.EFI_X86_64_HTTP, wantReply: true, wantBootfile: "http://192.168.2.5/00:01:02:03:04:05/ipxe.efi"},
+		{name: "built-in ipxe", arch: iana.EFI_X86_64, mods: []dhcpv4.Modifier{proxytest.WithUserClass(proxy.IPXE)}, wantReply: true, wantBootfile: "tftp://192.168.2.5:69/00:01:02:03:04:05/ipxe.efi"},
+		{name: "tinkerbell ipxe", arch: iana.EFI_X86_64, mods: []dhcpv4.Modifier{proxytest.WithUserClass(proxy.Tinkerbell)}, wantReply: true, wantBootfile: "http://192.168.2.5/00:01:02:03:04:05/auto.ipxe"},
+		{name: "denied", arch: iana.EFI_X86_64, deny: true, wantReply: true, wantBootfile: "/00:01:02:03:04:05/not-allowed"},
+		{name: "backend error", arch: iana.EFI_X86_64, backendErr: errors.New("backend down"), wantReply: true, wantBootfile: "/00:01:02:03:04:05/not-allowed"},
+		{name: "unknown arch", arch: iana.UBOOT_ARM32},
+		{name: "not pxe", arch: iana.EFI_X86_64, mods: []dhcpv4.Modifier{dhcpv4.WithOption(dhcpv4.OptClassIdentifier("MSFT 5.0"))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := proxytest.NewAllower()
+			if tt.deny {
+				a = proxytest.NewAllower(e2eMAC)
+			}
+			a.Err = tt.backendErr
+			conn := proxytest.Serve(t, newE2EHandler(a), e2eListen)
+
+			discover := proxytest.Discover(t, e2eMAC, tt.arch, tt.mods...)
+			offer := exchange(t, conn, discover, tt.wantReply)
+			if !tt.wantReply {
+				return
+			}
+			if offer.MessageType() != dhcpv4.MessageTypeOffer || offer.TransactionID != discover.TransactionID {
+				t.Fatalf("got %v %v, want OFFER %v", offer.MessageType(), offer.TransactionID, discover.TransactionID)
+			}
+			if offer.BootFileName != tt.wantBootfile {
+				t.Fatalf("bootfile = %q, want %q", offer.BootFileName, tt.wantBootfile)
+			}
+			// the backend's error can hold internal addresses, it is not broadcast to clients.
+			if tt.backendErr != nil && offer.Message() != proxy.ReasonBackendError {
+				t.Fatalf("option 56 = %q, want %q", offer.Message(), proxy.ReasonBackendError)
+			}
+
+			// PXE firmware follows up with a REQUEST to the boot server, it must get the same bootfile in an ACK.
+			ack := exchange(t, conn, proxytest.Request(t, offer, tt.arch, tt.mods...), true)
+			if ack.MessageType() != dhcpv4.MessageTypeAck || ack.BootFileName != tt.wantBootfile {
+				t.Fatalf("got %v %q, want ACK %q", ack.MessageType(), ack.BootFileName, tt.wantBootfile)
+			}
+
+			calls := a.Calls()
+			if len(calls) != 2 {
+				t.Fatalf("backend called %v times, want 2", len(calls))
+			}
+			if calls[0].MAC.String() != e2eMAC.String() || calls[0].Arch != tt.arch || calls[0].Interface != "eth0" {
+				t.Fatalf("backend called with %+v", calls[0])
+			}
+		})
+	}
+}
+
+func TestEndToEndErrorPolicyIgnore(t *testing.T) {
+	a := proxytest.NewAllower()
+	a.Err = errors.New("backend down")
+	conn := proxytest.Serve(t, newE2EHandler(a, proxy.WithErrorPolicy(proxy.PolicyIgnore)), e2eListen)
+
+	exchange(t, conn, proxytest.Discover(t, e2eMAC, iana.EFI_X86_64), false)
+	if n := len(a.Calls()); n != 1 {
+		t.Fatalf("backend called %v times, want 1", n)
+	}
+}
+
+func TestEndToEnd6(t *testing.T) {
+	a := proxytest.NewAllower()
+	h := newE2EHandler(a, proxy.WithDUID(dhcpv6.Duid{Type: dhcpv6.DUID_LL, HwType: iana.HWTypeEthernet, LinkLayerAddr: e2eMAC}))
+	conn := proxytest.Serve(t, h, &net.UDPAddr{IP: net.IPv6unspecified, Port: dhcpv6.DefaultServerPort})
+
+	solicit := proxytest.Solicit6(t, e2eMAC, iana.EFI_X86_64_HTTP)
+	if err := conn.Deliver(&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: dhcpv6.DefaultClientPort}, solicit.ToBytes()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := conn.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := p.DHCPv6()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Type() != dhcpv6.MessageTypeAdvertise {
+		t.Fatalf("got %v, want ADVERTISE", reply.Type())
+	}
+	if calls := a.Calls(); len(calls) != 1 || calls[0].Arch != iana.EFI_X86_64_HTTP {
+		t.Fatalf("backend called with %+v", calls)
+	}
+}
+
+func TestEndToEndBootMenu(t *testing.T) {
+	menu := &proxy.BootMenu{
+		Prompt:  "Press F8 for the boot menu",
+		Timeout: 10,
+		Items: []proxy.BootItem{
+			{Type: 0x8000, Description: "iPXE"},
+			{Type: 0x8001, Description: "memtest", Bootfile: "memtest86+.bin", Servers: []net.IP{net.IPv4(192, 168, 2, 6)}},
+			{Type: proxy.BootTypeLocal, Description: "local disk"},
+		},
+	}
+	tests := []struct {
+		name         string
+		arch         iana.Arch
+		item         uint16
+		wantReply    bool
+		wantMenu     bool
+		wantBootfile string
+		wantServer   net.IP
+	}{
+		{name: "menu offered", arch: iana.INTEL_X86PC, wantReply: true, wantMenu: true, wantServer: net.IPv4(192, 168, 2, 5)},
+		{name: "ipxe chosen", arch: iana.INTEL_X86PC, item: 0x8000, wantReply: true, wantBootfile: "00:01:02:03:04:05/undionly.kpxe", wantServer: net.IPv4(192, 168, 2, 5)},
+		{name: "memtest chosen", arch: iana.INTEL_X86PC, item: 0x8001, wantReply: true, wantBootfile: "memtest86+.bin", wantServer: net.IPv4(192, 168, 2, 6)},
+		{name: "unknown item", arch: iana.INTEL_X86PC, item: 0x8002},
+		{name: "uefi is not offered the menu", arch: iana.EFI_X86_64, wantReply: true, wantBootfile: "00:01:02:03:04:05/ipxe.efi", wantServer: net.IPv4(192, 168, 2, 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := proxytest.Serve(t, newE2EHandler(proxytest.NewAllower(), proxy.WithBootMenu(menu)), &net.UDPAddr{IP: net.IPv4(192, 168, 2, 5), Port: 4011})
+
+			var mods []dhcpv4.Modifier
+			if tt.item != 0 {
+				mods = append(mods, proxytest.WithBootItem(tt.item))
+			}
+			discover := proxytest.Discover(t, e2eMAC, tt.arch)
+			offer, err := dhcpv4.NewReplyFromRequest(discover, dhcpv4.WithServerIP(net.IPv4(192, 168, 2, 5)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply := exchange(t, conn, proxytest.Request(t, offer, tt.arch, mods...), tt.wantReply)
+			if !tt.wantReply {
+				return
+			}
+			if reply.BootFileName != tt.wantBootfile || !reply.ServerIPAddr.Equal(tt.wantServer) {
+				t.Fatalf("got bootfile %q from %v, want %q from %v", reply.BootFileName, reply.ServerIPAddr, tt.wantBootfile, tt.wantServer)
+			}
+			opt43 := dhcpv4.Options{}
+			if err := opt43.FromBytes(reply.GetOneOption(dhcpv4.OptionVendorSpecificInformation)); err != nil {
+				t.Fatal(err)
+			}
+			if got := opt43.Has(dhcpv4.GenericOptionCode(9)); got != tt.wantMenu {
+				t.Fatalf("boot menu (option 43.9) sent = %v, want %v", got, tt.wantMenu)
+			}
+			if tt.item != 0 {
+				if diff := cmp.Diff(opt43.Get(dhcpv4.GenericOptionCode(71)), []byte{byte(tt.item >> 8), byte(tt.item), 0, 0}); diff != "" {
+					t.Fatal(diff)
+				}
+			}
+		})
+	}
+}
+
+func TestEndToEndRelayed(t *testing.T) {
+	relay := &net.UDPAddr{IP: net.IPv4(10, 20, 0, 1), Port: 67}
+	relayed := func(broadcast bool) dhcpv4.Modifier {
+		return func(m *dhcpv4.DHCPv4) {
+			m.GatewayIPAddr = relay.IP
+			m.HopCount = 1
+			if broadcast {
+				m.SetBroadcast()
+			} else {
+				m.SetUnicast()
+			}
+		}
+	}
+	tests := []struct {
+		name      string
+		port      int
+		broadcast bool
+	}{
+		{name: "port 67", port: 67},
+		{name: "port 67 broadcast bit", port: 67, broadcast: true},
+		{name: "port 4011", port: 4011},
+		{name: "port 4011 broadcast bit", port: 4011, broadcast: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := proxytest.Serve(t, newE2EHandler(proxytest.NewAllower()), &net.UDPAddr{IP: net.IPv4(192, 168, 2, 5), Port: tt.port})
+			send := func(m *dhcpv4.DHCPv4) *dhcpv4.DHCPv4 {
+				t.Helper()
+				if err := conn.Deliver(relay, m.ToBytes()); err != nil {
+					t.Fatal(err)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				p, err := conn.Next(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// the relay agent forwards the reply to the client, it must be sent to the relay's server port.
+				if p.Addr.String() != relay.String() {
+					t.Fatalf("reply sent to %v, want the relay agent %v", p.Addr, relay)
+				}
+				reply, err := p.DHCPv4()
+				if err != nil {
+					t.Fatal(err)
+				}
+				// the client has no address and a proxyDHCP reply has no yiaddr, the relay agent must broadcast it.
+				if !reply.GatewayIPAddr.Equal(relay.IP) || !reply.IsBroadcast() {
+					t.Fatalf("got giaddr %v broadcast %v, want %v true", reply.GatewayIPAddr, reply.IsBroadcast(), relay.IP)
+				}
+				return reply
+			}
+
+			offer := send(proxytest.Discover(t, e2eMAC, iana.EFI_X86_64, relayed(tt.broadcast)))
+			if offer.MessageType() != dhcpv4.MessageTypeOffer {
+				t.Fatalf("got %v, want OFFER", offer.MessageType())
+			}
+			ack := send(proxytest.Request(t, offer, iana.EFI_X86_64, relayed(tt.broadcast)))
+			if ack.MessageType() != dhcpv4.MessageTypeAck || ack.BootFileName != offer.BootFileName {
+				t.Fatalf("got %v %q, want ACK %q", ack.MessageType(), ack.BootFileName, offer.BootFileName)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/insomniacslk/dhcp/iana"
 )
 
@@ -22,6 +23,24 @@ var (
 	ErrUnknownArch = fmt.Errorf("could not determine client architecture from option 93")
 	// ErrInvalidHandler is used when validation of the Handler struct fails.
 	ErrInvalidHandler = fmt.Errorf("handler validation failed")
+	// ErrOpt16Missing is used when the option 16 (vendor class) is missing from a DHCPv6 PXE request.
+	ErrOpt16Missing = fmt.Errorf("not a valid PXE request, missing option 16")
+	// ErrOpt61Missing is used when the option 61 (client architecture) is missing from a DHCPv6 PXE request.
+	ErrOpt61Missing = fmt.Errorf("not a valid PXE request, missing option 61")
+	// ErrClientIDMissing is used when the option 1 (client identifier) is missing from a DHCPv6 request.
+	ErrClientIDMissing = fmt.Errorf("not a valid DHCPv6 request, missing option 1")
+	// ErrServerIDMismatch is used when a DHCPv6 request is addressed to a different server (option 2).
+	ErrServerIDMismatch = fmt.Errorf("DHCPv6 request is not addressed to this server, option 2 does not match")
+	// ErrInvalidBootMenu is used when a BootMenu can't be sent to PXE firmware.
+	ErrInvalidBootMenu = fmt.Errorf("invalid boot menu")
+	// ErrInvalidRelayRule is used when RelayRules can't be used to match requests.
+	ErrInvalidRelayRule = fmt.Errorf("invalid relay rule")
+	// ErrInvalidSubnet is used when Subnets can't be used to choose boot servers.
+	ErrInvalidSubnet = fmt.Errorf("invalid subnet")
+	// ErrNoIPv4Addr is used when a listen address is not an IPv4 address or a network interface with one.
+	ErrNoIPv4Addr = fmt.Errorf("not an IPv4 address or a network interface with an IPv4 address")
+	// ErrNoInterface is used when a listen address is not the address of any network interface.
+	ErrNoInterface = fmt.Errorf("no network interface has the address")
 )
 
 // ErrIgnorePacket is for when a DHCP packet should be ignored.
@@ -36,7 +55,7 @@ func (e ErrIgnorePacket) Error() string {
 }
 
 // ErrArchNotFound is for when an PXE client request is an architecture that does not have a matching bootfile.
-// See var ArchToBootFile for the look ups.
+// See var ArchToBootFile and type BootfileMap for the look ups.
 type ErrArchNotFound struct {
 	Arch   iana.Arch
 	Detail string
@@ -66,3 +85,45 @@ type ErrInvalidOption60 struct {
 func (e ErrInvalidOption60) Error() string {
 	return fmt.Sprintf("not a valid PXE request (option 60 does not start with PXEClient or HTTPClient: %q)", e.Opt60)
 }
+
+// ErrInvalidMsgType6 is used when the message type is not a valid DHCPv6 message type [SOLICIT, REQUEST, INFORMATION-REQUEST].
+type ErrInvalidMsgType6 struct {
+	Invalid dhcpv6.MessageType
+}
+
+// Error returns the string representation of ErrInvalidMsgType6.
+func (e ErrInvalidMsgType6) Error() string {
+	return fmt.Sprintf("must be a DHCPv6 message of type [SOLICIT, REQUEST, INFORMATION-REQUEST], %q", e.Invalid)
+}
+
+// ErrInvalidOption16 is used when the option 16 is not a valid PXE request [PXEClient, HTTPClient].
+type ErrInvalidOption16 struct {
+	Opt16 string
+}
+
+// Error returns the string representation of ErrInvalidOption16.
+func (e ErrInvalidOption16) Error() string {
+	return fmt.Sprintf("not a valid PXE request (option 16 does not start with PXEClient or HTTPClient: %q)", e.Opt16)
+}
+
+// ErrNoMAC6 is used when a mac address cannot be found in a DHCPv6 request.
+type ErrNoMAC6 struct {
+	Detail string
+}
+
+// Error returns the string representation of ErrNoMAC6.
+func (e ErrNoMAC6) Error() string {
+	return fmt.Sprintf("unable to determine client mac address from DUID or relay info: details %v", e.Detail)
+}
+
+// ErrBootItemNotFound is used when a boot server REQUEST (option 43 sub-option 71) is for a boot server type
+// or layer that is not in the BootMenu.
+type ErrBootItemNotFound struct {
+	Type  uint16
+	Layer uint16
+}
+
+// Error returns the string representation of ErrBootItemNotFound.
+func (e ErrBootItemNotFound) Error() string {
+	return fmt.Sprintf("boot menu has no boot server type %d layer %d", e.Type, e.Layer)
+}
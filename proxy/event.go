@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Outcome is what the Handler did with a packet.
+type Outcome string
+
+const (
+	// OutcomeOffer is a DHCPv4 OFFER or DHCPv6 ADVERTISE reply to an allowed client.
+	OutcomeOffer Outcome = "offer"
+	// OutcomeAck is a DHCPv4 ACK or DHCPv6 REPLY to an allowed client.
+	OutcomeAck Outcome = "ack"
+	// OutcomeDenied is a reply to a client that is not allowed to PXE boot.
+	OutcomeDenied Outcome = "denied"
+	// OutcomeIgnored is a packet that got no reply.
+	OutcomeIgnored Outcome = "ignored"
+)
+
+// Reasons a packet is ignored that don't come from an error type, see IgnoreReason.
+const (
+	IgnoreNotBootRequest = "not_boot_request"
+	IgnoreBadPacket      = "bad_packet"
+	IgnoreBackendError   = "backend_error"
+	IgnoreSendFailed     = "send_failed"
+	IgnoreOther          = "other"
+)
+
+// Event describes a packet the Handler processed.
+type Event struct {
+	// Time is when the packet was received.
+	Time time.Time
+	// Listener is the port the packet was received on, i.e. "67", "4011" or "547".
+	Listener string
+	// Interface is the name of the network interface the Handler receives packets on, when known.
+	Interface string
+	// Peer is the address the packet was received from.
+	Peer net.Addr
+	// GatewayAddr is the giaddr header or, for DHCPv6, the link-address of the relay agent closest to the client.
+	// It is nil when the packet was not relayed.
+	GatewayAddr net.IP
+	// MAC is the client's mac address.
+	MAC net.HardwareAddr
+	// TransactionID is the DHCP transaction id (xid) as hex.
+	TransactionID string
+	// MessageType is the DHCP message type received.
+	MessageType string
+	// Arch is the client architecture (option 93 or DHCPv6 option 61), empty if it could not be determined.
+	Arch string
+	// ClientType is PXEClient or HTTPClient.
+	ClientType string
+	// UserClass is the client's user class (option 77 or DHCPv6 option 15).
+	UserClass string
+	// Outcome is what the Handler did with the packet.
+	Outcome Outcome
+	// IgnoreReason is why the packet was ignored, see IgnoreReason.
+	IgnoreReason string
+	// Err is the error the packet was ignored for, or the backend error a Decision was made by the ErrorPolicy for, if any.
+	Err error
+	// Decision is the boot decision from the Allower.
+	Decision Decision
+	// Bootfile is the boot file sent to the client.
+	Bootfile string
+	// NextServer is the siaddr header sent to a DHCPv4 client, the server the client downloads the Bootfile from.
+	NextServer net.IP
+	// Script is true when the client was sent the iPXE script instead of an iPXE binary.
+	Script bool
+	// BackendDuration is how long the Allower took to make the Decision.
+	BackendDuration time.Duration
+	// Duration is how long the Handler took to process the packet.
+	Duration time.Duration
+	// Request is the packet received.
+	Request Packet
+	// Reply is the packet sent, nil if the packet was ignored.
+	Reply Packet
+}
+
+// Packet is a DHCPv4 or DHCPv6 packet.
+type Packet interface {
+	// Summary returns the packet, with its options decoded, in a human readable form.
+	Summary() string
+}
+
+// Observer is notified of every packet the Handler processes, i.e. to record metrics.
+// Observe is called synchronously from the packet handling goroutine and must not block.
+type Observer interface {
+	Observe(Event)
+}
+
+// IgnoreReason returns a short, stable name for why a packet was ignored, derived from the proxy error types.
+func IgnoreReason(err error) string {
+	var (
+		msgType   ErrInvalidMsgType
+		msgType6  ErrInvalidMsgType6
+		opt60     ErrInvalidOption60
+		opt16     ErrInvalidOption16
+		arch      ErrArchNotFound
+		noMAC6    ErrNoMAC6
+		bootItem  ErrBootItemNotFound
+		ignorePkt ErrIgnorePacket
+	)
+	switch {
+	case errors.As(err, &msgType), errors.As(err, &msgType6), errors.As(err, &ignorePkt):
+		return "invalid_message_type"
+	case errors.Is(err, ErrOpt60Missing):
+		return "option60_missing"
+	case errors.As(err, &opt60):
+		return "option60_invalid"
+	case errors.Is(err, ErrOpt93Missing):
+		return "option93_missing"
+	case errors.Is(err, ErrOpt94Missing):
+		return "option94_missing"
+	case errors.Is(err, ErrOpt97LeadingByteError), errors.Is(err, ErrOpt97WrongSize):
+		return "option97_invalid"
+	case errors.Is(err, ErrOpt16Missing):
+		return "option16_missing"
+	case errors.As(err, &opt16):
+		return "option16_invalid"
+	case errors.Is(err, ErrOpt61Missing):
+		return "option61_missing"
+	case errors.Is(err, ErrClientIDMissing):
+		return "client_id_missing"
+	case errors.Is(err, ErrServerIDMismatch):
+		return "server_id_mismatch"
+	case errors.Is(err, ErrUnknownArch):
+		return "unknown_arch"
+	case errors.As(err, &arch):
+		return "arch_not_found"
+	case errors.As(err, &noMAC6):
+		return "no_mac"
+	case errors.As(err, &bootItem):
+		return "boot_item_not_found"
+	}
+	return IgnoreOther
+}
+
+// NotPXE returns true if the packet was ignored because it is not from a PXE client: it is not a BOOTREQUEST,
+// a message type PXE clients don't send, or has no option 60 (DHCPv6 option 16) PXEClient or HTTPClient.
+// It is false for a PXE client's packet that was ignored for any other reason, i.e. an invalid option 93 or 97.
+func (e Event) NotPXE() bool {
+	if e.Outcome != OutcomeIgnored {
+		return false
+	}
+	switch e.IgnoreReason {
+	case IgnoreNotBootRequest, "option60_missing", "option60_invalid", "option16_missing", "option16_invalid":
+		return true
+	}
+	// not ErrIgnorePacket, that is a PXE client's message that is not meant for this server.
+	var (
+		msgType  ErrInvalidMsgType
+		msgType6 ErrInvalidMsgType6
+	)
+	return errors.As(e.Err, &msgType) || errors.As(e.Err, &msgType6)
+}
+
+// ignore marks the Event as ignored for reason. err is optional.
+func (e *Event) ignore(reason string, err error) {
+	e.Outcome = OutcomeIgnored
+	e.IgnoreReason = reason
+	e.Err = err
+}
+
+// replied marks the Event as replied to, ack is true for a DHCPv4 ACK or DHCPv6 REPLY.
+func (e *Event) replied(d Decision, ack bool, bootfile string, script bool) {
+	e.Bootfile, e.Script = bootfile, script
+	switch {
+	case !d.Allow:
+		e.Outcome = OutcomeDenied
+	case ack:
+		e.Outcome = OutcomeAck
+	default:
+		e.Outcome = OutcomeOffer
+	}
+}
+
+// observe sends the Event to all of the Handler's Observers.
+func (h *Handler) observe(e Event) {
+	if len(h.Observers) == 0 {
+		return
+	}
+	e.Duration = time.Since(e.Time)
+	for _, o := range h.Observers {
+		o.Observe(e)
+	}
+}
+
+// listener returns the port of a listening address.
+func listener(addr net.Addr) string {
+	if u, ok := addr.(*net.UDPAddr); ok {
+		return strconv.Itoa(u.Port)
+	}
+	if addr == nil {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return port
+}
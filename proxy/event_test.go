@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"inet.af/netaddr"
+)
+
+func TestIgnoreReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: ErrInvalidMsgType{Invalid: dhcpv4.MessageTypeInform}, want: "invalid_message_type"},
+		{err: ErrInvalidMsgType6{Invalid: dhcpv6.MessageTypeRenew}, want: "invalid_message_type"},
+		{err: ErrOpt60Missing, want: "option60_missing"},
+		{err: ErrInvalidOption60{Opt60: "nope"}, want: "option60_invalid"},
+		{err: fmt.Errorf("wrapped: %w", ErrOpt93Missing), want: "option93_missing"},
+		{err: ErrOpt97WrongSize, want: "option97_invalid"},
+		{err: ErrServerIDMismatch, want: "server_id_mismatch"},
+		{err: ErrArchNotFound{Arch: iana.Arch(255)}, want: "arch_not_found"},
+		{err: ErrNoMAC6{}, want: "no_mac"},
+		{err: fmt.Errorf("something else"), want: IgnoreOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := IgnoreReason(tt.err); got != tt.want {
+				t.Fatalf("IgnoreReason(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// recordObserver records the last Event.
+type recordObserver struct {
+	event Event
+}
+
+func (r *recordObserver) Observe(e Event) {
+	r.event = e
+}
+
+func TestObserve(t *testing.T) {
+	obs := &recordObserver{}
+	h := NewHandler(
+		context.Background(),
+		netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::5"), 69),
+		netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::4"), 80),
+		&url.URL{Scheme: "http", Host: "[2001:db8::3]:8080"},
+		WithDUID(testDUID6),
+		WithInterface("eth0"),
+		WithObserver(obs),
+	)
+	tests := []struct {
+		name       string
+		mods       []dhcpv6.Modifier
+		wantResult Outcome
+		wantReason string
+	}{
+		{
+			name:       "ignored",
+			wantResult: OutcomeIgnored,
+			wantReason: "option16_missing",
+		},
+		{
+			name: "offer",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("PXEClient:Arch:00007:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64),
+			},
+			wantResult: OutcomeOffer,
+		},
+		{
+			name: "ack",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("PXEClient:Arch:00007:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64),
+				dhcpv6.WithRapidCommit,
+			},
+			wantResult: OutcomeAck,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.Redirection6(&recordConn{}, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: dhcpv6.DefaultClientPort}, newSolicit6(t, tt.mods...))
+			e := obs.event
+			if e.Outcome != tt.wantResult || e.IgnoreReason != tt.wantReason {
+				t.Fatalf("got outcome %q reason %q, want outcome %q reason %q", e.Outcome, e.IgnoreReason, tt.wantResult, tt.wantReason)
+			}
+			if e.Listener != "547" || e.Interface != "eth0" || e.MessageType != dhcpv6.MessageTypeSolicit.String() {
+				t.Fatalf("got listener %q interface %q message type %q", e.Listener, e.Interface, e.MessageType)
+			}
+		})
+	}
+}
+
+func TestEventNotPXE(t *testing.T) {
+	tests := []struct {
+		name string
+		e    Event
+		want bool
+	}{
+		{name: "offer", e: Event{Outcome: OutcomeOffer}},
+		{name: "not a boot request", e: Event{Outcome: OutcomeIgnored, IgnoreReason: IgnoreNotBootRequest}, want: true},
+		{name: "no option 60", e: Event{Outcome: OutcomeIgnored, IgnoreReason: IgnoreReason(ErrOpt60Missing), Err: ErrOpt60Missing}, want: true},
+		{name: "DHCPv6 no option 16", e: Event{Outcome: OutcomeIgnored, IgnoreReason: IgnoreReason(ErrOpt16Missing), Err: ErrOpt16Missing}, want: true},
+		{name: "message type", e: Event{Outcome: OutcomeIgnored, IgnoreReason: "invalid_message_type", Err: ErrInvalidMsgType{Invalid: dhcpv4.MessageTypeInform}}, want: true},
+		{name: "PXE message for another server", e: Event{Outcome: OutcomeIgnored, IgnoreReason: "invalid_message_type", Err: ErrIgnorePacket{PacketType: dhcpv4.MessageTypeRequest}}},
+		{name: "PXE client without option 93", e: Event{Outcome: OutcomeIgnored, IgnoreReason: IgnoreReason(ErrOpt93Missing), Err: ErrOpt93Missing}},
+		{name: "backend error", e: Event{Outcome: OutcomeIgnored, IgnoreReason: IgnoreBackendError}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.e.NotPXE(); got != tt.want {
+				t.Fatalf("NotPXE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
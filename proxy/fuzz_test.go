@@ -0,0 +1,163 @@
+//go:build go1.18
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/jacobweinstock/proxydhcp/pcap"
+	"inet.af/netaddr"
+)
+
+// minMaxMessageSize is the largest DHCP message every client must accept, a 576 byte IP datagram minus the
+// IP and UDP headers. See https://www.rfc-editor.org/rfc/rfc2131.html#section-2
+const minMaxMessageSize = 576 - 28
+
+// seedCaptures adds the DHCP payloads of the replay captures, synthetic samples and any real captures, to the seed corpus.
+func seedCaptures(f *testing.F) {
+	f.Helper()
+	captures, err := filepath.Glob(filepath.Join(replayDir, "*.pcap*"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, c := range captures {
+		r, err := os.Open(c)
+		if err != nil {
+			f.Fatal(err)
+		}
+		pkts, err := pcap.ReadUDP(r)
+		r.Close()
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, p := range pkts {
+			f.Add(p.Payload)
+		}
+	}
+}
+
+// maxReplySize returns the largest reply a client accepts, based on its maximum message size (option 57).
+// Relay agents remove option 82 before forwarding the reply, so it does not count towards the limit.
+func maxReplySize(m *dhcpv4.DHCPv4) int {
+	limit := minMaxMessageSize
+	if opt57 := m.GetOneOption(dhcpv4.OptionMaximumDHCPMessageSize); len(opt57) == 2 {
+		if size := int(binary.BigEndian.Uint16(opt57)) - 28; size > limit {
+			limit = size
+		}
+	}
+	if opt82 := m.GetOneOption(dhcpv4.OptionRelayAgentInformation); opt82 != nil {
+		// long options are split into 255 byte chunks, each with a 2 byte header.
+		limit += len(opt82) + 2*(len(opt82)/255+1)
+	}
+	return limit
+}
+
+func FuzzRedirection(f *testing.F) {
+	seedCaptures(f)
+	h := NewHandler(
+		context.Background(),
+		netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 5), 69),
+		netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 4), 80),
+		&url.URL{Scheme: "http", Host: "192.168.2.3"},
+		WithLogger(logr.Discard()),
+	)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := dhcpv4.FromBytes(data)
+		if err != nil {
+			return
+		}
+		for _, port := range []int{dhcpv4.ServerPort, 4011} {
+			conn := &replayConn{local: &net.UDPAddr{IP: net.IPv4zero, Port: port}}
+			h.Redirection(conn, &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}, m)
+			if len(conn.writes) == 0 {
+				continue
+			}
+			b := conn.writes[0]
+			if limit := maxReplySize(m); len(b) > limit {
+				t.Fatalf("reply is %d bytes, the client accepts at most %d", len(b), limit)
+			}
+			reply, err := dhcpv4.FromBytes(b)
+			if err != nil {
+				t.Fatalf("reply can't be decoded: %v", err)
+			}
+			if reply.TransactionID != m.TransactionID {
+				t.Fatalf("reply xid %v, want %v", reply.TransactionID, m.TransactionID)
+			}
+			for _, opt := range []dhcpv4.OptionCode{dhcpv4.OptionRelayAgentInformation, dhcpv4.OptionClientMachineIdentifier} {
+				if got, want := reply.GetOneOption(opt), m.GetOneOption(opt); !bytes.Equal(got, want) {
+					t.Fatalf("%v not mirrored: got %x, want %x", opt, got, want)
+				}
+			}
+		}
+	})
+}
+
+func FuzzRedirection6(f *testing.F) {
+	f.Add(newSolicit6(f, withVendorClass6("PXEClient:Arch:00007:UNDI:003016")).ToBytes())
+	h := NewHandler(
+		context.Background(),
+		netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::5"), 69),
+		netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::4"), 80),
+		&url.URL{Scheme: "http", Host: "[2001:db8::3]:8080"},
+		WithDUID(testDUID6),
+		WithLogger(logr.Discard()),
+	)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := dhcpv6.FromBytes(data)
+		if err != nil {
+			return
+		}
+		conn := &recordConn{}
+		h.Redirection6(conn, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: dhcpv6.DefaultClientPort}, m)
+		if conn.written == nil {
+			return
+		}
+		if _, err := dhcpv6.FromBytes(conn.written); err != nil {
+			t.Fatalf("reply can't be decoded: %v", err)
+		}
+	})
+}
+
+func FuzzSetOpt97(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(append([]byte{0}, bytes.Repeat([]byte{0xab}, 16)...))
+	f.Add(append([]byte{1}, bytes.Repeat([]byte{0xab}, 16)...))
+	f.Fuzz(func(t *testing.T, guid []byte) {
+		rp := replyPacket{DHCPv4: &dhcpv4.DHCPv4{Options: dhcpv4.Options{}}, log: logr.Discard()}
+		err := rp.setOpt97(guid)
+		valid := len(guid) == 0 || (len(guid) == 17 && guid[0] == 0)
+		if valid != (err == nil) {
+			t.Fatalf("setOpt97(%x) = %v", guid, err)
+		}
+		if err == nil && !bytes.Equal(rp.GetOneOption(dhcpv4.OptionClientMachineIdentifier), guid) {
+			t.Fatalf("option 97 is %x, want %x", rp.GetOneOption(dhcpv4.OptionClientMachineIdentifier), guid)
+		}
+	})
+}
+
+func FuzzSetOpt43(f *testing.F) {
+	f.Add([]byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05})
+	f.Add([]byte{0xdc, 0xa6, 0x32, 0x01, 0x02, 0x03})
+	f.Fuzz(func(t *testing.T, hw []byte) {
+		rp := replyPacket{DHCPv4: &dhcpv4.DHCPv4{Options: dhcpv4.Options{}}, log: logr.Discard()}
+		rp.setOpt43(net.HardwareAddr(hw))
+		opts := dhcpv4.Options{}
+		if err := opts.FromBytes(rp.GetOneOption(dhcpv4.OptionVendorSpecificInformation)); err != nil {
+			t.Fatalf("option 43 can't be decoded: %v", err)
+		}
+		// PXE boot server discovery control, bypass discovery and boot from the filename.
+		if !bytes.Equal(opts.Get(dhcpv4.GenericOptionCode(6)), []byte{8}) {
+			t.Fatalf("option 43 sub-option 6 is %x, want 08", opts.Get(dhcpv4.GenericOptionCode(6)))
+		}
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/go-playground/validator/v10"
 	"github.com/hashicorp/go-multierror"
+	"github.com/insomniacslk/dhcp/dhcpv6"
 	"inet.af/netaddr"
 )
 
@@ -36,6 +37,27 @@ type Handler struct {
 	// When found, this allow us to stop serving iPXE binaries for PXE client requests and serve an iPXE script.
 	UserClass string `validate:""`
 	Allower   Allower
+	// DUID is the DHCPv6 server identifier (option 2) used in DHCPv6 replies.
+	DUID dhcpv6.Duid
+	// BootfileParams are the DHCPv6 boot file parameters (option 60) sent to DHCPv6 clients.
+	BootfileParams []string
+	// Bootfiles maps architectures to iPXE binaries. When nil, ArchToBootFile is used.
+	Bootfiles BootfileMap
+	// Interface is the name of the network interface the Handler receives requests on, it is passed to ClientResolver backends.
+	Interface string
+	// ErrorPolicy is what to do when the Allower fails to make a decision. The default is PolicyDeny.
+	ErrorPolicy ErrorPolicy `validate:"omitempty,oneof=deny allow ignore"`
+	// BootMenu, when set, is offered to PXE firmware instead of a bootfile. See BootMenu.
+	BootMenu *BootMenu
+	// RelayRules choose how relayed requests boot based on their relay agent information. See RelayRules.
+	RelayRules RelayRules
+	// Subnets choose the boot servers of a client by the subnet it is in. See Subnets.
+	Subnets Subnets
+	// InterfaceAddrs are the addresses of Interface that place clients that were not relayed in a subnet.
+	// NewHandler resolves them when Subnets has an entry with a CIDR.
+	InterfaceAddrs []net.IP
+	// Observers are notified of every packet the Handler processes.
+	Observers []Observer
 }
 
 // Option for setting Handler values.
@@ -61,6 +83,51 @@ func WithAllower(a Allower) Option {
 	return func(h *Handler) { h.Allower = a }
 }
 
+// WithDUID sets the DHCPv6 server identifier for the Handler struct.
+func WithDUID(d dhcpv6.Duid) Option {
+	return func(h *Handler) { h.DUID = d }
+}
+
+// WithBootfileParams sets the DHCPv6 boot file parameters for the Handler struct.
+func WithBootfileParams(p ...string) Option {
+	return func(h *Handler) { h.BootfileParams = p }
+}
+
+// WithBootfiles sets the architecture to iPXE binary mapping for the Handler struct.
+func WithBootfiles(b BootfileMap) Option {
+	return func(h *Handler) { h.Bootfiles = b }
+}
+
+// WithErrorPolicy sets what the Handler does when the Allower fails to make a decision.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(h *Handler) { h.ErrorPolicy = p }
+}
+
+// WithInterface sets the name of the network interface the Handler receives requests on.
+func WithInterface(name string) Option {
+	return func(h *Handler) { h.Interface = name }
+}
+
+// WithBootMenu sets the PXE boot menu offered to PXE firmware.
+func WithBootMenu(m *BootMenu) Option {
+	return func(h *Handler) { h.BootMenu = m }
+}
+
+// WithRelayRules sets the rules that choose how relayed requests boot.
+func WithRelayRules(r RelayRules) Option {
+	return func(h *Handler) { h.RelayRules = r }
+}
+
+// WithSubnets sets the boot servers per subnet.
+func WithSubnets(s Subnets) Option {
+	return func(h *Handler) { h.Subnets = s }
+}
+
+// WithObserver adds an Observer that is notified of every packet the Handler processes.
+func WithObserver(o Observer) Option {
+	return func(h *Handler) { h.Observers = append(h.Observers, o) }
+}
+
 // AllowAll is a default implementation of the Allower interface that will always return true for the Allow method.
 type AllowAll struct{}
 
@@ -83,9 +150,55 @@ func NewHandler(ctx context.Context, tAddr, hAddr netaddr.IPPort, ipxeAddr *url.
 	for _, opt := range opts {
 		opt(defaultHandler)
 	}
+	if defaultHandler.Subnets.hasCIDR() {
+		defaultHandler.InterfaceAddrs = interfaceAddrs(defaultHandler.Interface)
+	}
 	return defaultHandler
 }
 
+// bootServers returns the TFTP, HTTP and iPXE locations for a client, the Handler's unless overridden by the Subnets entry
+// of the client and then by the Decision.
+func (h *Handler) bootServers(d Decision, c Client) (tftp netaddr.IPPort, http netaddr.IPPort, ipxe *url.URL) {
+	tftp, http, ipxe = h.TFTPAddr, h.HTTPAddr, h.IPXEAddr
+	if len(h.Subnets) > 0 {
+		var loc []net.IP
+		// only the default entry can match a client that can't be placed.
+		if h.Subnets.hasCIDR() {
+			loc = h.location(c)
+		}
+		if sn := h.Subnets.lookup(loc); sn != nil {
+			if sn.TFTPAddr.IsValid() {
+				tftp = sn.TFTPAddr
+			}
+			if sn.HTTPAddr.IsValid() {
+				http = sn.HTTPAddr
+			}
+			if sn.IPXEAddr != nil {
+				ipxe = sn.IPXEAddr
+			}
+		}
+	}
+	if d.TFTPAddr.IsValid() {
+		tftp = d.TFTPAddr
+	}
+	if d.HTTPAddr.IsValid() {
+		http = d.HTTPAddr
+	}
+	if d.IPXEAddr != nil {
+		ipxe = d.IPXEAddr
+	}
+	return tftp, http, ipxe
+}
+
+// bootfiles returns the architecture to iPXE binary mapping for a machine.
+// A Decision with a Bootfile overrides the mapping for the machine's architecture.
+func (h *Handler) bootfiles(mach machine, d Decision) BootfileMap {
+	if d.Bootfile != "" {
+		return BootfileMap{mach.arch: {Default: d.Bootfile}}
+	}
+	return h.Bootfiles
+}
+
 func validateHandler(h *Handler) error {
 	v := validator.New()
 	v.RegisterCustomTypeFunc(validateIPPORT, netaddr.IPPort{})
@@ -36,9 +36,9 @@ func (r replyPacket) setSNAME(reqOpt60 []byte, tftp net.IP, http net.IP) {
 }
 
 // setBootfile sets the setBootfile (file) dhcp header. see https://datatracker.ietf.org/doc/html/rfc2131#section-2 .
-func (r replyPacket) setBootfile(mach machine, customUC string, tftp netaddr.IPPort, ipxe *url.URL, iscript string) error {
+func (r replyPacket) setBootfile(mach machine, bf BootfileMap, customUC string, tftp netaddr.IPPort, ipxe *url.URL, iscript string) error {
 	// set bootfile header
-	bin, found := ArchToBootFile[mach.arch]
+	bin, found := bf.Lookup(mach.arch, string(mach.cType))
 	if !found {
 		return ErrArchNotFound{Arch: mach.arch}
 	}
@@ -46,7 +46,7 @@ func (r replyPacket) setBootfile(mach machine, customUC string, tftp netaddr.IPP
 	// If a machine is in an ipxe boot loop, it is likely to be that we arent matching on IPXE or Tinkerbell.
 	// if the "iPXE" user class is found it means we arent in our custom version of ipxe, but because of the option 43 we're setting we need to give a full tftp url from which to boot.
 	switch { // order matters here.
-	case mach.uClass == Tinkerbell, (customUC != "" && mach.uClass == UserClass(customUC)): // this case gets us out of an ipxe boot loop.
+	case mach.inIPXE(customUC): // this case gets us out of an ipxe boot loop.
 		bootfile = fmt.Sprintf("%s/%s/%s", ipxe, mach.mac.String(), iscript)
 	case mach.cType == httpClient: // Check the client type from option 60.
 		bootfile = fmt.Sprintf("%s/%s/%s", ipxe, mach.mac.String(), bin)
@@ -100,6 +100,7 @@ func TestSetBootfile(t *testing.T) {
 	tests := []struct {
 		name             string
 		mach             machine
+		bootfiles        BootfileMap
 		customUClass     string
 		tftp             netaddr.IPPort
 		ipxe             *url.URL
@@ -135,6 +136,13 @@ func TestSetBootfile(t *testing.T) {
 			wantBootFileName: fmt.Sprintf("http://127.0.0.1/%v/snp.efi", mac.String()),
 			wantErr:          nil,
 		},
+		{
+			name:             "success - client type specific binary",
+			mach:             machine{mac: mac, arch: iana.EFI_ARM64, cType: pxeClient},
+			bootfiles:        DefaultBootfiles().Merge(BootfileMap{iana.EFI_ARM64: {PXEClient: "ipxe-arm64.efi"}}),
+			wantBootFileName: fmt.Sprintf("%v/ipxe-arm64.efi", mac.String()),
+			wantErr:          nil,
+		},
 		{
 			name:    "failure - no architecture found",
 			mach:    machine{mac: mac, arch: iana.UBOOT_ARM32},
@@ -147,7 +155,7 @@ func TestSetBootfile(t *testing.T) {
 				DHCPv4: &dhcpv4.DHCPv4{},
 				log:    logr.Discard(),
 			}
-			err := reply.setBootfile(tt.mach, tt.customUClass, tt.tftp, tt.ipxe, tt.iscript)
+			err := reply.setBootfile(tt.mach, tt.bootfiles, tt.customUClass, tt.tftp, tt.ipxe, tt.iscript)
 			if err != nil {
 				if diff := cmp.Diff(err, tt.wantErr); diff != "" {
 					t.Fatalf(diff)
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// Step is the result of one of the checks Redirection makes on a packet.
+type Step struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Inspection explains how the Handler handles a DHCPv4 packet.
+type Inspection struct {
+	// Steps are the checks made on the packet, in order. They stop at the first check that fails.
+	Steps []Step `json:"steps"`
+	// Machine is the client as detected from the packet, nil if the packet is not from a PXE client.
+	Machine *Machine `json:"machine,omitempty"`
+	// Event is what Redirection did with the packet.
+	Event Event `json:"-"`
+	// Reply is the packet Redirection sent, nil if the packet was ignored.
+	Reply *dhcpv4.DHCPv4 `json:"-"`
+	// Log is everything Redirection logged while handling the packet, at all verbosity levels.
+	Log []string `json:"log"`
+}
+
+// Machine is the client a packet is from.
+type Machine struct {
+	MAC        string `json:"mac"`
+	Arch       string `json:"arch"`
+	ArchID     int    `json:"archID"`
+	ClientType string `json:"clientType"`
+	UserClass  string `json:"userClass,omitempty"`
+	// InIPXE is true when the client is running our iPXE binary and is sent the iPXE script.
+	InIPXE bool `json:"inIPXE"`
+}
+
+// Inspect runs a packet through Redirection without sending the reply, and explains each step.
+// listen is the local address the packet is treated as received on (the port is the listener, 67 or 4011)
+// and peer is the address it is treated as received from.
+// The Allower is asked for a boot decision, so Inspect is meant to be used with an offline Allower.
+func (h *Handler) Inspect(m *dhcpv4.DHCPv4, listen, peer net.Addr) Inspection {
+	in := Inspection{Steps: h.steps(m)}
+	if mach, err := processMachine(m); err == nil {
+		in.Machine = &Machine{
+			MAC:        mach.mac.String(),
+			Arch:       mach.arch.String(),
+			ArchID:     int(mach.arch),
+			ClientType: string(mach.cType),
+			UserClass:  string(mach.uClass),
+			InIPXE:     mach.inIPXE(h.UserClass),
+		}
+	}
+
+	obs := &lastEvent{}
+	ih := *h
+	ih.Observers = []Observer{obs}
+	ih.Log = funcr.New(func(prefix, args string) {
+		in.Log = append(in.Log, strings.TrimSpace(prefix+" "+args))
+	}, funcr.Options{Verbosity: 1})
+	conn := &captureConn{local: listen}
+	ih.Redirection(conn, peer, m)
+	in.Event = obs.event
+	if len(conn.written) > 0 {
+		in.Reply, _ = dhcpv4.FromBytes(conn.written)
+	}
+
+	// the Allower is asked for a decision once all checks, other than the bootfile lookup, pass.
+	decided := true
+	for _, s := range in.Steps {
+		decided = decided && (s.OK || s.Name == "bootfile")
+	}
+	if decided {
+		d := in.Event.Decision
+		detail := fmt.Sprintf("allow=%v reason=%q source=%q", d.Allow, d.Reason, d.Source)
+		if d.Rule != "" {
+			detail += fmt.Sprintf(" rule=%q", d.Rule)
+		}
+		if in.Event.Err != nil && in.Event.IgnoreReason == "" {
+			detail += fmt.Sprintf(" error=%q", in.Event.Err)
+		}
+		in.Steps = append(in.Steps, Step{Name: "decision", OK: d.Allow, Detail: detail})
+	}
+	switch {
+	case in.Reply != nil:
+		in.Steps = append(in.Steps, Step{Name: "reply", OK: true, Detail: fmt.Sprintf("%v with bootfile %q", in.Reply.MessageType(), in.Reply.BootFileName)})
+	case in.Event.IgnoreReason != "":
+		detail := in.Event.IgnoreReason
+		if in.Event.Err != nil {
+			detail = fmt.Sprintf("%v: %v", detail, in.Event.Err)
+		}
+		in.Steps = append(in.Steps, Step{Name: "reply", Detail: "ignored, " + detail})
+	}
+	return in
+}
+
+// steps runs the checks Redirection makes before asking the Allower for a decision.
+func (h *Handler) steps(m *dhcpv4.DHCPv4) []Step {
+	var steps []Step
+	add := func(name string, err error, detail string) bool {
+		s := Step{Name: name, OK: err == nil, Detail: detail}
+		if err != nil {
+			s.Detail = err.Error()
+		}
+		steps = append(steps, s)
+		return err == nil
+	}
+	var err error
+	if m.OpCode != dhcpv4.OpcodeBootRequest {
+		err = fmt.Errorf("opcode is %v, not %v", m.OpCode, dhcpv4.OpcodeBootRequest)
+	}
+	if !add("opcode", err, m.OpCode.String()) {
+		return steps
+	}
+	rp := replyPacket{DHCPv4: &dhcpv4.DHCPv4{Options: dhcpv4.Options{}}, log: logr.Discard()}
+	if !add("validatePXE", rp.validatePXE(m), "PXE client, "+string(m.GetOneOption(dhcpv4.OptionClassIdentifier))) {
+		return steps
+	}
+	if !add("messageType", rp.setMessageType(m), fmt.Sprintf("%v, reply is %v", m.MessageType(), rp.MessageType())) {
+		return steps
+	}
+	mach, err := processMachine(m)
+	var detail string
+	if !add("processMachine", err, fmt.Sprintf("arch=%q (%d) clientType=%v userClass=%q", mach.arch, mach.arch, mach.cType, mach.uClass)) {
+		return steps
+	}
+	rp.setOpt43(m.ClientHWAddr)
+	detail = subOptions(rp.GetOneOption(dhcpv4.OptionVendorSpecificInformation))
+	if h.BootMenu.offered(mach) {
+		detail = "boot menu, when allowed"
+		if typ, layer, ok := bootItem(m); ok {
+			detail = fmt.Sprintf("boot server REQUEST for type %d layer %d", typ, layer)
+		}
+	}
+	add("option43", nil, detail)
+	opt97 := m.GetOneOption(dhcpv4.OptionClientMachineIdentifier)
+	detail = "not set"
+	if len(opt97) == 17 {
+		detail = formatGUID(opt97[1:])
+	}
+	if !add("option97", rp.setOpt97(opt97), detail) {
+		return steps
+	}
+	bin, found := h.bootfiles(mach, Decision{}).Lookup(mach.arch, string(mach.cType))
+	if found {
+		detail = fmt.Sprintf("iPXE binary %q", bin)
+	} else {
+		err = ErrArchNotFound{Arch: mach.arch}
+	}
+	if mach.inIPXE(h.UserClass) {
+		detail = fmt.Sprintf("in iPXE (user class %q), iPXE script", mach.uClass)
+	}
+	add("bootfile", err, detail)
+	return steps
+}
+
+// subOptions formats encapsulated options, i.e. option 43, as "code=hex" pairs.
+func subOptions(b []byte) string {
+	opts := dhcpv4.Options{}
+	if err := opts.FromBytes(b); err != nil {
+		return fmt.Sprintf("%x", b)
+	}
+	codes := make([]int, 0, len(opts))
+	for c := range opts {
+		codes = append(codes, int(c))
+	}
+	sort.Ints(codes)
+	out := make([]string, 0, len(codes))
+	for _, c := range codes {
+		out = append(out, fmt.Sprintf("%d=%x", c, opts[uint8(c)]))
+	}
+	return strings.Join(out, " ")
+}
+
+// lastEvent is an Observer that keeps the last Event.
+type lastEvent struct {
+	event Event
+}
+
+func (l *lastEvent) Observe(e Event) {
+	l.event = e
+}
+
+// captureConn is a net.PacketConn that keeps the last packet written instead of sending it.
+type captureConn struct {
+	net.PacketConn
+	local   net.Addr
+	written []byte
+}
+
+func (c *captureConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	c.written = append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (c *captureConn) LocalAddr() net.Addr {
+	return c.local
+}
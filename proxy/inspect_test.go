@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"inet.af/netaddr"
+)
+
+func TestInspect(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	tests := []struct {
+		name        string
+		mods        []dhcpv4.Modifier
+		decision    Decision
+		wantSteps   []string
+		wantFailed  string
+		wantMachine bool
+		wantReply   string
+	}{
+		{
+			name: "offer",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithGeneric(dhcpv4.OptionClassIdentifier, []byte("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, []byte{1, 2, 1}),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)),
+			},
+			decision:    Decision{Allow: true, Reason: ReasonAllowed},
+			wantSteps:   []string{"opcode", "validatePXE", "messageType", "processMachine", "option43", "option97", "bootfile", "decision", "reply"},
+			wantMachine: true,
+			wantReply:   "00:01:02:03:04:05/ipxe.efi",
+		},
+		{
+			name: "denied",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithGeneric(dhcpv4.OptionClassIdentifier, []byte("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, []byte{1, 2, 1}),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)),
+			},
+			decision:    Decision{Reason: ReasonNotFound},
+			wantSteps:   []string{"opcode", "validatePXE", "messageType", "processMachine", "option43", "option97", "bootfile", "decision", "reply"},
+			wantFailed:  "decision",
+			wantMachine: true,
+			wantReply:   "/00:01:02:03:04:05/not-allowed",
+		},
+		{
+			name:       "not a PXE client",
+			wantSteps:  []string{"opcode", "validatePXE", "reply"},
+			wantFailed: "validatePXE",
+		},
+		{
+			name: "unknown arch",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithGeneric(dhcpv4.OptionClassIdentifier, []byte("PXEClient:Arch:00021:UNDI:003016")),
+				dhcpv4.WithGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, []byte{1, 2, 1}),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.UBOOT_ARM32)),
+			},
+			decision:    Decision{Allow: true, Reason: ReasonAllowed},
+			wantSteps:   []string{"opcode", "validatePXE", "messageType", "processMachine", "option43", "option97", "bootfile", "decision", "reply"},
+			wantFailed:  "bootfile",
+			wantMachine: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(
+				context.Background(),
+				netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 5), 69),
+				netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 4), 80),
+				&url.URL{Scheme: "http", Host: "192.168.2.3"},
+				WithAllower(resolver{d: tt.decision}),
+			)
+			m, err := dhcpv4.New(append([]dhcpv4.Modifier{dhcpv4.WithMessageType(dhcpv4.MessageTypeDiscover), dhcpv4.WithHwAddr(mac)}, tt.mods...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := h.Inspect(m, &net.UDPAddr{IP: net.IPv4zero, Port: 67}, &net.UDPAddr{IP: net.IPv4bcast, Port: 68})
+
+			var names []string
+			for _, s := range in.Steps {
+				names = append(names, s.Name)
+				if s.Name == tt.wantFailed && s.OK {
+					t.Fatalf("step %v: got ok, want failed", s.Name)
+				}
+				if s.Name != tt.wantFailed && s.Name != "reply" && !s.OK {
+					t.Fatalf("step %v failed: %v", s.Name, s.Detail)
+				}
+			}
+			if diff := cmp.Diff(tt.wantSteps, names); diff != "" {
+				t.Fatal(diff)
+			}
+			if (in.Machine != nil) != tt.wantMachine {
+				t.Fatalf("got machine %+v", in.Machine)
+			}
+			switch {
+			case tt.wantReply == "" && in.Reply != nil:
+				t.Fatalf("got reply %v, want none", in.Reply.Summary())
+			case tt.wantReply != "" && (in.Reply == nil || in.Reply.BootFileName != tt.wantReply):
+				t.Fatalf("got reply %+v, want bootfile %v", in.Reply, tt.wantReply)
+			}
+			if len(in.Log) == 0 {
+				t.Fatal("expected the Handler's log to be captured")
+			}
+		})
+	}
+}
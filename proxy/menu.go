@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"sigs.k8s.io/yaml"
+)
+
+// PXE vendor options, DHCP option 43 sub-options. See section 2.4 of http://www.pix.net/software/pxeboot/archive/pxespec.pdf
+const (
+	pxeDiscoveryControl = 6
+	pxeMulticastAddr    = 7
+	pxeBootServers      = 8
+	pxeBootMenu         = 9
+	pxeMenuPrompt       = 10
+	pxeBootItem         = 71
+)
+
+// PXE_DISCOVERY_CONTROL bits.
+const (
+	// disableBroadcast stops the client from broadcasting its boot server REQUEST.
+	disableBroadcast = 1 << 0
+	// disableMulticast stops the client from multicasting its boot server REQUEST.
+	disableMulticast = 1 << 1
+	// serverListOnly makes the client only use and accept boot servers from PXE_BOOT_SERVERS.
+	serverListOnly = 1 << 2
+	// bypassDiscovery makes the client download the bootfile of the OFFER instead of doing boot server discovery.
+	bypassDiscovery = 1 << 3
+)
+
+// BootTypeLocal is the boot server type of a BootItem that boots from the local disk.
+// PXE firmware does not contact a boot server when it is chosen.
+const BootTypeLocal = 0
+
+// firstVendorBootType is the first vendor specific boot server type, it is used for items without a type.
+const firstVendorBootType = 0x8000
+
+// BootMenu is a PXE boot menu, offered with boot server discovery (DHCP option 43 sub-options 6 to 10)
+// instead of a bootfile. The firmware shows the menu and sends a REQUEST for the chosen BootItem to port 4011
+// of one of its boot servers, the reply to that REQUEST has the bootfile.
+type BootMenu struct {
+	// Prompt is shown, with a countdown of Timeout seconds, before the menu, i.e. "Press F8 for the boot menu".
+	Prompt string `json:"prompt,omitempty"`
+	// Timeout is the number of seconds Prompt is shown before the first item is booted.
+	// 0 boots the first item without showing the menu and 255 waits for a key press.
+	Timeout uint8 `json:"timeout,omitempty"`
+	// Items are the menu entries, in display order.
+	Items []BootItem `json:"items"`
+	// MulticastAddr, when set, enables multicast boot server discovery on this address (sub-option 7).
+	MulticastAddr net.IP `json:"multicastAddr,omitempty"`
+	// Archs are the architectures that are offered the menu. Defaults to legacy BIOS (iana.INTEL_X86PC),
+	// UEFI firmware mostly ignores boot menus.
+	Archs []iana.Arch `json:"-"`
+}
+
+// BootItem is an entry of a BootMenu, a PXE boot server type.
+type BootItem struct {
+	// Type is the boot server type, BootTypeLocal (0) boots from the local disk.
+	// Types 32768 and above are vendor specific.
+	Type uint16 `json:"type"`
+	// Description is the text of the menu entry.
+	Description string `json:"description"`
+	// Servers are the IPs of the boot servers of this type. Defaults to the TFTP server.
+	Servers []net.IP `json:"servers,omitempty"`
+	// Bootfile is the file the boot servers send, from the TFTP server. Defaults to the iPXE binary of the machine's architecture.
+	Bootfile string `json:"bootfile,omitempty"`
+}
+
+// ParseBootMenu parses a BootMenu from YAML or JSON. Items without a type get a vendor specific type,
+// starting at 32768, in order. i.e.
+//
+//	prompt: Press F8 for the boot menu
+//	timeout: 10
+//	archs: ["0"]
+//	items:
+//	  - description: iPXE
+//	  - description: memtest
+//	    bootfile: memtest86+.bin
+//	  - description: local disk
+//	    type: 0
+func ParseBootMenu(data []byte) (*BootMenu, error) {
+	raw := struct {
+		BootMenu
+		Items []struct {
+			BootItem
+			Type *uint16 `json:"type"`
+		} `json:"items"`
+		Archs []string `json:"archs"`
+	}{}
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(js)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	m := raw.BootMenu
+	for _, a := range raw.Archs {
+		arch, err := ParseArch(a)
+		if err != nil {
+			return nil, err
+		}
+		m.Archs = append(m.Archs, arch)
+	}
+	next := uint16(firstVendorBootType)
+	for _, it := range raw.Items {
+		item := it.BootItem
+		item.Type = next
+		if it.Type != nil {
+			item.Type = *it.Type
+		} else {
+			next++
+		}
+		m.Items = append(m.Items, item)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate returns an error if the menu can't be sent to PXE firmware.
+// Option 43 must fit in a single 255 byte option, older firmware does not support longer options.
+func (b *BootMenu) Validate() error {
+	if len(b.Items) == 0 {
+		return fmt.Errorf("%w: no items", ErrInvalidBootMenu)
+	}
+	seen := map[uint16]bool{}
+	for _, item := range b.Items {
+		if seen[item.Type] {
+			return fmt.Errorf("%w: boot server type %d is used more than once", ErrInvalidBootMenu, item.Type)
+		}
+		seen[item.Type] = true
+		if item.Description == "" {
+			return fmt.Errorf("%w: boot server type %d has no description", ErrInvalidBootMenu, item.Type)
+		}
+		for _, ip := range item.Servers {
+			if ip.To4() == nil {
+				return fmt.Errorf("%w: boot server %v is not an IPv4 address", ErrInvalidBootMenu, ip)
+			}
+		}
+	}
+	if b.MulticastAddr != nil && !b.MulticastAddr.To4().IsMulticast() {
+		return fmt.Errorf("%w: %v is not an IPv4 multicast address", ErrInvalidBootMenu, b.MulticastAddr)
+	}
+	// a boot server that defaults to the TFTP server is 4 bytes.
+	if n := len(b.options(net.IPv4zero).ToBytes()); n > 255 {
+		return fmt.Errorf("%w: option 43 would be %d bytes, the maximum is 255, shorten the prompt or descriptions", ErrInvalidBootMenu, n)
+	}
+	return nil
+}
+
+// offered returns true if the machine is offered the menu. Machines running iPXE are not, they get the iPXE script or binary.
+func (b *BootMenu) offered(mach machine) bool {
+	if b == nil || mach.cType != pxeClient || mach.uClass != "" {
+		return false
+	}
+	archs := b.Archs
+	if len(archs) == 0 {
+		archs = []iana.Arch{iana.INTEL_X86PC}
+	}
+	for _, a := range archs {
+		if a == mach.arch {
+			return true
+		}
+	}
+	return false
+}
+
+// item returns the BootItem of a boot server type.
+func (b *BootMenu) item(t uint16) (BootItem, bool) {
+	for _, item := range b.Items {
+		if item.Type == t && t != BootTypeLocal {
+			return item, true
+		}
+	}
+	return BootItem{}, false
+}
+
+// options returns the option 43 sub-options that enable boot server discovery and show the menu.
+// tftp is the boot server of items without Servers.
+func (b *BootMenu) options(tftp net.IP) dhcpv4.Options {
+	control := byte(disableBroadcast | serverListOnly)
+	opts := dhcpv4.Options{}
+	if b.MulticastAddr != nil {
+		opts[pxeMulticastAddr] = b.MulticastAddr.To4()
+	} else {
+		control |= disableMulticast
+	}
+	opts[pxeDiscoveryControl] = []byte{control}
+
+	var servers, menu []byte
+	for _, item := range b.Items {
+		menu = append(menu, byte(item.Type>>8), byte(item.Type), byte(len(item.Description)))
+		menu = append(menu, item.Description...)
+		if item.Type == BootTypeLocal {
+			continue
+		}
+		ips := item.Servers
+		if len(ips) == 0 {
+			ips = []net.IP{tftp}
+		}
+		servers = append(servers, byte(item.Type>>8), byte(item.Type), byte(len(ips)))
+		for _, ip := range ips {
+			servers = append(servers, ip.To4()...)
+		}
+	}
+	if len(servers) > 0 {
+		opts[pxeBootServers] = servers
+	}
+	opts[pxeBootMenu] = menu
+	opts[pxeMenuPrompt] = append([]byte{b.Timeout}, b.Prompt...)
+	return opts
+}
+
+// bootItem returns the boot server type and layer (option 43 sub-option 71) of a boot server REQUEST.
+func bootItem(m *dhcpv4.DHCPv4) (typ, layer uint16, ok bool) {
+	opts := dhcpv4.Options{}
+	if err := opts.FromBytes(m.GetOneOption(dhcpv4.OptionVendorSpecificInformation)); err != nil {
+		return 0, 0, false
+	}
+	v := opts.Get(dhcpv4.GenericOptionCode(pxeBootItem))
+	if len(v) != 4 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint16(v), binary.BigEndian.Uint16(v[2:]), true
+}
+
+// setBootMenu offers the menu or, for a boot server REQUEST, sets the bootfile and boot server of the chosen BootItem.
+// tftp is the machine's TFTP server, it is the boot server of items without Servers.
+func (r replyPacket) setBootMenu(m *dhcpv4.DHCPv4, b *BootMenu, tftp net.IP) error {
+	typ, layer, ok := bootItem(m)
+	if !ok {
+		r.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, b.options(tftp).ToBytes()))
+		r.BootFileName = ""
+		return nil
+	}
+	item, found := b.item(typ)
+	if !found {
+		return ErrBootItemNotFound{Type: typ}
+	}
+	// only the bootstrap, layer 0, is served. The high bit of the layer requests credentials, which are not supported.
+	if layer != 0 {
+		return ErrBootItemNotFound{Type: typ, Layer: layer}
+	}
+	if item.Bootfile != "" {
+		r.BootFileName = item.Bootfile
+	}
+	if len(item.Servers) > 0 {
+		r.ServerIPAddr = item.Servers[0]
+	}
+	// the reply must have the boot item of the REQUEST.
+	r.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, dhcpv4.Options{pxeBootItem: {byte(typ >> 8), byte(typ), 0, 0}}.ToBytes()))
+	return nil
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+func TestParseBootMenu(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *BootMenu
+		wantErr error
+	}{
+		{
+			name: "success",
+			data: `
+prompt: Press F8 for the boot menu
+timeout: 10
+archs: ["0", "EFI x86-64"]
+items:
+  - description: iPXE
+  - description: memtest
+    bootfile: memtest86+.bin
+    servers: [192.168.2.6]
+  - description: local disk
+    type: 0
+`,
+			want: &BootMenu{
+				Prompt:  "Press F8 for the boot menu",
+				Timeout: 10,
+				Archs:   []iana.Arch{iana.INTEL_X86PC, iana.EFI_X86_64},
+				Items: []BootItem{
+					{Type: 0x8000, Description: "iPXE"},
+					{Type: 0x8001, Description: "memtest", Bootfile: "memtest86+.bin", Servers: []net.IP{net.ParseIP("192.168.2.6")}},
+					{Type: BootTypeLocal, Description: "local disk"},
+				},
+			},
+		},
+		{name: "no items", data: `prompt: hi`, wantErr: ErrInvalidBootMenu},
+		{name: "duplicate type", data: `items: [{description: a, type: 1}, {description: b, type: 1}]`, wantErr: ErrInvalidBootMenu},
+		{name: "no description", data: `items: [{type: 1}]`, wantErr: ErrInvalidBootMenu},
+		{name: "ipv6 server", data: `items: [{description: a, servers: ["2001:db8::1"]}]`, wantErr: ErrInvalidBootMenu},
+		{name: "not multicast", data: `{multicastAddr: 192.168.2.5, items: [{description: a}]}`, wantErr: ErrInvalidBootMenu},
+		{name: "too long", data: `{prompt: "` + strings.Repeat("a", 250) + `", items: [{description: a}]}`, wantErr: ErrInvalidBootMenu},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBootMenu([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseBootMenu() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+	if _, err := ParseBootMenu([]byte(`{items: [{description: a}], unknown: 1}`)); err == nil {
+		t.Fatal("ParseBootMenu() with an unknown field, want error")
+	}
+}
+
+func TestBootMenuOptions(t *testing.T) {
+	m := &BootMenu{
+		Prompt:  "F8",
+		Timeout: 5,
+		Items: []BootItem{
+			{Type: 0x8000, Description: "iPXE"},
+			{Type: 0x8001, Description: "mt", Servers: []net.IP{net.IPv4(192, 168, 2, 6), net.IPv4(192, 168, 2, 7)}},
+			{Type: BootTypeLocal, Description: "disk"},
+		},
+	}
+	want := dhcpv4.Options{
+		pxeDiscoveryControl: {disableBroadcast | disableMulticast | serverListOnly},
+		pxeBootServers:      {0x80, 0x00, 1, 192, 168, 2, 5, 0x80, 0x01, 2, 192, 168, 2, 6, 192, 168, 2, 7},
+		pxeBootMenu:         {0x80, 0x00, 4, 'i', 'P', 'X', 'E', 0x80, 0x01, 2, 'm', 't', 0, 0, 4, 'd', 'i', 's', 'k'},
+		pxeMenuPrompt:       {5, 'F', '8'},
+	}
+	if diff := cmp.Diff(m.options(net.IPv4(192, 168, 2, 5)), want); diff != "" {
+		t.Fatal(diff)
+	}
+
+	m.MulticastAddr = net.IPv4(239, 0, 0, 1)
+	opts := m.options(net.IPv4(192, 168, 2, 5))
+	if diff := cmp.Diff(opts[pxeDiscoveryControl], []byte{disableBroadcast | serverListOnly}); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(opts[pxeMulticastAddr], []byte{239, 0, 0, 1}); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestBootMenuOffered(t *testing.T) {
+	m := &BootMenu{Items: []BootItem{{Type: 1, Description: "a"}}}
+	tests := []struct {
+		name string
+		menu *BootMenu
+		mach machine
+		want bool
+	}{
+		{name: "legacy bios", menu: m, mach: machine{arch: iana.INTEL_X86PC, cType: pxeClient}, want: true},
+		{name: "no menu", mach: machine{arch: iana.INTEL_X86PC, cType: pxeClient}},
+		{name: "uefi", menu: m, mach: machine{arch: iana.EFI_X86_64, cType: pxeClient}},
+		{name: "http client", menu: m, mach: machine{arch: iana.INTEL_X86PC, cType: httpClient}},
+		{name: "in ipxe", menu: m, mach: machine{arch: iana.INTEL_X86PC, cType: pxeClient, uClass: IPXE}},
+		{name: "configured arch", menu: &BootMenu{Archs: []iana.Arch{iana.EFI_X86_64}}, mach: machine{arch: iana.EFI_X86_64, cType: pxeClient}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.menu.offered(tt.mach); got != tt.want {
+				t.Fatalf("offered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -89,7 +89,7 @@ func (r replyPacket) setOpt97(guid []byte) error {
 func (r replyPacket) setOpt43(hw net.HardwareAddr) {
 	pxe := dhcpv4.Options{
 		// PXE Boot Server Discovery Control - bypass, just boot from filename.
-		6: []byte{8}, // or []byte{8}
+		pxeDiscoveryControl: []byte{bypassDiscovery},
 	}
 	// Raspberry PI's need options 9 and 10 of parent option 43.
 	// The best way at the moment to figure out if a DHCP request is coming from a Raspberry PI is to
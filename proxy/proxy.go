@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/iana"
@@ -18,9 +19,24 @@ type machine struct {
 	cType  clientType
 }
 
+// inIPXE returns true if the machine is running our iPXE binary.
+// This is determined by the user class (DHCP option 77) being "Tinkerbell" or the custom user class.
+func (m machine) inIPXE(customUC string) bool {
+	return m.uClass == Tinkerbell || (customUC != "" && m.uClass == UserClass(customUC))
+}
+
 // Redirection name comes from section 2.5 of http://www.pix.net/software/pxeboot/archive/pxespec.pdf
 func (h *Handler) Redirection(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
 	log := h.Log.WithValues("hwaddr", m.ClientHWAddr, "listenAddr", conn.LocalAddr())
+	ctx, span := h.startSpan("proxy.Redirection")
+	ev := Event{Time: time.Now(), Listener: listener(conn.LocalAddr()), Interface: h.Interface, Peer: peer, MAC: m.ClientHWAddr, TransactionID: m.TransactionID.String(), MessageType: m.MessageType().String(), Request: m}
+	if m.GatewayIPAddr != nil && !m.GatewayIPAddr.IsUnspecified() {
+		ev.GatewayAddr = m.GatewayIPAddr
+	}
+	defer func() {
+		h.observe(ev)
+		endSpan(span, ev)
+	}()
 	reply, err := dhcpv4.New(dhcpv4.WithReply(m),
 		dhcpv4.WithGatewayIP(m.GatewayIPAddr),
 		dhcpv4.WithOptionCopied(m, dhcpv4.OptionRelayAgentInformation),
@@ -30,25 +46,30 @@ func (h *Handler) Redirection(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCP
 	}
 	if m.OpCode != dhcpv4.OpcodeBootRequest { // TODO(jacobweinstock): dont understand this, found it in an example here: https://github.com/insomniacslk/dhcp/blob/c51060810aaab9c8a0bd1b0fcbf72bc0b91e6427/dhcpv4/server4/server_test.go#L31
 		log.Info("Ignoring packet", "OpCode", m.OpCode)
+		ev.ignore(IgnoreNotBootRequest, nil)
 		return
 	}
 	rp := replyPacket{DHCPv4: reply, log: log}
 
 	if err := rp.validatePXE(m); err != nil {
 		log.Info("Ignoring packet: not from a PXE enabled client", "error", err)
+		ev.ignore(IgnoreReason(err), err)
 		return
 	}
 
 	if err := rp.setMessageType(m); err != nil {
 		log.Info("Ignoring packet", "error", err.Error())
+		ev.ignore(IgnoreReason(err), err)
 		return
 	}
 
 	mach, err := processMachine(m)
 	if err != nil {
 		log.Info("unable to parse arch or user class: unusable packet", "error", err.Error(), "mach", mach)
+		ev.ignore(IgnoreReason(err), err)
 		return
 	}
+	ev.Arch, ev.ClientType, ev.UserClass = mach.arch.String(), string(mach.cType), string(mach.uClass)
 
 	// Set option 43
 	rp.setOpt43(m.ClientHWAddr)
@@ -56,12 +77,10 @@ func (h *Handler) Redirection(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCP
 	// Set option 97
 	if err := rp.setOpt97(m.GetOneOption(dhcpv4.OptionClientMachineIdentifier)); err != nil {
 		log.Info("Ignoring packet", "error", err.Error())
+		ev.ignore(IgnoreReason(err), err)
 		return
 	}
 
-	// set broadcast header to true
-	reply.SetBroadcast()
-
 	// Set option 60
 	// The PXE spec says the server should identify itself as a PXEClient or HTTPCient
 	if opt60 := m.GetOneOption(dhcpv4.OptionClassIdentifier); strings.HasPrefix(string(opt60), string(pxeClient)) {
@@ -70,35 +89,100 @@ func (h *Handler) Redirection(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCP
 		reply.UpdateOption(dhcpv4.OptClassIdentifier(string(httpClient)))
 	}
 
+	// check the backend for how this machine should boot.
+	start := time.Now()
+	c := h.newClient(m, mach, conn, peer)
+	d, respond, err := h.decide(ctx, log, c)
+	ev.BackendDuration, ev.Decision, ev.Err = time.Since(start), d, err
+	if !respond {
+		ev.ignore(IgnoreBackendError, err)
+		return
+	}
+	tftp, http, ipxe := h.bootServers(d, c)
+
 	// Set option 54
-	opt54 := rp.setOpt54(m.GetOneOption(dhcpv4.OptionClassIdentifier), h.TFTPAddr.UDPAddr().IP, h.HTTPAddr.TCPAddr().IP)
+	opt54 := rp.setOpt54(m.GetOneOption(dhcpv4.OptionClassIdentifier), tftp.UDPAddr().IP, http.TCPAddr().IP)
 
 	// add the siaddr (IP address of next server) dhcp packet header to a given packet pkt.
 	// see https://datatracker.ietf.org/doc/html/rfc2131#section-2
 	// without this the pxe client will try to broadcast a request message to port 4011
 	reply.ServerIPAddr = opt54
+	if d.NextServer != nil {
+		reply.ServerIPAddr = d.NextServer
+	}
 
 	// set sname header
 	// see https://datatracker.ietf.org/doc/html/rfc2131#section-2
-	rp.setSNAME(m.GetOneOption(dhcpv4.OptionClassIdentifier), h.TFTPAddr.UDPAddr().IP, h.HTTPAddr.TCPAddr().IP)
+	rp.setSNAME(m.GetOneOption(dhcpv4.OptionClassIdentifier), tftp.UDPAddr().IP, http.TCPAddr().IP)
 
 	// set bootfile header
-	if err := rp.setBootfile(mach, h.UserClass, h.TFTPAddr, h.IPXEAddr, h.IPXEScript); err != nil {
+	if err := rp.setBootfile(mach, h.bootfiles(mach, d), h.UserClass, tftp, ipxe, h.IPXEScript); err != nil {
 		log.Info("Ignoring packet", "error", err.Error())
+		ev.ignore(IgnoreReason(err), err)
 		return
 	}
-	// check the backend, if PXE is NOT allowed, set the boot file name to "/<mac address>/not-allowed"
-	if !h.Allower.Allow(h.Ctx, mach.mac) {
+	if d.IPXEScriptURL != nil && mach.inIPXE(h.UserClass) {
+		rp.BootFileName = d.IPXEScriptURL.String()
+	}
+	// PXE boot server discovery: offer the boot menu instead of a bootfile,
+	// or answer the boot server REQUEST (sent to port 4011) for the menu item that was chosen.
+	if d.Allow && h.BootMenu.offered(mach) {
+		if err := rp.setBootMenu(m, h.BootMenu, tftp.UDPAddr().IP); err != nil {
+			log.Info("Ignoring packet", "error", err.Error())
+			ev.ignore(IgnoreReason(err), err)
+			return
+		}
+	}
+	// if PXE is NOT allowed, set the boot file name to "/<mac address>/not-allowed"
+	// and tell the client why in option 56.
+	if !d.Allow {
 		rp.BootFileName = fmt.Sprintf("/%v/not-allowed", mach.mac)
+		reply.UpdateOption(dhcpv4.OptMessage(d.Reason))
 	}
 
 	// send the DHCP packet
-	if _, err := conn.WriteTo(reply.ToBytes(), peer); err != nil {
+	to, broadcast := replyAddr(m, peer)
+	if broadcast {
+		reply.SetBroadcast()
+	}
+	if _, err := conn.WriteTo(reply.ToBytes(), to); err != nil {
 		log.Error(err, "failed to send ProxyDHCP offer")
+		ev.ignore(IgnoreSendFailed, err)
 		return
 	}
+	ev.Reply, ev.NextServer = reply, reply.ServerIPAddr
+	ev.replied(d, rp.MessageType() == dhcpv4.MessageTypeAck, rp.BootFileName, mach.inIPXE(h.UserClass))
 	log.V(1).Info("DHCP packet received", "pkt", *m)
-	log.Info("Sent ProxyDHCP message", "arch", mach.arch, "userClass", mach.uClass, "receivedMsgType", m.MessageType(), "replyMsgType", rp.MessageType(), "unicast", rp.IsUnicast(), "peer", peer, "bootfile", rp.BootFileName)
+	log.Info("Sent ProxyDHCP message", "arch", mach.arch, "userClass", mach.uClass, "receivedMsgType", m.MessageType(), "replyMsgType", rp.MessageType(), "unicast", !broadcast, "peer", peer, "replyTo", to, "bootfile", rp.BootFileName, "allow", d.Allow, "reason", d.Reason, "source", d.Source, "rule", d.Rule)
+}
+
+// replyAddr returns where the reply to a request is sent, following section 4.1 of RFC 2131:
+//  1. a relayed request (giaddr set) is replied to on port 67 of the relay agent. The relay agent uses the
+//     broadcast bit to deliver it: it is set for clients without an address (ciaddr), a relay agent would otherwise
+//     unicast to yiaddr, which a proxyDHCP reply never sets. Clients with an address keep their own bit.
+//  2. a client with an address (ciaddr or the source address of the request) is replied to by unicast.
+//  3. all other clients are broadcast to on port 68. A proxyDHCP server does not assign an address (yiaddr)
+//     that it could unicast to, so this is done whether or not the client set the broadcast bit.
+//
+// broadcast is true when the reply is broadcast.
+func replyAddr(m *dhcpv4.DHCPv4, peer net.Addr) (to net.Addr, broadcast bool) {
+	if m.GatewayIPAddr != nil && !m.GatewayIPAddr.IsUnspecified() {
+		return &net.UDPAddr{IP: m.GatewayIPAddr, Port: dhcpv4.ServerPort}, m.ClientIPAddr == nil || m.ClientIPAddr.IsUnspecified()
+	}
+	src, ok := peer.(*net.UDPAddr)
+	if !ok {
+		return peer, false
+	}
+	if m.ClientIPAddr != nil && !m.ClientIPAddr.IsUnspecified() {
+		if src.IP.Equal(m.ClientIPAddr) {
+			return src, false
+		}
+		return &net.UDPAddr{IP: m.ClientIPAddr, Port: dhcpv4.ClientPort}, false
+	}
+	if src.IP != nil && !src.IP.IsUnspecified() && !src.IP.Equal(net.IPv4bcast) {
+		return src, false
+	}
+	return &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}, true
 }
 
 // validatePXE determines if the DHCP packet meets qualifications of a being a PXE enabled client.
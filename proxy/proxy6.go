@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"inet.af/netaddr"
+)
+
+// Redirection6 is the DHCPv6 counterpart of Redirection.
+// It answers Solicit, Request and Information-Request messages from PXE and HTTPClient firmware
+// with a boot file URL (option 59) and boot file parameters (option 60). See https://www.rfc-editor.org/rfc/rfc5970.html
+func (h *Handler) Redirection6(conn net.PacketConn, peer net.Addr, m dhcpv6.DHCPv6) {
+	log := h.Log.WithValues("listenAddr", conn.LocalAddr(), "peer", peer)
+	ctx, span := h.startSpan("proxy.Redirection6")
+	ev := Event{Time: time.Now(), Listener: listener(conn.LocalAddr()), Interface: h.Interface, Peer: peer, Request: m}
+	defer func() {
+		h.observe(ev)
+		endSpan(span, ev)
+	}()
+	msg, err := m.GetInnerMessage()
+	if err != nil {
+		log.Info("Ignoring packet: unable to get inner message", "error", err.Error())
+		ev.ignore(IgnoreBadPacket, err)
+		return
+	}
+	ev.MessageType, ev.TransactionID = msg.Type().String(), msg.TransactionID.String()
+	if err := validatePXE6(log, msg, h.DUID); err != nil {
+		log.Info("Ignoring packet: not from a PXE enabled client", "error", err)
+		ev.ignore(IgnoreReason(err), err)
+		return
+	}
+	mach, err := processMachine6(m)
+	if err != nil {
+		log.Info("unable to parse arch, user class or mac: unusable packet", "error", err.Error(), "mach", mach)
+		ev.ignore(IgnoreReason(err), err)
+		return
+	}
+	log = log.WithValues("hwaddr", mach.mac)
+	ev.MAC, ev.Arch, ev.ClientType, ev.UserClass = mach.mac, mach.arch.String(), string(mach.cType), string(mach.uClass)
+
+	// check the backend for how this machine should boot.
+	start := time.Now()
+	c := h.newClient6(m, msg, mach, conn, peer)
+	if c.Relay != nil {
+		ev.GatewayAddr = c.Relay.GatewayAddr
+	}
+	d, respond, err := h.decide(ctx, log, c)
+	ev.BackendDuration, ev.Decision, ev.Err = time.Since(start), d, err
+	if !respond {
+		ev.ignore(IgnoreBackendError, err)
+		return
+	}
+	tftp, http, ipxe := h.bootServers(d, c)
+	bootfile, err := bootfileURL(mach, h.bootfiles(mach, d), h.UserClass, tftp, http, ipxe, h.IPXEScript)
+	if err != nil {
+		log.Info("Ignoring packet", "error", err.Error())
+		ev.ignore(IgnoreReason(err), err)
+		return
+	}
+	if d.IPXEScriptURL != nil && mach.inIPXE(h.UserClass) {
+		u := *d.IPXEScriptURL
+		bootfile = &u
+	}
+	// if PXE is NOT allowed, set the boot file path to "/<mac address>/not-allowed"
+	if !d.Allow {
+		bootfile.Path = fmt.Sprintf("/%v/not-allowed", mach.mac)
+	}
+
+	mods := []dhcpv6.Modifier{
+		dhcpv6.WithServerID(h.DUID),
+		dhcpv6.WithOption(dhcpv6.OptBootFileURL(bootfile.String())),
+		// The UEFI spec says the server should identify itself as a PXEClient or HTTPClient.
+		dhcpv6.WithOption(&dhcpv6.OptVendorClass{
+			EnterpriseNumber: vendorClass(msg).EnterpriseNumber,
+			Data:             [][]byte{[]byte(mach.cType)},
+		}),
+	}
+	if len(h.BootfileParams) > 0 {
+		mods = append(mods, dhcpv6.WithOption(dhcpv6.OptBootFileParam(h.BootfileParams...)))
+	}
+	// tell the client why it is not allowed to PXE boot.
+	if !d.Allow {
+		mods = append(mods, dhcpv6.WithOption(&dhcpv6.OptStatusCode{StatusCode: iana.StatusUnspecFail, StatusMessage: d.Reason}))
+	}
+	reply, err := newReply6(msg, mods...)
+	if err != nil {
+		log.Info("Ignoring packet", "error", err.Error())
+		ev.ignore(IgnoreBadPacket, err)
+		return
+	}
+
+	var resp dhcpv6.DHCPv6 = reply
+	if m.IsRelay() {
+		relay, ok := m.(*dhcpv6.RelayMessage)
+		if !ok {
+			log.Info("Ignoring packet: relay message could not be decoded")
+			ev.ignore(IgnoreBadPacket, nil)
+			return
+		}
+		if resp, err = dhcpv6.NewRelayReplFromRelayForw(relay, reply); err != nil {
+			log.Info("Ignoring packet: unable to encapsulate reply for relay", "error", err.Error())
+			ev.ignore(IgnoreBadPacket, err)
+			return
+		}
+	}
+
+	// send the DHCPv6 packet
+	if _, err := conn.WriteTo(resp.ToBytes(), peer); err != nil {
+		log.Error(err, "failed to send ProxyDHCPv6 message")
+		ev.ignore(IgnoreSendFailed, err)
+		return
+	}
+	ev.Reply = resp
+	ev.replied(d, reply.Type() == dhcpv6.MessageTypeReply, bootfile.String(), mach.inIPXE(h.UserClass))
+	log.V(1).Info("DHCPv6 packet received", "pkt", m.Summary())
+	log.Info("Sent ProxyDHCPv6 message", "arch", mach.arch, "userClass", mach.uClass, "receivedMsgType", msg.Type(), "replyMsgType", reply.Type(), "bootfile", bootfile.String(), "allow", d.Allow, "reason", d.Reason, "source", d.Source, "rule", d.Rule)
+}
+
+// validatePXE6 determines if the DHCPv6 message meets qualifications of a being a PXE enabled client.
+// https://www.rfc-editor.org/rfc/rfc5970.html
+// 1. is a DHCPv6 solicit/request/information-request message type
+// 2. option 1 (client identifier) is set
+// 3. a request is addressed to this server (option 2)
+// 4. option 16 is set with this format: "PXEClient:Arch:xxxxx:UNDI:yyyzzz" or "HTTPClient:Arch:xxxxx:UNDI:yyyzzz"
+// 5. option 61 is set
+// 6. option 62 is set; only warn if not set.
+func validatePXE6(log logr.Logger, msg *dhcpv6.Message, duid dhcpv6.Duid) error {
+	// only respond to SOLICIT, REQUEST and INFORMATION-REQUEST messages
+	switch msg.Type() {
+	case dhcpv6.MessageTypeSolicit, dhcpv6.MessageTypeInformationRequest:
+	case dhcpv6.MessageTypeRequest:
+		// a REQUEST is only ever meant for the server that sent the ADVERTISE.
+		if sid := msg.Options.ServerID(); sid == nil || !sid.Equal(duid) {
+			return ErrServerIDMismatch
+		}
+	default:
+		return ErrInvalidMsgType6{Invalid: msg.Type()}
+	}
+	// option 1 must be set
+	if msg.Options.ClientID() == nil {
+		return ErrClientIDMissing
+	}
+	// option 16 must be set
+	vc := vendorClass(msg)
+	if vc == nil || len(vc.Data) == 0 {
+		return ErrOpt16Missing
+	}
+	// option 16 must start with PXEClient or HTTPClient
+	opt16 := string(vc.Data[0])
+	if !strings.HasPrefix(opt16, string(pxeClient)) && !strings.HasPrefix(opt16, string(httpClient)) {
+		return ErrInvalidOption16{Opt16: opt16}
+	}
+	// option 61 must be set
+	if len(msg.Options.ArchTypes()) == 0 {
+		return ErrOpt61Missing
+	}
+	// option 62 should be set
+	if msg.GetOneOption(dhcpv6.OptionNII) == nil {
+		// just warn for the moment because we don't actually do anything with this option
+		log.V(1).Info("warning: missing option 62")
+	}
+
+	return nil
+}
+
+// processMachine6 takes a DHCPv6 packet and returns a populated machine struct.
+// The mac address is pulled from the relay information or the client DUID, see dhcpv6.ExtractMAC.
+func processMachine6(pkt dhcpv6.DHCPv6) (machine, error) {
+	mach := machine{}
+	msg, err := pkt.GetInnerMessage()
+	if err != nil {
+		return mach, err
+	}
+	// get option 61 ; arch
+	var archKnown bool
+	for _, elem := range msg.Options.ArchTypes() {
+		if !strings.Contains(elem.String(), "unknown") {
+			archKnown = true
+			mach.arch = elem
+			break
+		}
+	}
+	if !archKnown {
+		return mach, ErrUnknownArch
+	}
+
+	// set option 15 from received packet, this is the DHCPv6 equivalent of option 77
+	if uc := msg.Options.UserClasses(); len(uc) > 0 {
+		mach.uClass = UserClass(string(uc[0]))
+	}
+	// set the client type based off of option 16
+	if vc := vendorClass(msg); vc != nil && len(vc.Data) > 0 {
+		if strings.HasPrefix(string(vc.Data[0]), string(pxeClient)) {
+			mach.cType = pxeClient
+		} else if strings.HasPrefix(string(vc.Data[0]), string(httpClient)) {
+			mach.cType = httpClient
+		}
+	}
+	mac, err := dhcpv6.ExtractMAC(pkt)
+	if err != nil {
+		return mach, ErrNoMAC6{Detail: err.Error()}
+	}
+	mach.mac = mac
+
+	return mach, nil
+}
+
+// vendorClass returns option 16 of a DHCPv6 message or nil.
+func vendorClass(msg *dhcpv6.Message) *dhcpv6.OptVendorClass {
+	if vc, ok := msg.GetOneOption(dhcpv6.OptionVendorClass).(*dhcpv6.OptVendorClass); ok {
+		return vc
+	}
+	return nil
+}
+
+// newReply6 creates the reply message for a SOLICIT, REQUEST or INFORMATION-REQUEST.
+// A SOLICIT gets an ADVERTISE unless it has the rapid commit option set.
+func newReply6(msg *dhcpv6.Message, mods ...dhcpv6.Modifier) (*dhcpv6.Message, error) {
+	if msg.Type() == dhcpv6.MessageTypeSolicit && msg.GetOneOption(dhcpv6.OptionRapidCommit) == nil {
+		return dhcpv6.NewAdvertiseFromSolicit(msg, mods...)
+	}
+	return dhcpv6.NewReplyFromMessage(msg, mods...)
+}
+
+// bootfileURL returns the boot file URL (option 59) for a DHCPv6 client.
+// Unlike DHCPv4, the boot file must always be a URL. See https://www.rfc-editor.org/rfc/rfc5970.html#section-3.1
+// There is no siaddr in DHCPv6, so HTTP clients get the binary from the HTTP server in the URL itself.
+func bootfileURL(mach machine, bf BootfileMap, customUC string, tftp, http netaddr.IPPort, ipxe *url.URL, iscript string) (*url.URL, error) {
+	bin, found := bf.Lookup(mach.arch, string(mach.cType))
+	if !found {
+		return nil, ErrArchNotFound{Arch: mach.arch}
+	}
+	if ipxe == nil {
+		ipxe = &url.URL{}
+	}
+	// order matters here, see setBootfile.
+	switch {
+	case mach.inIPXE(customUC): // this case gets us out of an ipxe boot loop.
+		u := *ipxe
+		u.Path = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(ipxe.Path, "/"), mach.mac.String(), iscript)
+		return &u, nil
+	case mach.cType == httpClient: // Check the client type from option 16.
+		return &url.URL{
+			Scheme: "http",
+			Host:   http.String(),
+			Path:   fmt.Sprintf("/%v/%v", mach.mac.String(), bin),
+		}, nil
+	default:
+		return &url.URL{
+			Scheme: "tftp",
+			Host:   tftp.String(),
+			Path:   fmt.Sprintf("%v/%v", mach.mac.String(), bin),
+		}, nil
+	}
+}
+
+// DUIDFromIP returns a DUID-LL (https://www.rfc-editor.org/rfc/rfc8415.html#section-11.4) for the
+// interface that has the given IP address. If no interface has the IP, the first interface
+// with a hardware address is used.
+func DUIDFromIP(ip netaddr.IP) (dhcpv6.Duid, error) {
+	var hw net.HardwareAddr
+	if name := getInterfaceByIP(ip.String()); name != "" {
+		if iface, err := net.InterfaceByName(name); err == nil {
+			hw = iface.HardwareAddr
+		}
+	}
+	if len(hw) == 0 {
+		ifaces, err := net.Interfaces()
+		if err != nil {
+			return dhcpv6.Duid{}, err
+		}
+		for _, iface := range ifaces {
+			if len(iface.HardwareAddr) > 0 {
+				hw = iface.HardwareAddr
+				break
+			}
+		}
+	}
+	if len(hw) == 0 {
+		return dhcpv6.Duid{}, fmt.Errorf("unable to find a hardware address to create a DUID from")
+	}
+
+	return dhcpv6.Duid{Type: dhcpv6.DUID_LL, HwType: iana.HWTypeEthernet, LinkLayerAddr: hw}, nil
+}
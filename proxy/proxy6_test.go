@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"inet.af/netaddr"
+)
+
+var (
+	testMAC6  = net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	testDUID6 = dhcpv6.Duid{Type: dhcpv6.DUID_LL, HwType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}}
+)
+
+func newSolicit6(t testing.TB, mods ...dhcpv6.Modifier) *dhcpv6.Message {
+	t.Helper()
+	m, err := dhcpv6.NewSolicit(testMAC6, mods...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func withVendorClass6(vc string) dhcpv6.Modifier {
+	return dhcpv6.WithOption(&dhcpv6.OptVendorClass{EnterpriseNumber: 343, Data: [][]byte{[]byte(vc)}})
+}
+
+func TestValidatePXE6(t *testing.T) {
+	tests := []struct {
+		name    string
+		mods    []dhcpv6.Modifier
+		msgType dhcpv6.MessageType
+		wantErr error
+	}{
+		{
+			name:    "failure unknown DHCPv6 message type",
+			msgType: dhcpv6.MessageTypeRenew,
+			wantErr: ErrInvalidMsgType6{Invalid: dhcpv6.MessageTypeRenew},
+		},
+		{
+			name:    "failure request not for this server",
+			msgType: dhcpv6.MessageTypeRequest,
+			wantErr: ErrServerIDMismatch,
+		},
+		{
+			name:    "failure option 16 not set",
+			wantErr: ErrOpt16Missing,
+		},
+		{
+			name:    "failure invalid option 16",
+			mods:    []dhcpv6.Modifier{withVendorClass6("notValid")},
+			wantErr: ErrInvalidOption16{Opt16: "notValid"},
+		},
+		{
+			name: "failure option 61 missing",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("PXEClient:Arch:00007:UNDI:003016"),
+				func(d dhcpv6.DHCPv6) { d.(*dhcpv6.Message).Options.Del(dhcpv6.OptionClientArchType) },
+			},
+			wantErr: ErrOpt61Missing,
+		},
+		{
+			name: "success",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("PXEClient:Arch:00007:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64),
+			},
+		},
+		{
+			name:    "success request for this server",
+			msgType: dhcpv6.MessageTypeRequest,
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("HTTPClient:Arch:00016:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64_HTTP),
+				dhcpv6.WithServerID(testDUID6),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newSolicit6(t, tt.mods...)
+			if tt.msgType != 0 {
+				m.MessageType = tt.msgType
+			}
+			if err := validatePXE6(logr.Discard(), m, testDUID6); !errors.Is(err, tt.wantErr) {
+				t.Errorf("validatePXE6() error = %v, wantErr = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessMachine6(t *testing.T) {
+	tests := []struct {
+		name     string
+		mods     []dhcpv6.Modifier
+		wantMach machine
+		wantErr  error
+	}{
+		{
+			name: "failure unknown architecture",
+			mods: []dhcpv6.Modifier{
+				func(d dhcpv6.DHCPv6) { d.(*dhcpv6.Message).Options.Del(dhcpv6.OptionClientArchType) },
+			},
+			wantErr: ErrUnknownArch,
+		},
+		{
+			name: "success",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("HTTPClient:Arch:00016:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64_HTTP),
+				dhcpv6.WithUserClass([]byte("Tinkerbell")),
+			},
+			wantMach: machine{
+				mac:    testMAC6,
+				arch:   iana.EFI_X86_64_HTTP,
+				uClass: Tinkerbell,
+				cType:  httpClient,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mach, err := processMachine6(newSolicit6(t, tt.mods...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("processMachine6() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if diff := cmp.Diff(mach, tt.wantMach, cmp.AllowUnexported(machine{})); diff != "" {
+					t.Fatalf(diff)
+				}
+			}
+		})
+	}
+}
+
+func TestBootfileURL(t *testing.T) {
+	tftp := netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::5"), 69)
+	http := netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::4"), 80)
+	ipxe := &url.URL{Scheme: "http", Host: "[2001:db8::3]:8080"}
+	tests := []struct {
+		name    string
+		mach    machine
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "failure arch not found",
+			mach:    machine{arch: iana.Arch(255)},
+			wantErr: ErrArchNotFound{Arch: iana.Arch(255)},
+		},
+		{
+			name: "tftp client",
+			mach: machine{mac: testMAC6, arch: iana.EFI_X86_64, cType: pxeClient},
+			want: "tftp://[2001:db8::5]:69/00:01:02:03:04:05/ipxe.efi",
+		},
+		{
+			name: "http client",
+			mach: machine{mac: testMAC6, arch: iana.EFI_X86_64_HTTP, cType: httpClient},
+			want: "http://[2001:db8::4]:80/00:01:02:03:04:05/ipxe.efi",
+		},
+		{
+			name: "ipxe script",
+			mach: machine{mac: testMAC6, arch: iana.EFI_X86_64, cType: pxeClient, uClass: Tinkerbell},
+			want: "http://[2001:db8::3]:8080/00:01:02:03:04:05/auto.ipxe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bootfileURL(tt.mach, nil, "", tftp, http, ipxe, "auto.ipxe")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("bootfileURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if diff := cmp.Diff(got.String(), tt.want); diff != "" {
+					t.Fatalf(diff)
+				}
+			}
+		})
+	}
+}
+
+// recordConn is a net.PacketConn that records the last packet written.
+type recordConn struct {
+	net.PacketConn
+	written []byte
+}
+
+func (p *recordConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	p.written = b
+	return len(b), nil
+}
+
+func (p *recordConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv6unspecified, Port: dhcpv6.DefaultServerPort}
+}
+
+func TestRedirection6(t *testing.T) {
+	tests := []struct {
+		name       string
+		mods       []dhcpv6.Modifier
+		relay      bool
+		decision   *Decision
+		wantType   dhcpv6.MessageType
+		wantURL    string
+		wantStatus *dhcpv6.OptStatusCode
+		wantReply  bool
+	}{
+		{
+			name: "ignored not a PXE client",
+		},
+		{
+			name: "advertise",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("PXEClient:Arch:00007:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64),
+			},
+			wantReply: true,
+			wantType:  dhcpv6.MessageTypeAdvertise,
+			wantURL:   "tftp://[2001:db8::5]:69/00:01:02:03:04:05/ipxe.efi",
+		},
+		{
+			name: "relayed rapid commit",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("HTTPClient:Arch:00016:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64_HTTP),
+				dhcpv6.WithRapidCommit,
+			},
+			relay:     true,
+			wantReply: true,
+			wantType:  dhcpv6.MessageTypeReply,
+			wantURL:   "http://[2001:db8::4]:80/00:01:02:03:04:05/ipxe.efi",
+		},
+		{
+			name: "denied",
+			mods: []dhcpv6.Modifier{
+				withVendorClass6("PXEClient:Arch:00007:UNDI:003016"),
+				dhcpv6.WithArchType(iana.EFI_X86_64),
+			},
+			decision:   &Decision{Reason: "hardware not found"},
+			wantReply:  true,
+			wantType:   dhcpv6.MessageTypeAdvertise,
+			wantURL:    "tftp://[2001:db8::5]:69/00:01:02:03:04:05/not-allowed",
+			wantStatus: &dhcpv6.OptStatusCode{StatusCode: iana.StatusUnspecFail, StatusMessage: "hardware not found"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithDUID(testDUID6), WithBootfileParams("console=ttyS0")}
+			if tt.decision != nil {
+				opts = append(opts, WithAllower(resolver{d: *tt.decision}))
+			}
+			h := NewHandler(
+				context.Background(),
+				netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::5"), 69),
+				netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::4"), 80),
+				&url.URL{Scheme: "http", Host: "[2001:db8::3]:8080"},
+				opts...,
+			)
+			conn := &recordConn{}
+			var pkt dhcpv6.DHCPv6 = newSolicit6(t, tt.mods...)
+			if tt.relay {
+				var err error
+				if pkt, err = dhcpv6.EncapsulateRelay(pkt, dhcpv6.MessageTypeRelayForward, net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			done := make(chan struct{})
+			go func() {
+				h.Redirection6(conn, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: dhcpv6.DefaultClientPort}, pkt)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for Redirection6")
+			}
+			if !tt.wantReply {
+				if conn.written != nil {
+					t.Fatalf("expected no reply, got %x", conn.written)
+				}
+				return
+			}
+			got, err := dhcpv6.FromBytes(conn.written)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.relay != got.IsRelay() {
+				t.Fatalf("relay: got %v, want %v", got.IsRelay(), tt.relay)
+			}
+			msg, err := got.GetInnerMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(msg.Type(), tt.wantType); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(msg.Options.BootFileURL(), tt.wantURL); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(msg.Options.BootFileParam(), []string{"console=ttyS0"}); diff != "" {
+				t.Fatal(diff)
+			}
+			if sid := msg.Options.ServerID(); sid == nil || !sid.Equal(testDUID6) {
+				t.Fatalf("server id: got %v, want %v", sid, testDUID6)
+			}
+			if diff := cmp.Diff(msg.Options.Status(), tt.wantStatus); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -103,7 +103,6 @@ func TestRedirection(t *testing.T) {
 	want.ServerHostName = "127.0.0.1"
 	want.ServerIPAddr = net.IP{127, 0, 0, 1}
 	want.OpCode = dhcpv4.OpcodeBootReply
-	want.Flags = 32768
 	tests := []struct {
 		name string
 		mods []dhcpv4.Modifier
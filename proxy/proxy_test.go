@@ -1,14 +1,17 @@
 package proxy
 
 import (
+	"context"
 	"errors"
 	"net"
+	"net/url"
 	"testing"
 
 	"github.com/go-logr/logr"
 	"github.com/google/go-cmp/cmp"
 	"github.com/insomniacslk/dhcp/dhcpv4"
 	"github.com/insomniacslk/dhcp/iana"
+	"inet.af/netaddr"
 )
 
 func TestValidatePXE(t *testing.T) {
@@ -190,3 +193,178 @@ func TestProcessMachine(t *testing.T) {
 		})
 	}
 }
+
+// resolver is a Resolver that returns the same Decision for every mac address.
+type resolver struct {
+	AllowAll
+	d Decision
+}
+
+func (r resolver) Resolve(_ context.Context, _ net.HardwareAddr) (Decision, error) {
+	return r.d, nil
+}
+
+func TestRedirectionResolver(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	tests := []struct {
+		name           string
+		uClass         string
+		decision       Decision
+		wantBootfile   string
+		wantNextServer net.IP
+		wantSname      string
+		wantMessage    string
+	}{
+		{
+			name:           "not allowed",
+			decision:       Decision{Reason: ReasonNotFound},
+			wantBootfile:   "/00:01:02:03:04:05/not-allowed",
+			wantNextServer: net.IP{192, 168, 2, 5},
+			wantSname:      "192.168.2.5",
+			wantMessage:    ReasonNotFound,
+		},
+		{
+			name:           "handler defaults",
+			decision:       Decision{Allow: true},
+			wantBootfile:   "00:01:02:03:04:05/ipxe.efi",
+			wantNextServer: net.IP{192, 168, 2, 5},
+			wantSname:      "192.168.2.5",
+		},
+		{
+			name: "bootfile, tftp and next server overrides",
+			decision: Decision{
+				Allow:      true,
+				Bootfile:   "snp.efi",
+				TFTPAddr:   netaddr.IPPortFrom(netaddr.IPv4(10, 0, 0, 5), 69),
+				NextServer: net.IP{10, 0, 0, 6},
+			},
+			wantBootfile:   "00:01:02:03:04:05/snp.efi",
+			wantNextServer: net.IP{10, 0, 0, 6},
+			wantSname:      "10.0.0.5",
+		},
+		{
+			name:   "ipxe script url override",
+			uClass: string(Tinkerbell),
+			decision: Decision{
+				Allow:         true,
+				IPXEScriptURL: &url.URL{Scheme: "http", Host: "10.0.0.7", Path: "/custom.ipxe"},
+			},
+			wantBootfile:   "http://10.0.0.7/custom.ipxe",
+			wantNextServer: net.IP{192, 168, 2, 5},
+			wantSname:      "192.168.2.5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(
+				context.Background(),
+				netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 5), 69),
+				netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 4), 80),
+				&url.URL{Scheme: "http", Host: "192.168.2.3"},
+				WithAllower(resolver{d: tt.decision}),
+			)
+			m, err := dhcpv4.New(
+				dhcpv4.WithMessageType(dhcpv4.MessageTypeDiscover),
+				dhcpv4.WithHwAddr(mac),
+				dhcpv4.WithGeneric(dhcpv4.OptionClassIdentifier, []byte("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, []byte{1, 2, 1}),
+				dhcpv4.WithGeneric(dhcpv4.OptionUserClassInformation, []byte(tt.uClass)),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn := &recordConn{}
+			h.Redirection(conn, &net.UDPAddr{IP: net.IPv4bcast, Port: 68}, m)
+			got, err := dhcpv4.FromBytes(conn.written)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got.BootFileName, tt.wantBootfile); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got.ServerIPAddr.To4(), tt.wantNextServer); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got.ServerHostName, tt.wantSname); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got.Message(), tt.wantMessage); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestReplyAddr(t *testing.T) {
+	relay := net.IP{10, 20, 0, 1}
+	client := net.IP{192, 168, 2, 50}
+	tests := []struct {
+		name          string
+		giaddr        net.IP
+		ciaddr        net.IP
+		peer          net.Addr
+		want          net.Addr
+		wantBroadcast bool
+	}{
+		{
+			name:          "relayed",
+			giaddr:        relay,
+			peer:          &net.UDPAddr{IP: relay, Port: 67},
+			want:          &net.UDPAddr{IP: relay, Port: 67},
+			wantBroadcast: true,
+		},
+		{
+			name:          "relayed from another port",
+			giaddr:        relay,
+			peer:          &net.UDPAddr{IP: relay, Port: 4011},
+			want:          &net.UDPAddr{IP: relay, Port: 67},
+			wantBroadcast: true,
+		},
+		{
+			name:   "relayed client ip",
+			giaddr: relay,
+			ciaddr: client,
+			peer:   &net.UDPAddr{IP: relay, Port: 4011},
+			want:   &net.UDPAddr{IP: relay, Port: 67},
+		},
+		{
+			name:   "client ip",
+			ciaddr: client,
+			peer:   &net.UDPAddr{IP: client, Port: 4011},
+			want:   &net.UDPAddr{IP: client, Port: 4011},
+		},
+		{
+			name:   "client ip from another address",
+			ciaddr: client,
+			peer:   &net.UDPAddr{IP: net.IPv4zero, Port: 68},
+			want:   &net.UDPAddr{IP: client, Port: 68},
+		},
+		{
+			name: "unicast source",
+			peer: &net.UDPAddr{IP: client, Port: 68},
+			want: &net.UDPAddr{IP: client, Port: 68},
+		},
+		{
+			name:          "no address",
+			peer:          &net.UDPAddr{IP: net.IPv4zero, Port: 68},
+			want:          &net.UDPAddr{IP: net.IPv4bcast, Port: 68},
+			wantBroadcast: true,
+		},
+		{
+			name:          "broadcast source",
+			peer:          &net.UDPAddr{IP: net.IPv4bcast, Port: 68},
+			want:          &net.UDPAddr{IP: net.IPv4bcast, Port: 68},
+			wantBroadcast: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &dhcpv4.DHCPv4{GatewayIPAddr: tt.giaddr, ClientIPAddr: tt.ciaddr}
+			got, broadcast := replyAddr(m, tt.peer)
+			if got.String() != tt.want.String() || broadcast != tt.wantBroadcast {
+				t.Fatalf("replyAddr() = %v, %v, want %v, %v", got, broadcast, tt.want, tt.wantBroadcast)
+			}
+		})
+	}
+}
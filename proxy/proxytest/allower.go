@@ -0,0 +1,69 @@
+package proxytest
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// Source is the Decision.Source of decisions made by an Allower that don't set one.
+const Source = "proxytest"
+
+// Allower is a fake proxy.Allower that records every client it is asked about.
+// It implements proxy.ClientResolver so the Handler passes it everything known about the client.
+type Allower struct {
+	// Decisions are the decisions for mac addresses, keyed by net.HardwareAddr.String().
+	Decisions map[string]proxy.Decision
+	// Default is the Decision for mac addresses not in Decisions.
+	Default proxy.Decision
+	// Err, when not nil, is returned instead of a Decision.
+	Err error
+
+	mu    sync.Mutex
+	calls []proxy.Client
+}
+
+// NewAllower returns an Allower that allows all mac addresses except the ones in deny.
+func NewAllower(deny ...net.HardwareAddr) *Allower {
+	a := &Allower{
+		Decisions: map[string]proxy.Decision{},
+		Default:   proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: Source},
+	}
+	for _, mac := range deny {
+		a.Decisions[mac.String()] = proxy.Decision{Reason: proxy.ReasonDenied, Source: Source}
+	}
+	return a
+}
+
+// Allow returns true if the mac address is allowed to PXE boot.
+func (a *Allower) Allow(ctx context.Context, mac net.HardwareAddr) bool {
+	d, err := a.ResolveClient(ctx, proxy.Client{MAC: mac})
+	return err == nil && d.Allow
+}
+
+// ResolveClient records the client and returns its Decision.
+func (a *Allower) ResolveClient(_ context.Context, c proxy.Client) (proxy.Decision, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, c)
+	if a.Err != nil {
+		return proxy.Decision{Source: Source}, a.Err
+	}
+	d, ok := a.Decisions[c.MAC.String()]
+	if !ok {
+		d = a.Default
+	}
+	if d.Source == "" {
+		d.Source = Source
+	}
+	return d, nil
+}
+
+// Calls returns the clients the Allower was asked about, oldest first.
+func (a *Allower) Calls() []proxy.Client {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]proxy.Client(nil), a.calls...)
+}
@@ -0,0 +1,39 @@
+package proxytest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+	"inet.af/netaddr"
+)
+
+func TestAllower(t *testing.T) {
+	allowed := net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+	denied := net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x06}
+	a := NewAllower(denied)
+
+	got, err := proxy.Resolve(context.Background(), a, proxy.Client{MAC: allowed, UserClass: "iPXE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, proxy.Decision{Allow: true, Reason: proxy.ReasonAllowed, Source: Source}, cmpopts.IgnoreUnexported(netaddr.IPPort{})); diff != "" {
+		t.Fatal(diff)
+	}
+	if a.Allow(context.Background(), denied) {
+		t.Fatalf("Allow(%v) = true, want false", denied)
+	}
+	want := []proxy.Client{{MAC: allowed, UserClass: "iPXE"}, {MAC: denied}}
+	if diff := cmp.Diff(a.Calls(), want); diff != "" {
+		t.Fatal(diff)
+	}
+
+	a.Err = errors.New("backend down")
+	if _, err := a.ResolveClient(context.Background(), proxy.Client{MAC: allowed}); !errors.Is(err, a.Err) {
+		t.Fatalf("ResolveClient() error = %v, want %v", err, a.Err)
+	}
+}
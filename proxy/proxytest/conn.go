@@ -0,0 +1,199 @@
+// Package proxytest provides utilities for testing proxy.Handler without real sockets.
+//
+// Conn is an in-memory net.PacketConn that packets are delivered to and replies are read from,
+// Allower is a fake boot decision backend that records its calls and Discover, Request and Solicit6
+// build the packets PXE and HTTP boot firmware sends for an architecture.
+package proxytest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// errDeadlineChanged is used internally to restart a ReadFrom with the new read deadline.
+var errDeadlineChanged = errors.New("read deadline changed")
+
+// queueSize is the number of delivered packets a Conn holds before Deliver blocks.
+const queueSize = 64
+
+// Packet is a packet delivered to or written by a Conn.
+type Packet struct {
+	// Addr is the address the packet was delivered from or written to.
+	Addr net.Addr
+	Data []byte
+}
+
+// DHCPv4 parses the packet as a DHCP message.
+func (p Packet) DHCPv4() (*dhcpv4.DHCPv4, error) {
+	return dhcpv4.FromBytes(p.Data)
+}
+
+// DHCPv6 parses the packet as a DHCPv6 message.
+func (p Packet) DHCPv6() (dhcpv6.DHCPv6, error) {
+	return dhcpv6.FromBytes(p.Data)
+}
+
+// Conn is an in-memory net.PacketConn. Packets passed to Deliver are returned by ReadFrom
+// and packets passed to WriteTo are recorded, to be read with Next or Written.
+type Conn struct {
+	local  net.Addr
+	in     chan Packet
+	closed chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	deadline time.Time
+	// deadlineSet is closed and replaced when the read deadline changes, to wake up a pending ReadFrom.
+	deadlineSet chan struct{}
+	written     []Packet
+	next        int
+	// wrote is closed and replaced on every WriteTo, to wake up a pending Next.
+	wrote chan struct{}
+}
+
+// NewConn returns a Conn with local as its LocalAddr.
+func NewConn(local net.Addr) *Conn {
+	return &Conn{
+		local:       local,
+		in:          make(chan Packet, queueSize),
+		closed:      make(chan struct{}),
+		deadlineSet: make(chan struct{}),
+		wrote:       make(chan struct{}),
+	}
+}
+
+// Deliver queues a packet from addr to be returned by ReadFrom. It returns net.ErrClosed once the Conn is closed.
+func (c *Conn) Deliver(addr net.Addr, b []byte) error {
+	p := Packet{Addr: addr, Data: append([]byte(nil), b...)}
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	default:
+	}
+	select {
+	case c.in <- p:
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+// ReadFrom returns the next delivered packet. It blocks until a packet is delivered, the read deadline passes
+// or the Conn is closed.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		deadline, set := c.deadline, c.deadlineSet
+		c.mu.Unlock()
+
+		select {
+		case <-c.closed:
+			return 0, nil, net.ErrClosed
+		default:
+		}
+		if n, addr, err := c.read(b, deadline, set); !errors.Is(err, errDeadlineChanged) {
+			return n, addr, err
+		}
+	}
+}
+
+// read waits for a delivered packet until deadline. It returns errDeadlineChanged when the read deadline changes before that.
+func (c *Conn) read(b []byte, deadline time.Time, set chan struct{}) (int, net.Addr, error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case p := <-c.in:
+		return copy(b, p.Data), p.Addr, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-set:
+		return 0, nil, errDeadlineChanged
+	}
+}
+
+// WriteTo records the packet. It returns net.ErrClosed once the Conn is closed.
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, Packet{Addr: addr, Data: append([]byte(nil), b...)})
+	close(c.wrote)
+	c.wrote = make(chan struct{})
+	return len(b), nil
+}
+
+// Next returns the oldest written packet not yet returned by Next. It waits until ctx is done for a packet to be written.
+func (c *Conn) Next(ctx context.Context) (Packet, error) {
+	for {
+		c.mu.Lock()
+		if c.next < len(c.written) {
+			p := c.written[c.next]
+			c.next++
+			c.mu.Unlock()
+			return p, nil
+		}
+		wrote := c.wrote
+		c.mu.Unlock()
+
+		select {
+		case <-wrote:
+		case <-ctx.Done():
+			return Packet{}, ctx.Err()
+		}
+	}
+}
+
+// Written returns all packets written so far.
+func (c *Conn) Written() []Packet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Packet(nil), c.written...)
+}
+
+// Close closes the Conn, pending and future reads return net.ErrClosed. Closing a Conn more than once is a no-op.
+func (c *Conn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// LocalAddr returns the address passed to NewConn.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// SetDeadline sets the read deadline, writes never block.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for pending and future ReadFrom calls. A zero value disables the deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	close(c.deadlineSet)
+	c.deadlineSet = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline is a no-op, writes never block.
+func (c *Conn) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package proxytest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	testLocal = &net.UDPAddr{IP: net.IPv4(192, 168, 2, 5), Port: 67}
+	testPeer  = &net.UDPAddr{IP: net.IPv4zero, Port: 68}
+)
+
+func TestConnReadFrom(t *testing.T) {
+	c := NewConn(testLocal)
+	if err := c.Deliver(testPeer, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	n, addr, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" || addr != testPeer {
+		t.Fatalf("ReadFrom() = %q, %v, want %q, %v", buf[:n], addr, "hello", testPeer)
+	}
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	c := NewConn(testLocal)
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadFrom(make([]byte, 10)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("ReadFrom() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+
+	// a deadline in the past unblocks a pending read.
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error)
+	go func() {
+		_, _, err := c.ReadFrom(make([]byte, 10))
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := c.SetReadDeadline(time.Unix(1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("ReadFrom() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	c := NewConn(testLocal)
+	errs := make(chan error)
+	go func() {
+		_, _, err := c.ReadFrom(make([]byte, 10))
+		errs <- err
+	}()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("ReadFrom() error = %v, want %v", err, net.ErrClosed)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close() error = %v", err)
+	}
+	if err := c.Deliver(testPeer, nil); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Deliver() error = %v, want %v", err, net.ErrClosed)
+	}
+	if _, err := c.WriteTo(nil, testPeer); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("WriteTo() error = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func TestConnNext(t *testing.T) {
+	c := NewConn(testLocal)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = c.WriteTo([]byte("one"), testPeer)
+		_, _ = c.WriteTo([]byte("two"), testPeer)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []string
+	for i := 0; i < 2; i++ {
+		p, err := c.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(p.Data))
+	}
+	if diff := cmp.Diff(got, []string{"one", "two"}); diff != "" {
+		t.Fatal(diff)
+	}
+	if n := len(c.Written()); n != 2 {
+		t.Fatalf("Written() = %v packets, want 2", n)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Next() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
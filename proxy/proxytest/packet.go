@@ -0,0 +1,94 @@
+package proxytest
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"github.com/jacobweinstock/proxydhcp/client"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// httpArchs are the architectures of UEFI HTTP boot firmware, they identify as HTTPClient instead of PXEClient.
+var httpArchs = map[iana.Arch]bool{
+	iana.EFI_X86_HTTP:     true,
+	iana.EFI_X86_64_HTTP:  true,
+	iana.EFI_BC_HTTP:      true,
+	iana.EFI_ARM32_HTTP:   true,
+	iana.EFI_ARM64_HTTP:   true,
+	iana.INTEL_X86PC_HTTP: true,
+	iana.UBOOT_ARM32_HTTP: true,
+	iana.UBOOT_ARM64_HTTP: true,
+	iana.EFI_RISCV32_HTTP: true,
+	iana.EFI_RISCV64_HTTP: true,
+}
+
+// ClientType returns the client type (DHCP option 60 prefix) the firmware of arch sends.
+func ClientType(arch iana.Arch) string {
+	if httpArchs[arch] {
+		return client.HTTPClient
+	}
+	return client.PXEClient
+}
+
+// Firmware returns the client.Client that simulates the PXE or HTTP boot firmware of arch.
+func Firmware(mac net.HardwareAddr, arch iana.Arch) client.Client {
+	return client.Client{MAC: mac, Arch: arch, ClientType: ClientType(arch)}
+}
+
+// Discover returns the DISCOVER the firmware of arch sends. mods are applied last.
+func Discover(t testing.TB, mac net.HardwareAddr, arch iana.Arch, mods ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	t.Helper()
+	m, err := Firmware(mac, arch).Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mod := range mods {
+		mod(m)
+	}
+	return m
+}
+
+// Request returns the REQUEST the firmware of arch sends to port 4011 in reply to offer. mods are applied last.
+func Request(t testing.TB, offer *dhcpv4.DHCPv4, arch iana.Arch, mods ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	t.Helper()
+	m, err := Firmware(offer.ClientHWAddr, arch).Request(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mod := range mods {
+		mod(m)
+	}
+	return m
+}
+
+// WithUserClass sets DHCP option 77, i.e. proxy.IPXE once the machine runs iPXE.
+func WithUserClass(uc proxy.UserClass) dhcpv4.Modifier {
+	return dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionUserClassInformation, []byte(uc)))
+}
+
+// WithBootItem sets the boot server type, layer 0, PXE firmware sends to port 4011 for the boot menu item that was chosen
+// (DHCP option 43 sub-option 71).
+func WithBootItem(typ uint16) dhcpv4.Modifier {
+	return dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, dhcpv4.Options{71: {byte(typ >> 8), byte(typ), 0, 0}}.ToBytes()))
+}
+
+// Solicit6 returns the SOLICIT the firmware of arch sends. mods are applied last.
+func Solicit6(t testing.TB, mac net.HardwareAddr, arch iana.Arch, mods ...dhcpv6.Modifier) *dhcpv6.Message {
+	t.Helper()
+	mods = append([]dhcpv6.Modifier{
+		dhcpv6.WithArchType(arch),
+		dhcpv6.WithOption(&dhcpv6.OptVendorClass{
+			EnterpriseNumber: 343,
+			Data:             [][]byte{[]byte(fmt.Sprintf("%v:Arch:%05d:UNDI:003016", ClientType(arch), arch))},
+		}),
+	}, mods...)
+	m, err := dhcpv6.NewSolicit(mac, mods...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
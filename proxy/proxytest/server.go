@@ -0,0 +1,41 @@
+package proxytest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+	"github.com/insomniacslk/dhcp/dhcpv6/server6"
+	"github.com/jacobweinstock/proxydhcp/proxy"
+)
+
+// Serve serves h on a Conn with local as its address until the test ends.
+// An IPv4 local address serves DHCP with h.Redirection, any other serves DHCPv6 with h.Redirection6.
+func Serve(t testing.TB, h *proxy.Handler, local *net.UDPAddr) *Conn {
+	t.Helper()
+	conn := NewConn(local)
+	var serve func() error
+	if local.IP.To4() != nil {
+		s, err := server4.NewServer("", nil, h.Redirection, server4.WithConn(conn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve = s.Serve
+	} else {
+		s, err := server6.NewServer("", nil, h.Redirection6, server6.WithConn(conn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve = s.Serve
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = serve()
+	}()
+	t.Cleanup(func() {
+		conn.Close()
+		<-done
+	})
+	return conn
+}
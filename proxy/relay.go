@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"inet.af/netaddr"
+	"sigs.k8s.io/yaml"
+)
+
+// RelayRuleSource is the Decision Source of requests denied by a RelayRule.
+const RelayRuleSource = "relay-rule"
+
+// RelayRules choose how relayed requests boot based on where they come from, i.e. per rack or switch port.
+// The first rule that matches a relayed request is used, requests that were not relayed never match.
+type RelayRules []RelayRule
+
+// RelayRule is a RelayMatch and what to do with the requests it matches.
+// A rule that denies booting is applied without asking the Allower. Otherwise the Allower makes the Decision
+// and the boot servers, iPXE script and bootfile of the rule are used where the Decision does not set its own.
+type RelayRule struct {
+	// Name identifies the rule in logs and the audit log.
+	Name string `json:"name"`
+	// Match is the relay agent information a request must have.
+	Match RelayMatch `json:"match"`
+	// Deny, when true, does not allow the matched requests to PXE boot.
+	Deny bool `json:"deny,omitempty"`
+	// Reason is the reason sent to denied clients. Defaults to ReasonRelayDenied.
+	Reason string `json:"reason,omitempty"`
+	// Bootfile is the iPXE binary to serve instead of the one mapped to the machine's architecture.
+	Bootfile string `json:"bootfile,omitempty"`
+	// IPXEScriptURL is the full URL of the iPXE script to serve.
+	IPXEScriptURL *url.URL `json:"-"`
+	// TFTPAddr is the TFTP server to use.
+	TFTPAddr netaddr.IPPort `json:"tftpAddr,omitempty"`
+	// HTTPAddr is the HTTP server to use.
+	HTTPAddr netaddr.IPPort `json:"httpAddr,omitempty"`
+	// IPXEAddr is the URL from which iPXE binaries and scripts are served.
+	IPXEAddr *url.URL `json:"-"`
+	// NextServer is the siaddr DHCP header.
+	NextServer net.IP `json:"nextServer,omitempty"`
+}
+
+// RelayMatch is the relay agent information (DHCP option 82, DHCPv6 relay options) a request must have to match a RelayRule.
+// Empty fields match anything, a request must match all the others.
+//
+// CircuitID, RemoteID and SubscriberID are matched against the sub-option as text and as lower case hex,
+// a trailing * matches any suffix, i.e. "switch1/*".
+type RelayMatch struct {
+	// CircuitID is DHCP option 82 sub-option 1 (DHCPv6 option 18, interface-id).
+	CircuitID string `json:"circuitID,omitempty"`
+	// RemoteID is DHCP option 82 sub-option 2 (DHCPv6 option 37).
+	RemoteID string `json:"remoteID,omitempty"`
+	// SubscriberID is DHCP option 82 sub-option 6 (DHCPv6 option 38).
+	SubscriberID string `json:"subscriberID,omitempty"`
+	// LinkSelection is the subnet DHCP option 82 sub-option 5 must be in.
+	LinkSelection netaddr.IPPrefix `json:"linkSelection,omitempty"`
+	// GatewayAddr is the subnet the giaddr header (DHCPv6 link-address) must be in.
+	GatewayAddr netaddr.IPPrefix `json:"giaddr,omitempty"`
+}
+
+// ParseRelayRules parses RelayRules from a YAML or JSON list. i.e.
+//
+//	[{name: rack-a, match: {giaddr: 10.20.0.0/24, circuitID: "switch1/*"}, tftpAddr: "10.20.0.5:69"},
+//	 {name: quarantine, match: {remoteID: "001122334455"}, deny: true, reason: rack is quarantined}]
+func ParseRelayRules(data []byte) (RelayRules, error) {
+	var raw []struct {
+		RelayRule
+		IPXEScriptURL string `json:"ipxeScriptURL,omitempty"`
+		IPXEAddr      string `json:"ipxeAddr,omitempty"`
+	}
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(js)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	rules := make(RelayRules, 0, len(raw))
+	for _, r := range raw {
+		rule := r.RelayRule
+		if rule.IPXEScriptURL, err = parseAbsoluteURL(r.IPXEScriptURL); err != nil {
+			return nil, fmt.Errorf("%w: rule %q: ipxeScriptURL: %v", ErrInvalidRelayRule, rule.Name, err)
+		}
+		if rule.IPXEAddr, err = parseAbsoluteURL(r.IPXEAddr); err != nil {
+			return nil, fmt.Errorf("%w: rule %q: ipxeAddr: %v", ErrInvalidRelayRule, rule.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// parseAbsoluteURL parses an absolute URL, an empty string is a nil URL.
+func parseAbsoluteURL(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%v is not an absolute URL", s)
+	}
+	return u, nil
+}
+
+// Validate returns an error if a rule has no name, the same name as another rule or nothing to match on.
+func (r RelayRules) Validate() error {
+	seen := map[string]bool{}
+	for i, rule := range r {
+		if rule.Name == "" {
+			return fmt.Errorf("%w: rule %d has no name", ErrInvalidRelayRule, i)
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("%w: rule name %q is used more than once", ErrInvalidRelayRule, rule.Name)
+		}
+		seen[rule.Name] = true
+		if rule.Match.isZero() {
+			return fmt.Errorf("%w: rule %q has nothing to match on", ErrInvalidRelayRule, rule.Name)
+		}
+		if rule.Deny && (rule.Bootfile != "" || rule.IPXEScriptURL != nil || !rule.TFTPAddr.IsZero() ||
+			!rule.HTTPAddr.IsZero() || rule.IPXEAddr != nil || rule.NextServer != nil) {
+			return fmt.Errorf("%w: rule %q denies booting and sets how to boot", ErrInvalidRelayRule, rule.Name)
+		}
+	}
+	return nil
+}
+
+// match returns the first rule that matches the relay agent information of the client, nil if none do.
+func (r RelayRules) match(c Client) *RelayRule {
+	if c.Relay == nil {
+		return nil
+	}
+	for i := range r {
+		if r[i].Match.matches(c.Relay) {
+			return &r[i]
+		}
+	}
+	return nil
+}
+
+// isZero returns true if m has nothing to match on.
+func (m RelayMatch) isZero() bool {
+	return m.CircuitID == "" && m.RemoteID == "" && m.SubscriberID == "" && m.LinkSelection.IsZero() && m.GatewayAddr.IsZero()
+}
+
+// matches returns true if the relay agent information matches all fields of m.
+func (m RelayMatch) matches(ri *RelayInfo) bool {
+	return matchID(m.CircuitID, ri.CircuitID) &&
+		matchID(m.RemoteID, ri.RemoteID) &&
+		matchID(m.SubscriberID, ri.SubscriberID) &&
+		matchPrefix(m.LinkSelection, ri.LinkSelection) &&
+		matchPrefix(m.GatewayAddr, ri.GatewayAddr)
+}
+
+// matchID returns true if a relay agent sub-option matches pattern, as text or as lower case hex.
+func matchID(pattern string, v []byte) bool {
+	if pattern == "" {
+		return true
+	}
+	for _, s := range []string{string(v), hex.EncodeToString(v)} {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(s, prefix) {
+				return true
+			}
+		} else if s == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix returns true if ip is in p, or p is not set.
+func matchPrefix(p netaddr.IPPrefix, ip net.IP) bool {
+	if p.IsZero() {
+		return true
+	}
+	addr, ok := netaddr.FromStdIP(ip)
+	return ok && p.Contains(addr)
+}
+
+// deny returns the Decision for a client the rule denies.
+func (r *RelayRule) deny() Decision {
+	d := Decision{Reason: r.Reason, Source: RelayRuleSource, Rule: r.Name}
+	if d.Reason == "" {
+		d.Reason = ReasonRelayDenied
+	}
+	return d
+}
+
+// apply sets the boot settings of the rule that the Decision does not set.
+func (r *RelayRule) apply(d Decision) Decision {
+	d.Rule = r.Name
+	if d.Bootfile == "" {
+		d.Bootfile = r.Bootfile
+	}
+	if d.IPXEScriptURL == nil {
+		d.IPXEScriptURL = r.IPXEScriptURL
+	}
+	if d.TFTPAddr.IsZero() {
+		d.TFTPAddr = r.TFTPAddr
+	}
+	if d.HTTPAddr.IsZero() {
+		d.HTTPAddr = r.HTTPAddr
+	}
+	if d.IPXEAddr == nil {
+		d.IPXEAddr = r.IPXEAddr
+	}
+	if d.NextServer == nil {
+		d.NextServer = r.NextServer
+	}
+	return d
+}
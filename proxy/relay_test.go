@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"inet.af/netaddr"
+)
+
+// netaddrComparers compare netaddr values by their string form, their fields are unexported.
+var netaddrComparers = cmp.Options{
+	cmp.Comparer(func(a, b netaddr.IPPort) bool { return a.String() == b.String() }),
+	cmp.Comparer(func(a, b netaddr.IPPrefix) bool { return a.String() == b.String() }),
+}
+
+func TestParseRelayRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    RelayRules
+		wantErr error
+	}{
+		{
+			name: "success",
+			data: `
+- name: rack-a
+  match:
+    giaddr: 10.20.0.0/24
+    circuitID: "switch1/*"
+  tftpAddr: 10.20.0.5:69
+  ipxeScriptURL: http://10.20.0.5/rack-a.ipxe
+  nextServer: 10.20.0.5
+- name: quarantine
+  match:
+    remoteID: "001122334455"
+    linkSelection: 10.30.0.0/16
+  deny: true
+  reason: rack is quarantined
+`,
+			want: RelayRules{
+				{
+					Name:          "rack-a",
+					Match:         RelayMatch{GatewayAddr: netaddr.MustParseIPPrefix("10.20.0.0/24"), CircuitID: "switch1/*"},
+					TFTPAddr:      netaddr.MustParseIPPort("10.20.0.5:69"),
+					IPXEScriptURL: &url.URL{Scheme: "http", Host: "10.20.0.5", Path: "/rack-a.ipxe"},
+					NextServer:    net.ParseIP("10.20.0.5"),
+				},
+				{
+					Name:   "quarantine",
+					Match:  RelayMatch{RemoteID: "001122334455", LinkSelection: netaddr.MustParseIPPrefix("10.30.0.0/16")},
+					Deny:   true,
+					Reason: "rack is quarantined",
+				},
+			},
+		},
+		{name: "no name", data: `[{match: {circuitID: a}}]`, wantErr: ErrInvalidRelayRule},
+		{name: "duplicate name", data: `[{name: a, match: {circuitID: a}}, {name: a, match: {circuitID: b}}]`, wantErr: ErrInvalidRelayRule},
+		{name: "no match", data: `[{name: a, tftpAddr: "10.0.0.1:69"}]`, wantErr: ErrInvalidRelayRule},
+		{name: "deny with boot settings", data: `[{name: a, match: {circuitID: a}, deny: true, bootfile: snp.efi}]`, wantErr: ErrInvalidRelayRule},
+		{name: "relative url", data: `[{name: a, match: {circuitID: a}, ipxeAddr: /ipxe}]`, wantErr: ErrInvalidRelayRule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRelayRules([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseRelayRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want, netaddrComparers); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+	for _, data := range []string{`[{name: a, match: {circuitID: a}, unknown: 1}]`, `[{name: a, match: {giaddr: 10.0.0.1}}]`} {
+		if _, err := ParseRelayRules([]byte(data)); err == nil {
+			t.Fatalf("ParseRelayRules(%v), want error", data)
+		}
+	}
+}
+
+func TestRelayMatch(t *testing.T) {
+	relay := &RelayInfo{
+		GatewayAddr:   net.IPv4(10, 20, 0, 1),
+		CircuitID:     []byte("switch1/eth1/3"),
+		RemoteID:      []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		LinkSelection: net.IPv4(10, 30, 1, 0),
+	}
+	tests := []struct {
+		name  string
+		match RelayMatch
+		want  bool
+	}{
+		{name: "giaddr subnet", match: RelayMatch{GatewayAddr: netaddr.MustParseIPPrefix("10.20.0.0/24")}, want: true},
+		{name: "other giaddr subnet", match: RelayMatch{GatewayAddr: netaddr.MustParseIPPrefix("10.21.0.0/24")}},
+		{name: "circuit id", match: RelayMatch{CircuitID: "switch1/eth1/3"}, want: true},
+		{name: "circuit id prefix", match: RelayMatch{CircuitID: "switch1/*"}, want: true},
+		{name: "other circuit id", match: RelayMatch{CircuitID: "switch2/*"}},
+		{name: "remote id hex", match: RelayMatch{RemoteID: "001122334455"}, want: true},
+		{name: "link selection", match: RelayMatch{LinkSelection: netaddr.MustParseIPPrefix("10.30.0.0/16")}, want: true},
+		{name: "missing subscriber id", match: RelayMatch{SubscriberID: "a"}},
+		{name: "all must match", match: RelayMatch{CircuitID: "switch1/*", RemoteID: "ff*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match.matches(relay); got != tt.want {
+				t.Fatalf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecideRelayRules(t *testing.T) {
+	rules := RelayRules{
+		{Name: "quarantine", Match: RelayMatch{CircuitID: "switch1/eth1/9"}, Deny: true},
+		{
+			Name:       "rack-a",
+			Match:      RelayMatch{CircuitID: "switch1/*"},
+			TFTPAddr:   netaddr.MustParseIPPort("10.20.0.5:69"),
+			NextServer: net.IPv4(10, 20, 0, 5),
+		},
+	}
+	tests := []struct {
+		name    string
+		allower Allower
+		relay   *RelayInfo
+		want    Decision
+	}{
+		{name: "not relayed", allower: AllowAll{}, want: Decision{Allow: true, Reason: ReasonAllowed, Source: "proxy.AllowAll"}},
+		{name: "no rule matches", allower: AllowAll{}, relay: &RelayInfo{CircuitID: []byte("switch2/eth1/1")}, want: Decision{Allow: true, Reason: ReasonAllowed, Source: "proxy.AllowAll"}},
+		{
+			name:    "rule sets boot servers",
+			allower: AllowAll{},
+			relay:   &RelayInfo{CircuitID: []byte("switch1/eth1/1")},
+			want: Decision{
+				Allow:      true,
+				Reason:     ReasonAllowed,
+				Source:     "proxy.AllowAll",
+				TFTPAddr:   netaddr.MustParseIPPort("10.20.0.5:69"),
+				NextServer: net.IPv4(10, 20, 0, 5),
+				Rule:       "rack-a",
+			},
+		},
+		{
+			name:    "backend settings take precedence",
+			allower: resolver{d: Decision{Allow: true, Source: "test", NextServer: net.IPv4(10, 0, 0, 6)}},
+			relay:   &RelayInfo{CircuitID: []byte("switch1/eth1/1")},
+			want:    Decision{Allow: true, Source: "test", TFTPAddr: netaddr.MustParseIPPort("10.20.0.5:69"), NextServer: net.IPv4(10, 0, 0, 6), Rule: "rack-a"},
+		},
+		{
+			name:    "rule denies without asking the backend",
+			allower: errResolver{},
+			relay:   &RelayInfo{CircuitID: []byte("switch1/eth1/9")},
+			want:    Decision{Reason: ReasonRelayDenied, Source: RelayRuleSource, Rule: "quarantine"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{Ctx: context.Background(), Allower: tt.allower, RelayRules: rules}
+			got, respond, _ := h.decide(context.Background(), logr.Discard(), Client{MAC: net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}, Relay: tt.relay})
+			if !respond {
+				t.Fatal("decide() respond = false, want true")
+			}
+			if diff := cmp.Diff(got, tt.want, netaddrComparers); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/jacobweinstock/proxydhcp/pcap"
+	"inet.af/netaddr"
+)
+
+var update = flag.Bool("update", false, "update the golden files of TestReplay")
+
+// replayDir holds the captures replayed by TestReplay. Each capture (.pcap or .pcapng) has a .golden file
+// with the replies to every DHCP request in it. Regenerate the golden files with:
+//
+//	go test ./proxy -run TestReplay -update
+//
+// The synthetic-* captures are samples written by testdata/replay/gen.go, not recorded from real hardware.
+// Captures recorded from real firmware go in the same directory, named after the firmware, i.e. dell-r640-bios.pcap.
+const replayDir = "testdata/replay"
+
+// replayConn is an in-memory net.PacketConn that records the packets written to it.
+type replayConn struct {
+	net.PacketConn
+	local  net.Addr
+	to     net.Addr
+	writes [][]byte
+}
+
+func (r *replayConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	r.to = addr
+	r.writes = append(r.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (r *replayConn) LocalAddr() net.Addr {
+	return r.local
+}
+
+func TestReplay(t *testing.T) {
+	captures, err := filepath.Glob(filepath.Join(replayDir, "*.pcap*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) == 0 {
+		t.Fatalf("no captures found in %v", replayDir)
+	}
+	for _, capture := range captures {
+		capture := capture
+		t.Run(filepath.Base(capture), func(t *testing.T) {
+			got := replay(t, capture)
+			golden := strings.TrimSuffix(capture, filepath.Ext(capture)) + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o600); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run the test with -update to create it", err)
+			}
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Fatalf("reply differs from %v, run the test with -update if the change is intended (-want +got):\n%v", golden, diff)
+			}
+		})
+	}
+}
+
+// replay feeds every DHCP request in a capture through Redirection and returns the replies as text.
+func replay(t *testing.T, capture string) []byte {
+	t.Helper()
+	f, err := os.Open(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pkts, err := pcap.ReadUDP(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obs := &recordObserver{}
+	h := NewHandler(
+		context.Background(),
+		netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 5), 69),
+		netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 4), 80),
+		&url.URL{Scheme: "http", Host: "192.168.2.3"},
+		WithObserver(obs),
+	)
+
+	var out bytes.Buffer
+	for n, p := range pkts {
+		if p.Dst.Port != dhcpv4.ServerPort && p.Dst.Port != 4011 {
+			continue
+		}
+		m, err := dhcpv4.FromBytes(p.Payload)
+		if err != nil || m.OpCode != dhcpv4.OpcodeBootRequest {
+			continue
+		}
+		fmt.Fprintf(&out, "# packet %d: %v %v -> %v, xid %v\n", n+1, m.MessageType(), p.Src, p.Dst, m.TransactionID)
+		conn := &replayConn{local: &net.UDPAddr{IP: net.IPv4zero, Port: p.Dst.Port}}
+		obs.event = Event{}
+		h.Redirection(conn, p.Src, m)
+		if len(conn.writes) == 0 {
+			fmt.Fprintf(&out, "no reply: %v\n\n", obs.event.IgnoreReason)
+			continue
+		}
+		for _, b := range conn.writes {
+			reply, err := dhcpv4.FromBytes(b)
+			if err != nil {
+				t.Fatalf("packet %d: invalid reply: %v", n+1, err)
+			}
+			fmt.Fprintf(&out, "reply to %v:\n%v\n", conn.to, printable(reply.Summary()))
+		}
+	}
+	return out.Bytes()
+}
+
+// printable hex encodes the option data in a summary that is not printable, i.e. a binary relay agent Remote-ID,
+// so that the golden files stay text.
+func printable(summary string) string {
+	lines := strings.Split(summary, "\n")
+	for i, line := range lines {
+		if strings.IndexFunc(line, func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+			continue
+		}
+		label, value := line, ""
+		if n := strings.Index(line, ": "); n >= 0 {
+			label, value = line[:n+2], line[n+2:]
+		}
+		// the raw data is followed by its bytes, i.e. "Remote ID: <data> ([0 27 33])".
+		var suffix string
+		if n := strings.LastIndex(value, " (["); n >= 0 {
+			value, suffix = value[:n], value[n:]
+		}
+		lines[i] = label + hex.EncodeToString([]byte(value)) + suffix
+	}
+	return strings.Join(lines, "\n")
+}
@@ -2,9 +2,11 @@ package proxy
 
 import (
 	"context"
+	"fmt"
 	"net"
 
 	"github.com/insomniacslk/dhcp/dhcpv4/server4"
+	"github.com/insomniacslk/dhcp/dhcpv6/server6"
 	"inet.af/netaddr"
 )
 
@@ -22,6 +24,61 @@ func Server(_ context.Context, addr netaddr.IPPort, conn *net.UDPAddr, h server4
 	return server4.NewServer(getInterfaceByIP(addr.IP().String()), conn, h)
 }
 
+// Server6 returns a proxy DHCPv6 server for the Handler.
+func Server6(_ context.Context, addr netaddr.IPPort, conn *net.UDPAddr, h server6.Handler) (*server6.Server, error) {
+	if conn == nil {
+		// for multicast traffic we need to listen on all IPs
+		conn = &net.UDPAddr{
+			IP:   net.IPv6unspecified,
+			Port: addr.UDPAddr().Port,
+		}
+	}
+
+	// server6.NewServer() will isolate listening to the specific interface and join the DHCPv6 multicast groups.
+	return server6.NewServer(getInterfaceByIP(addr.IP().String()), conn, h)
+}
+
+// InterfaceName returns the name of the network interface with the IP address or an empty string.
+func InterfaceName(ip netaddr.IP) string {
+	return getInterfaceByIP(ip.String())
+}
+
+// ListenAddr returns the IPv4 address and the name of the network interface to listen on for addr,
+// an IPv4 address or the name of a network interface. The interface of the unspecified address (0.0.0.0) is empty,
+// it listens on all interfaces. Any other address must belong to a network interface, listening on all interfaces
+// instead would answer the clients of other listeners. An interface name is resolved to its first IPv4 address.
+func ListenAddr(addr string) (netaddr.IP, string, error) {
+	if ip, err := netaddr.ParseIP(addr); err == nil {
+		if !ip.Is4() {
+			return netaddr.IP{}, "", fmt.Errorf("%w: %v", ErrNoIPv4Addr, addr)
+		}
+		if ip.IsUnspecified() {
+			return ip, "", nil
+		}
+		iface := InterfaceName(ip)
+		if iface == "" {
+			return netaddr.IP{}, "", fmt.Errorf("%w: %v", ErrNoInterface, addr)
+		}
+		return ip, iface, nil
+	}
+	iface, err := net.InterfaceByName(addr)
+	if err != nil {
+		return netaddr.IP{}, "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return netaddr.IP{}, "", err
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			if ip, ok := netaddr.FromStdIP(ipnet.IP); ok && ip.Is4() {
+				return ip, iface.Name, nil
+			}
+		}
+	}
+	return netaddr.IP{}, "", fmt.Errorf("%w: %v", ErrNoIPv4Addr, addr)
+}
+
 // getInterfaceByIP returns the interface with the given IP address or an empty string.
 func getInterfaceByIP(ip string) string {
 	ifaces, err := net.Interfaces()
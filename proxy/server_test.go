@@ -83,3 +83,36 @@ func TestServer(t *testing.T) {
 		})
 	}
 }
+
+func TestListenAddr(t *testing.T) {
+	// the loopback interface is lo on Linux and lo0 on macOS.
+	lo := getInterfaceByIP("127.0.0.1")
+	if lo == "" {
+		t.Skip("no interface with 127.0.0.1")
+	}
+	tests := []struct {
+		name      string
+		addr      string
+		wantIP    netaddr.IP
+		wantIface string
+		wantErr   bool
+	}{
+		{name: "ip", addr: "127.0.0.1", wantIP: netaddr.IPv4(127, 0, 0, 1), wantIface: lo},
+		{name: "all interfaces", addr: "0.0.0.0", wantIP: netaddr.IPv4(0, 0, 0, 0)},
+		{name: "interface name", addr: lo, wantIP: netaddr.IPv4(127, 0, 0, 1), wantIface: lo},
+		{name: "ipv6", addr: "::1", wantErr: true},
+		{name: "ip of no interface", addr: "192.0.2.1", wantErr: true},
+		{name: "unknown interface", addr: "does-not-exist0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, iface, err := ListenAddr(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListenAddr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ip.String() != tt.wantIP.String() || iface != tt.wantIface {
+				t.Fatalf("ListenAddr() = %v, %q, want %v, %q", ip, iface, tt.wantIP, tt.wantIface)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// maxStages is the number of stages kept per Session, older stages are dropped.
+const maxStages = 32
+
+// AlertKind is the kind of problem a SessionTracker found with a boot session.
+type AlertKind string
+
+const (
+	// AlertLoop is a machine that keeps being sent an iPXE binary instead of moving on to the iPXE script.
+	AlertLoop AlertKind = "loop"
+	// AlertStall is a machine that stopped sending packets before it was sent the iPXE script.
+	AlertStall AlertKind = "stall"
+)
+
+// Alert is a problem with a boot session.
+type Alert struct {
+	Kind    AlertKind
+	Session Session
+}
+
+// Stage is a single packet of a boot session.
+type Stage struct {
+	Time          time.Time `json:"time"`
+	Listener      string    `json:"listener"`
+	TransactionID string    `json:"xid"`
+	MessageType   string    `json:"messageType"`
+	UserClass     string    `json:"userClass,omitempty"`
+	Outcome       Outcome   `json:"outcome"`
+	IgnoreReason  string    `json:"ignoreReason,omitempty"`
+	Bootfile      string    `json:"bootfile,omitempty"`
+	Script        bool      `json:"script,omitempty"`
+}
+
+// Session is the network boot of a single machine, from the firmware's first DISCOVER to the iPXE script.
+type Session struct {
+	MAC     string    `json:"mac"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+	Stages  []Stage   `json:"stages"`
+	// Done is true once the machine was sent the iPXE script or was not allowed to PXE boot.
+	Done bool `json:"done"`
+	// Loop is true once a boot loop was detected.
+	Loop bool `json:"loop"`
+	// Stalled is true once the machine stopped sending packets before it was Done.
+	Stalled bool `json:"stalled"`
+}
+
+// SessionTracker is an Observer that groups the packets of each machine into boot sessions, keyed by mac address.
+// It detects boot loops as they happen and stalled sessions when Run is called.
+// Only PXE clients (packets with an architecture) start a session, other DHCP clients on the network are not tracked.
+type SessionTracker struct {
+	Log logr.Logger
+	// LoopThreshold is the number of times a machine can be sent an iPXE binary within LoopWindow before
+	// a boot loop is reported. 0 disables loop detection.
+	LoopThreshold int
+	LoopWindow    time.Duration
+	// StallTimeout is how long a session that is not Done can go without a packet before it's reported as stalled.
+	// 0 disables stall detection.
+	StallTimeout time.Duration
+	// TTL is how long a session is kept after its last packet.
+	TTL time.Duration
+	// MaxSessions is the maximum number of sessions kept, the least recently updated session is dropped first.
+	MaxSessions int
+	// OnAlert, when not nil, is called for every loop or stall detected.
+	OnAlert func(Alert)
+
+	mu       sync.Mutex
+	sessions map[string]*list.Element
+	lru      *list.List
+	now      func() time.Time
+}
+
+// SessionOption for setting SessionTracker values.
+type SessionOption func(*SessionTracker)
+
+// WithSessionLogger sets the logger that loops and stalls are logged to.
+func WithSessionLogger(l logr.Logger) SessionOption {
+	return func(t *SessionTracker) { t.Log = l }
+}
+
+// WithLoopDetection sets how many iPXE binaries can be sent to a machine within window before a boot loop is reported.
+func WithLoopDetection(threshold int, window time.Duration) SessionOption {
+	return func(t *SessionTracker) { t.LoopThreshold, t.LoopWindow = threshold, window }
+}
+
+// WithStallTimeout sets how long a session can go without a packet before it's reported as stalled.
+func WithStallTimeout(d time.Duration) SessionOption {
+	return func(t *SessionTracker) { t.StallTimeout = d }
+}
+
+// WithSessionTTL sets how long a session is kept after its last packet.
+func WithSessionTTL(d time.Duration) SessionOption {
+	return func(t *SessionTracker) { t.TTL = d }
+}
+
+// WithMaxSessions sets the maximum number of sessions kept.
+func WithMaxSessions(n int) SessionOption {
+	return func(t *SessionTracker) { t.MaxSessions = n }
+}
+
+// WithAlertFunc sets a function that is called for every loop or stall detected.
+func WithAlertFunc(f func(Alert)) SessionOption {
+	return func(t *SessionTracker) { t.OnAlert = f }
+}
+
+// NewSessionTracker returns a SessionTracker. Defaults can be overridden by passing in options.
+func NewSessionTracker(opts ...SessionOption) *SessionTracker {
+	t := &SessionTracker{
+		Log:           logr.Discard(),
+		LoopThreshold: 3,
+		LoopWindow:    5 * time.Minute,
+		StallTimeout:  2 * time.Minute,
+		TTL:           30 * time.Minute,
+		MaxSessions:   10000,
+		sessions:      map[string]*list.Element{},
+		lru:           list.New(),
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Observe adds a packet to the machine's boot session.
+func (t *SessionTracker) Observe(e Event) {
+	if len(e.MAC) == 0 {
+		return
+	}
+	now := e.Time
+	if now.IsZero() {
+		now = t.now()
+	}
+	mac := e.MAC.String()
+	var alerts []Alert
+
+	t.mu.Lock()
+	el, ok := t.sessions[mac]
+	var s *Session
+	if ok {
+		s = el.Value.(*Session)
+	}
+	if !ok || t.newSession(s, e, now) {
+		// packets ignored before their architecture was known, i.e. from DHCP clients that are not PXE clients,
+		// are added to a machine's session but never start one.
+		if e.Arch == "" {
+			t.mu.Unlock()
+			return
+		}
+		if ok {
+			t.lru.Remove(el)
+		} else {
+			t.evict()
+		}
+		s = &Session{MAC: mac, Started: now}
+		el = t.lru.PushFront(s)
+		t.sessions[mac] = el
+	}
+	t.lru.MoveToFront(el)
+	s.Updated = now
+	s.Stages = append(s.Stages, Stage{
+		Time:          now,
+		Listener:      e.Listener,
+		TransactionID: e.TransactionID,
+		MessageType:   e.MessageType,
+		UserClass:     e.UserClass,
+		Outcome:       e.Outcome,
+		IgnoreReason:  e.IgnoreReason,
+		Bootfile:      e.Bootfile,
+		Script:        e.Script,
+	})
+	if len(s.Stages) > maxStages {
+		s.Stages = s.Stages[len(s.Stages)-maxStages:]
+	}
+	if e.Outcome == OutcomeDenied || (e.Script && e.Outcome != OutcomeIgnored) {
+		s.Done = true
+	}
+	if !s.Loop && t.loop(s, now) {
+		s.Loop = true
+		alerts = append(alerts, Alert{Kind: AlertLoop, Session: s.copy()})
+	}
+	t.mu.Unlock()
+
+	t.alert(alerts...)
+}
+
+// Run reports stalled sessions and drops expired sessions until ctx is done.
+func (t *SessionTracker) Run(ctx context.Context) {
+	interval := time.Minute
+	if t.StallTimeout > 0 && t.StallTimeout/2 < interval {
+		interval = t.StallTimeout / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Sweep()
+		}
+	}
+}
+
+// Sweep reports stalled sessions and drops expired sessions.
+func (t *SessionTracker) Sweep() {
+	now := t.now()
+	var alerts []Alert
+	t.mu.Lock()
+	for mac, el := range t.sessions {
+		s := el.Value.(*Session)
+		idle := now.Sub(s.Updated)
+		if t.TTL > 0 && idle > t.TTL {
+			t.lru.Remove(el)
+			delete(t.sessions, mac)
+			continue
+		}
+		if t.StallTimeout > 0 && idle > t.StallTimeout && !s.Done && !s.Loop && !s.Stalled {
+			s.Stalled = true
+			alerts = append(alerts, Alert{Kind: AlertStall, Session: s.copy()})
+		}
+	}
+	t.mu.Unlock()
+
+	t.alert(alerts...)
+}
+
+// Session returns the current boot session of a mac address.
+func (t *SessionTracker) Session(mac string) (Session, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	el, ok := t.sessions[mac]
+	if !ok {
+		return Session{}, false
+	}
+	return el.Value.(*Session).copy(), true
+}
+
+// Sessions returns all boot sessions, most recently updated first.
+func (t *SessionTracker) Sessions() []Session {
+	t.mu.Lock()
+	all := make([]Session, 0, len(t.sessions))
+	for _, el := range t.sessions {
+		all = append(all, el.Value.(*Session).copy())
+	}
+	t.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Updated.After(all[j].Updated) })
+	return all
+}
+
+// newSession returns true if the packet starts a new boot session instead of continuing s.
+// A session that expired, or is Done and gets a packet from PXE firmware (no user class), is replaced.
+func (t *SessionTracker) newSession(s *Session, e Event, now time.Time) bool {
+	if t.TTL > 0 && now.Sub(s.Updated) > t.TTL {
+		return true
+	}
+	return s.Done && e.UserClass == ""
+}
+
+// loop returns true if the machine was sent an iPXE binary in reply to LoopThreshold or more
+// DISCOVER or SOLICIT messages within LoopWindow.
+func (t *SessionTracker) loop(s *Session, now time.Time) bool {
+	if t.LoopThreshold <= 0 {
+		return false
+	}
+	var n int
+	for _, st := range s.Stages {
+		if t.LoopWindow > 0 && now.Sub(st.Time) > t.LoopWindow {
+			continue
+		}
+		if st.Script || (st.Outcome != OutcomeOffer && st.Outcome != OutcomeAck) {
+			continue
+		}
+		if st.MessageType == dhcpv4.MessageTypeDiscover.String() || st.MessageType == dhcpv6.MessageTypeSolicit.String() {
+			n++
+		}
+	}
+	return n >= t.LoopThreshold
+}
+
+// evict drops the least recently updated session when MaxSessions is reached. t.mu must be held.
+func (t *SessionTracker) evict() {
+	if t.MaxSessions <= 0 || len(t.sessions) < t.MaxSessions {
+		return
+	}
+	oldest := t.lru.Back()
+	t.lru.Remove(oldest)
+	delete(t.sessions, oldest.Value.(*Session).MAC)
+}
+
+// alert logs the alerts and passes them to OnAlert.
+func (t *SessionTracker) alert(alerts ...Alert) {
+	for _, a := range alerts {
+		last := a.Session.Stages[len(a.Session.Stages)-1]
+		switch a.Kind {
+		case AlertLoop:
+			kvs := []interface{}{"mac", a.Session.MAC, "threshold", t.LoopThreshold, "window", t.LoopWindow.String(), "userClass", last.UserClass, "bootfile", last.Bootfile}
+			if last.UserClass != "" {
+				kvs = append(kvs, "hint", "the machine is running iPXE but its user class does not match Tinkerbell or the custom user class, so it keeps getting an iPXE binary instead of the script")
+			}
+			t.Log.Info("warning: boot loop detected, machine keeps being sent an iPXE binary", kvs...)
+		case AlertStall:
+			t.Log.Info("warning: boot session stalled before the iPXE script was sent", "mac", a.Session.MAC, "lastStage", last.MessageType, "lastListener", last.Listener, "idle", t.now().Sub(a.Session.Updated).String())
+		}
+		if t.OnAlert != nil {
+			t.OnAlert(a)
+		}
+	}
+}
+
+// copy returns a copy of the Session that doesn't share its Stages.
+func (s *Session) copy() Session {
+	c := *s
+	c.Stages = append([]Stage(nil), s.Stages...)
+	return c
+}
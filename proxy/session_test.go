@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+var sessionMAC = net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}
+
+func discover(at time.Time, userClass string, script bool) Event {
+	return Event{Time: at, Listener: "67", MAC: sessionMAC, MessageType: "DISCOVER", Arch: "EFI x86-64", UserClass: userClass, Outcome: OutcomeOffer, Script: script}
+}
+
+func TestSessionLoop(t *testing.T) {
+	var alerts []Alert
+	st := NewSessionTracker(WithLoopDetection(3, time.Minute), WithAlertFunc(func(a Alert) { alerts = append(alerts, a) }))
+	start := time.Now()
+	// firmware, then iPXE with a user class that doesn't match, over and over.
+	st.Observe(discover(start, "", false))
+	st.Observe(Event{Time: start.Add(time.Second), Listener: "4011", MAC: sessionMAC, MessageType: "REQUEST", Outcome: OutcomeAck})
+	st.Observe(discover(start.Add(2*time.Second), "iPXE", false))
+	if len(alerts) != 0 {
+		t.Fatalf("got %v alerts before the threshold, want 0", len(alerts))
+	}
+	st.Observe(discover(start.Add(3*time.Second), "iPXE", false))
+	st.Observe(discover(start.Add(4*time.Second), "iPXE", false))
+	if len(alerts) != 1 || alerts[0].Kind != AlertLoop {
+		t.Fatalf("got alerts %+v, want a single loop alert", alerts)
+	}
+	s, ok := st.Session(sessionMAC.String())
+	if !ok || !s.Loop || len(s.Stages) != 5 || s.Started != start {
+		t.Fatalf("unexpected session %+v", s)
+	}
+}
+
+func TestSessionLoopWindow(t *testing.T) {
+	st := NewSessionTracker(WithLoopDetection(2, time.Minute))
+	start := time.Now()
+	st.Observe(discover(start, "", false))
+	st.Observe(discover(start.Add(2*time.Minute), "", false))
+	if s, _ := st.Session(sessionMAC.String()); s.Loop {
+		t.Fatal("discovers outside of the window are not a loop")
+	}
+}
+
+func TestSessionDone(t *testing.T) {
+	st := NewSessionTracker()
+	start := time.Now()
+	st.Observe(discover(start, "", false))
+	st.Observe(discover(start.Add(time.Second), "Tinkerbell", true))
+	s, _ := st.Session(sessionMAC.String())
+	if !s.Done || len(s.Stages) != 2 {
+		t.Fatalf("unexpected session %+v", s)
+	}
+	// the next boot from firmware is a new session.
+	st.Observe(discover(start.Add(time.Hour), "", false))
+	s, _ = st.Session(sessionMAC.String())
+	if s.Done || len(s.Stages) != 1 || s.Started != start.Add(time.Hour) {
+		t.Fatalf("unexpected session %+v", s)
+	}
+}
+
+func TestSessionStall(t *testing.T) {
+	var alerts []Alert
+	st := NewSessionTracker(WithStallTimeout(time.Minute), WithSessionTTL(time.Hour), WithAlertFunc(func(a Alert) { alerts = append(alerts, a) }))
+	now := time.Now()
+	st.now = func() time.Time { return now }
+	st.Observe(discover(now, "", false))
+
+	st.Sweep()
+	if len(alerts) != 0 {
+		t.Fatalf("got %v alerts, want 0", len(alerts))
+	}
+	now = now.Add(2 * time.Minute)
+	st.Sweep()
+	st.Sweep()
+	if len(alerts) != 1 || alerts[0].Kind != AlertStall {
+		t.Fatalf("got alerts %+v, want a single stall alert", alerts)
+	}
+	now = now.Add(2 * time.Hour)
+	st.Sweep()
+	if got := st.Sessions(); len(got) != 0 {
+		t.Fatalf("got %v sessions after the TTL, want 0", len(got))
+	}
+}
+
+func TestSessionMax(t *testing.T) {
+	st := NewSessionTracker(WithMaxSessions(2))
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		st.Observe(Event{Time: now.Add(time.Duration(i) * time.Second), MAC: net.HardwareAddr{0, 0, 0, 0, 0, byte(i)}, MessageType: "DISCOVER", Arch: "EFI x86-64"})
+	}
+	got := st.Sessions()
+	if len(got) != 2 || got[0].MAC != "00:00:00:00:00:02" || got[1].MAC != "00:00:00:00:00:01" {
+		t.Fatalf("unexpected sessions %+v", got)
+	}
+}
+
+func TestSessionNotPXE(t *testing.T) {
+	var alerts []Alert
+	st := NewSessionTracker(WithStallTimeout(time.Minute), WithAlertFunc(func(a Alert) { alerts = append(alerts, a) }))
+	now := time.Now()
+	st.now = func() time.Time { return now }
+	// a laptop's DISCOVER, ignored because it has no option 60.
+	laptop := net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x06}
+	st.Observe(Event{Time: now, Listener: "67", MAC: laptop, MessageType: "DISCOVER", Outcome: OutcomeIgnored, IgnoreReason: "option60_missing", Err: ErrOpt60Missing})
+	if _, ok := st.Session(laptop.String()); ok {
+		t.Fatal("got a session for a client that is not a PXE client")
+	}
+	// an ignored packet without an architecture is still added to a PXE client's session.
+	st.Observe(discover(now, "", false))
+	st.Observe(Event{Time: now.Add(time.Second), Listener: "67", MAC: sessionMAC, MessageType: "REQUEST", Outcome: OutcomeIgnored, IgnoreReason: "invalid_message_type"})
+	if s, _ := st.Session(sessionMAC.String()); len(s.Stages) != 2 {
+		t.Fatalf("unexpected session %+v", s)
+	}
+
+	now = now.Add(2 * time.Minute)
+	st.Sweep()
+	if len(alerts) != 1 || alerts[0].Session.MAC != sessionMAC.String() {
+		t.Fatalf("got alerts %+v, want a single stall alert for %v", alerts, sessionMAC)
+	}
+}
+
+func TestSessionMaxLRU(t *testing.T) {
+	st := NewSessionTracker(WithMaxSessions(2))
+	now := time.Now()
+	a, b, c := net.HardwareAddr{0, 0, 0, 0, 0, 1}, net.HardwareAddr{0, 0, 0, 0, 0, 2}, net.HardwareAddr{0, 0, 0, 0, 0, 3}
+	for i, mac := range []net.HardwareAddr{a, b, a, c} {
+		st.Observe(Event{Time: now.Add(time.Duration(i) * time.Second), MAC: mac, MessageType: "DISCOVER", Arch: "EFI x86-64"})
+	}
+	// b is the least recently updated session.
+	if _, ok := st.Session(b.String()); ok {
+		t.Fatal("expected the least recently updated session to be evicted")
+	}
+	if got := st.Sessions(); len(got) != 2 || got[0].MAC != c.String() || got[1].MAC != a.String() {
+		t.Fatalf("unexpected sessions %+v", got)
+	}
+}
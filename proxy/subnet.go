@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"inet.af/netaddr"
+	"sigs.k8s.io/yaml"
+)
+
+// Subnets is a table of boot servers per subnet, so that clients boot from the artifact servers nearest to them.
+// The most specific Subnet that contains the giaddr (DHCPv6 link-address) of a relayed request,
+// or an address of the network interface a request was received on, is used.
+// The entry without a CIDR is the default, it is used when no other entry matches.
+type Subnets []Subnet
+
+// Subnet is the boot servers of the clients in a subnet. Servers that are not set are the Handler's.
+// A Decision that sets its own boot servers takes precedence.
+type Subnet struct {
+	// CIDR is the subnet, i.e. 10.20.0.0/16. It is empty for the default entry.
+	CIDR netaddr.IPPrefix `json:"subnet,omitempty"`
+	// TFTPAddr is the TFTP server, it is also the siaddr, option 54 and sname of PXE clients.
+	TFTPAddr netaddr.IPPort `json:"tftpAddr,omitempty"`
+	// HTTPAddr is the HTTP server, it is also the siaddr, option 54 and sname of HTTP clients.
+	HTTPAddr netaddr.IPPort `json:"httpAddr,omitempty"`
+	// IPXEAddr is the URL from which iPXE binaries (HTTP clients) and scripts are served.
+	IPXEAddr *url.URL `json:"-"`
+}
+
+// ParseSubnets parses Subnets from a YAML or JSON list. i.e.
+//
+//	[{subnet: 10.20.0.0/16, tftpAddr: "10.20.0.5:69", httpAddr: "10.20.0.5:80", ipxeAddr: "http://10.20.0.5"},
+//	 {tftpAddr: "192.168.2.5:69", httpAddr: "192.168.2.5:80", ipxeAddr: "http://192.168.2.5"}]
+func ParseSubnets(data []byte) (Subnets, error) {
+	var raw []struct {
+		Subnet
+		IPXEAddr string `json:"ipxeAddr,omitempty"`
+	}
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(js)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	subnets := make(Subnets, 0, len(raw))
+	for _, r := range raw {
+		s := r.Subnet
+		if s.IPXEAddr, err = parseAbsoluteURL(r.IPXEAddr); err != nil {
+			return nil, fmt.Errorf("%w: %v: ipxeAddr: %v", ErrInvalidSubnet, s.name(), err)
+		}
+		subnets = append(subnets, s)
+	}
+	if err := subnets.Validate(); err != nil {
+		return nil, err
+	}
+	return subnets, nil
+}
+
+// Validate returns an error if a subnet is in the table more than once, there is more than one default entry
+// or an entry has no boot servers.
+func (s Subnets) Validate() error {
+	seen := map[string]bool{}
+	for _, sn := range s {
+		if seen[sn.name()] {
+			return fmt.Errorf("%w: %v is in the table more than once", ErrInvalidSubnet, sn.name())
+		}
+		seen[sn.name()] = true
+		if sn.TFTPAddr.IsZero() && sn.HTTPAddr.IsZero() && sn.IPXEAddr == nil {
+			return fmt.Errorf("%w: %v has no boot servers", ErrInvalidSubnet, sn.name())
+		}
+	}
+	return nil
+}
+
+// name returns the CIDR of the subnet, or "default".
+func (s Subnet) name() string {
+	if s.CIDR.IsZero() {
+		return "default"
+	}
+	return s.CIDR.String()
+}
+
+// lookup returns the most specific subnet that contains one of addrs, or the default entry. It is nil if neither exist.
+func (s Subnets) lookup(addrs []net.IP) *Subnet {
+	var found *Subnet
+	for i := range s {
+		sn := &s[i]
+		if sn.CIDR.IsZero() {
+			if found == nil {
+				found = sn
+			}
+			continue
+		}
+		if found != nil && !found.CIDR.IsZero() && found.CIDR.Bits() >= sn.CIDR.Bits() {
+			continue
+		}
+		for _, a := range addrs {
+			if matchPrefix(sn.CIDR, a) {
+				found = sn
+				break
+			}
+		}
+	}
+	return found
+}
+
+// hasCIDR returns true if an entry other than the default has to be matched against a client's location.
+func (s Subnets) hasCIDR() bool {
+	for _, sn := range s {
+		if !sn.CIDR.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// location returns the addresses that place a client in a subnet: the giaddr (DHCPv6 link-address) of a relayed request,
+// otherwise the addresses of the network interface the request was received on, see InterfaceAddrs.
+func (h *Handler) location(c Client) []net.IP {
+	if c.Relay != nil && c.Relay.GatewayAddr != nil && !c.Relay.GatewayAddr.IsUnspecified() {
+		return []net.IP{c.Relay.GatewayAddr}
+	}
+	return h.InterfaceAddrs
+}
+
+// interfaceAddrs returns the addresses of the network interface, none if name is empty or the interface is not found.
+func interfaceAddrs(name string) []net.IP {
+	if name == "" {
+		return nil
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	return ips
+}
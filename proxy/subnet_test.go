@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+	"inet.af/netaddr"
+)
+
+func TestParseSubnets(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Subnets
+		wantErr error
+	}{
+		{
+			name: "success",
+			data: `
+- subnet: 10.20.0.0/16
+  tftpAddr: 10.20.0.5:69
+  httpAddr: 10.20.0.5:80
+  ipxeAddr: http://10.20.0.5
+- tftpAddr: 192.168.2.5:69
+`,
+			want: Subnets{
+				{
+					CIDR:     netaddr.MustParseIPPrefix("10.20.0.0/16"),
+					TFTPAddr: netaddr.MustParseIPPort("10.20.0.5:69"),
+					HTTPAddr: netaddr.MustParseIPPort("10.20.0.5:80"),
+					IPXEAddr: &url.URL{Scheme: "http", Host: "10.20.0.5"},
+				},
+				{TFTPAddr: netaddr.MustParseIPPort("192.168.2.5:69")},
+			},
+		},
+		{name: "duplicate subnet", data: `[{subnet: 10.0.0.0/8, tftpAddr: "10.0.0.1:69"}, {subnet: 10.0.0.0/8, tftpAddr: "10.0.0.2:69"}]`, wantErr: ErrInvalidSubnet},
+		{name: "two defaults", data: `[{tftpAddr: "10.0.0.1:69"}, {tftpAddr: "10.0.0.2:69"}]`, wantErr: ErrInvalidSubnet},
+		{name: "no boot servers", data: `[{subnet: 10.0.0.0/8}]`, wantErr: ErrInvalidSubnet},
+		{name: "relative url", data: `[{subnet: 10.0.0.0/8, ipxeAddr: /ipxe}]`, wantErr: ErrInvalidSubnet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSubnets([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseSubnets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want, netaddrComparers); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+	for _, data := range []string{`[{subnet: 10.0.0.0/8, unknown: 1}]`, `[{subnet: 10.0.0.1, tftpAddr: "10.0.0.1:69"}]`} {
+		if _, err := ParseSubnets([]byte(data)); err == nil {
+			t.Fatalf("ParseSubnets(%v), want error", data)
+		}
+	}
+}
+
+func TestSubnetsLookup(t *testing.T) {
+	subnets := Subnets{
+		{CIDR: netaddr.MustParseIPPrefix("10.0.0.0/8"), TFTPAddr: netaddr.MustParseIPPort("10.0.0.5:69")},
+		{TFTPAddr: netaddr.MustParseIPPort("192.168.2.5:69")},
+		{CIDR: netaddr.MustParseIPPrefix("10.20.0.0/16"), TFTPAddr: netaddr.MustParseIPPort("10.20.0.5:69")},
+	}
+	tests := []struct {
+		name    string
+		subnets Subnets
+		addrs   []net.IP
+		want    string
+	}{
+		{name: "most specific", subnets: subnets, addrs: []net.IP{{10, 20, 1, 1}}, want: "10.20.0.0/16"},
+		{name: "less specific", subnets: subnets, addrs: []net.IP{{10, 30, 1, 1}}, want: "10.0.0.0/8"},
+		{name: "any interface address", subnets: subnets, addrs: []net.IP{{172, 16, 0, 1}, {10, 30, 1, 1}}, want: "10.0.0.0/8"},
+		{name: "default", subnets: subnets, addrs: []net.IP{{172, 16, 0, 1}}, want: "default"},
+		{name: "no addresses", subnets: subnets, want: "default"},
+		{name: "no default", subnets: subnets[:1], addrs: []net.IP{{172, 16, 0, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if sn := tt.subnets.lookup(tt.addrs); sn != nil {
+				got = sn.name()
+			}
+			if got != tt.want {
+				t.Fatalf("lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectionSubnets(t *testing.T) {
+	subnets := Subnets{
+		{
+			CIDR:     netaddr.MustParseIPPrefix("10.20.0.0/16"),
+			TFTPAddr: netaddr.MustParseIPPort("10.20.0.5:69"),
+			IPXEAddr: &url.URL{Scheme: "http", Host: "10.20.0.6"},
+		},
+	}
+	tests := []struct {
+		name         string
+		giaddr       net.IP
+		decision     Decision
+		uClass       string
+		wantBootfile string
+		wantSiaddr   net.IP
+	}{
+		{name: "handler defaults", decision: Decision{Allow: true}, wantBootfile: "00:01:02:03:04:05/ipxe.efi", wantSiaddr: net.IP{192, 168, 2, 5}},
+		{name: "relayed from subnet", giaddr: net.IP{10, 20, 0, 1}, decision: Decision{Allow: true}, wantBootfile: "00:01:02:03:04:05/ipxe.efi", wantSiaddr: net.IP{10, 20, 0, 5}},
+		{name: "relayed from other subnet", giaddr: net.IP{10, 30, 0, 1}, decision: Decision{Allow: true}, wantBootfile: "00:01:02:03:04:05/ipxe.efi", wantSiaddr: net.IP{192, 168, 2, 5}},
+		{
+			name:         "ipxe script from subnet",
+			giaddr:       net.IP{10, 20, 0, 1},
+			decision:     Decision{Allow: true},
+			uClass:       string(Tinkerbell),
+			wantBootfile: "http://10.20.0.6/00:01:02:03:04:05/auto.ipxe",
+			wantSiaddr:   net.IP{10, 20, 0, 5},
+		},
+		{
+			name:         "decision takes precedence",
+			giaddr:       net.IP{10, 20, 0, 1},
+			decision:     Decision{Allow: true, TFTPAddr: netaddr.MustParseIPPort("10.0.0.5:69")},
+			wantBootfile: "00:01:02:03:04:05/ipxe.efi",
+			wantSiaddr:   net.IP{10, 0, 0, 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(
+				context.Background(),
+				netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 5), 69),
+				netaddr.IPPortFrom(netaddr.IPv4(192, 168, 2, 4), 80),
+				&url.URL{Scheme: "http", Host: "192.168.2.3"},
+				WithAllower(resolver{d: tt.decision}),
+				WithSubnets(subnets),
+			)
+			m, err := dhcpv4.New(
+				dhcpv4.WithMessageType(dhcpv4.MessageTypeDiscover),
+				dhcpv4.WithHwAddr(net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}),
+				dhcpv4.WithGatewayIP(tt.giaddr),
+				dhcpv4.WithGeneric(dhcpv4.OptionClassIdentifier, []byte("PXEClient:Arch:00007:UNDI:003016")),
+				dhcpv4.WithGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, []byte{1, 2, 1}),
+				dhcpv4.WithGeneric(dhcpv4.OptionUserClassInformation, []byte(tt.uClass)),
+				dhcpv4.WithOption(dhcpv4.OptClientArch(iana.EFI_X86_64)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn := &recordConn{}
+			h.Redirection(conn, &net.UDPAddr{IP: net.IPv4bcast, Port: 68}, m)
+			got, err := dhcpv4.FromBytes(conn.written)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got.BootFileName, tt.wantBootfile); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got.ServerIPAddr.To4(), tt.wantSiaddr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got.ServerIdentifier().To4(), tt.wantSiaddr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got.ServerHostName, tt.wantSiaddr.String()); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestSubnetsInterfaceAddrs(t *testing.T) {
+	lo := getInterfaceByIP("127.0.0.1")
+	if lo == "" {
+		t.Skip("no interface with 127.0.0.1")
+	}
+	loopback := Subnet{CIDR: netaddr.MustParseIPPrefix("127.0.0.0/8"), TFTPAddr: netaddr.MustParseIPPort("127.0.0.5:69")}
+	def := Subnet{TFTPAddr: netaddr.MustParseIPPort("10.0.0.5:69")}
+	tftp := netaddr.MustParseIPPort("192.168.2.5:69")
+
+	// the interface addresses are resolved once, and only when there is a CIDR to match them against.
+	h := NewHandler(context.Background(), tftp, tftp, &url.URL{}, WithInterface(lo), WithSubnets(Subnets{def}))
+	if h.InterfaceAddrs != nil {
+		t.Fatalf("got interface addresses %v for a table with only a default entry", h.InterfaceAddrs)
+	}
+	if got, _, _ := h.bootServers(Decision{}, Client{}); got.String() != def.TFTPAddr.String() {
+		t.Fatalf("got %v, want the default entry %v", got, def.TFTPAddr)
+	}
+
+	h = NewHandler(context.Background(), tftp, tftp, &url.URL{}, WithInterface(lo), WithSubnets(Subnets{loopback, def}))
+	if len(h.InterfaceAddrs) == 0 {
+		t.Fatalf("no interface addresses resolved for %v", lo)
+	}
+	if got, _, _ := h.bootServers(Decision{}, Client{}); got.String() != loopback.TFTPAddr.String() {
+		t.Fatalf("got %v, want the entry of the receiving interface %v", got, loopback.TFTPAddr)
+	}
+	relayed := Client{Relay: &RelayInfo{GatewayAddr: net.IP{10, 20, 0, 1}}}
+	if got, _, _ := h.bootServers(Decision{}, relayed); got.String() != def.TFTPAddr.String() {
+		t.Fatalf("got %v, want the default entry for a relayed request %v", got, def.TFTPAddr)
+	}
+}
@@ -0,0 +1,254 @@
+//go:build ignore
+
+// gen writes the synthetic captures in this directory. They are not recorded from real hardware, each one is a
+// DISCOVER and a port 4011 REQUEST built from the options a kind of PXE client sends, to cover how the proxy
+// answers it. Run it from the proxy directory, then update the golden files:
+//
+//	go run ./testdata/replay/gen.go
+//	go test -run TestReplay -update
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+const (
+	dir = "testdata/replay"
+	// ts is the time of the first packet in a capture, the others follow a second apart.
+	ts = 1646128800
+)
+
+var (
+	broadcast = &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ServerPort}
+	proxyAddr = &net.UDPAddr{IP: net.IP{192, 168, 2, 225}, Port: 4011}
+	serverMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0xfe}
+	pxePRL    = prl(1, 2, 3, 5, 6, 11, 12, 13, 15, 16, 17, 18, 43, 54, 60, 66, 67, 128, 129, 130, 131, 132, 133, 134, 135)
+)
+
+// client is a synthetic PXE client.
+type client struct {
+	name   string
+	xid    uint32
+	mac    string
+	arch   iana.Arch
+	vc     string
+	undi   []byte
+	guid   []byte
+	vlan   uint16
+	pcapng bool
+	extra  []dhcpv4.Option
+}
+
+func main() {
+	clients := []client{
+		{name: "synthetic-pxe-bios.pcap", xid: 0x5e000001, mac: "02:00:00:00:00:01", arch: iana.INTEL_X86PC, vc: "PXEClient:Arch:00000:UNDI:002001", undi: []byte{1, 2, 1}, guid: guid(1)},
+		{name: "synthetic-efi-x86-64.pcapng", xid: 0x5e000002, mac: "02:00:00:00:00:02", arch: iana.EFI_X86_64, vc: "PXEClient:Arch:00007:UNDI:003016", undi: []byte{1, 3, 16}, guid: guid(2), pcapng: true},
+		{name: "synthetic-efi-x86-64-vlan.pcap", xid: 0x5e000003, mac: "02:00:00:00:00:03", arch: iana.EFI_X86_64, vc: "PXEClient:Arch:00007:UNDI:003016", undi: []byte{1, 3, 16}, guid: guid(3), vlan: 10},
+		// the mac address is in a Raspberry Pi range, so the reply has the Raspberry Pi option 43 sub-options.
+		{name: "synthetic-efi-arm64-rpi.pcap", xid: 0x5e000004, mac: "dc:a6:32:00:00:04", arch: iana.EFI_ARM64, vc: "PXEClient:Arch:00011:UNDI:003000", undi: []byte{1, 3, 0}},
+		{name: "synthetic-http-boot.pcapng", xid: 0x5e000005, mac: "02:00:00:00:00:05", arch: iana.EFI_X86_64_HTTP, vc: "HTTPClient:Arch:00016:UNDI:003000", undi: []byte{1, 3, 0}, guid: guid(5), pcapng: true},
+		{
+			name: "synthetic-ipxe-tinkerbell.pcap", xid: 0x5e000006, mac: "02:00:00:00:00:06", arch: iana.EFI_X86_64, vc: "PXEClient:Arch:00007:UNDI:003010", undi: []byte{1, 3, 10},
+			extra: []dhcpv4.Option{
+				dhcpv4.OptGeneric(dhcpv4.OptionUserClassInformation, []byte("Tinkerbell")),
+				dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(175), []byte{19, 1, 1, 24, 1, 1}),
+			},
+		},
+	}
+	for _, c := range clients {
+		write(c.name, c.pcapng, c.frames())
+	}
+	write("synthetic-mixed-traffic.pcap", false, mixed())
+}
+
+// guid returns a client machine identifier (option 97) of type 0 with a UUID ending in n.
+func guid(n byte) []byte {
+	return []byte{0, 0x5e, 0x5e, 0x5e, 0x5e, 0, 0, 0x40, 0, 0x80, 0, 0, 0, 0, 0, 0, n}
+}
+
+// frames returns the client's broadcast DISCOVER and its REQUEST to the proxy on port 4011.
+func (c client) frames() [][]byte {
+	mac, err := net.ParseMAC(c.mac)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := []dhcpv4.Option{
+		dhcpv4.OptGeneric(dhcpv4.OptionMaximumDHCPMessageSize, []byte{0x04, 0xec}),
+		dhcpv4.OptGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, c.undi),
+		dhcpv4.OptClientArch(c.arch),
+		dhcpv4.OptClassIdentifier(c.vc),
+	}
+	if c.guid != nil {
+		opts = append(opts, dhcpv4.OptGeneric(dhcpv4.OptionClientMachineIdentifier, c.guid))
+	}
+	opts = append(opts, c.extra...)
+	client := &net.UDPAddr{IP: net.IP{192, 168, 2, 50}, Port: dhcpv4.ClientPort}
+	discover := packet(c.xid, mac, dhcpv4.MessageTypeDiscover, nil, true, opts...)
+	request := packet(c.xid, mac, dhcpv4.MessageTypeRequest, client.IP, false, opts...)
+	return [][]byte{
+		frame(mac, &net.UDPAddr{IP: net.IPv4zero, Port: dhcpv4.ClientPort}, broadcast, c.vlan, discover),
+		frame(mac, client, proxyAddr, c.vlan, request),
+	}
+}
+
+// mixed returns a relayed DISCOVER with relay agent information, a laptop's DISCOVER that is not a PXE client
+// and a DHCP server's OFFER, which is not a request.
+func mixed() [][]byte {
+	pxe := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x07}
+	laptop := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x08}
+	relayed := packet(0x5e000007, pxe, dhcpv4.MessageTypeDiscover, nil, false,
+		dhcpv4.OptGeneric(dhcpv4.OptionClientNetworkInterfaceIdentifier, []byte{1, 2, 1}),
+		dhcpv4.OptClientArch(iana.EFI_X86_64),
+		dhcpv4.OptClassIdentifier("PXEClient:Arch:00007:UNDI:003016"),
+		dhcpv4.OptRelayAgentInfo(
+			dhcpv4.OptGeneric(dhcpv4.AgentCircuitIDSubOption, []byte("Gi0/12")),
+			dhcpv4.OptGeneric(dhcpv4.AgentRemoteIDSubOption, pxe),
+		),
+	)
+	relayed.GatewayIPAddr, relayed.HopCount = net.IP{10, 20, 0, 1}, 1
+	plain := packet(0x5e000008, laptop, dhcpv4.MessageTypeDiscover, nil, true,
+		prl(1, 3, 6, 15, 119, 252),
+		dhcpv4.OptGeneric(dhcpv4.OptionClientIdentifier, append([]byte{1}, laptop...)),
+		dhcpv4.OptHostName("laptop"),
+	)
+	offer := packet(0x5e000008, laptop, dhcpv4.MessageTypeOffer, nil, true, dhcpv4.OptServerIdentifier(net.IP{192, 168, 2, 1}))
+	offer.OpCode = dhcpv4.OpcodeBootReply
+	return [][]byte{
+		frame(pxe, &net.UDPAddr{IP: net.IP{10, 20, 0, 1}, Port: dhcpv4.ServerPort}, &net.UDPAddr{IP: proxyAddr.IP, Port: dhcpv4.ServerPort}, 0, relayed),
+		frame(laptop, &net.UDPAddr{IP: net.IPv4zero, Port: dhcpv4.ClientPort}, broadcast, 0, plain),
+		frame(serverMAC, &net.UDPAddr{IP: net.IP{192, 168, 2, 1}, Port: dhcpv4.ServerPort}, &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpv4.ClientPort}, 0, offer),
+	}
+}
+
+// prl returns a parameter request list (option 55) of the option codes.
+func prl(codes ...byte) dhcpv4.Option {
+	return dhcpv4.OptGeneric(dhcpv4.OptionParameterRequestList, codes)
+}
+
+// packet returns a message with the PXE parameter request list, unless opts has its own, and opts.
+func packet(xid uint32, mac net.HardwareAddr, typ dhcpv4.MessageType, ciaddr net.IP, bcast bool, opts ...dhcpv4.Option) *dhcpv4.DHCPv4 {
+	m, err := dhcpv4.New(
+		dhcpv4.WithTransactionID(dhcpv4.TransactionID{byte(xid >> 24), byte(xid >> 16), byte(xid >> 8), byte(xid)}),
+		dhcpv4.WithHwAddr(mac),
+		dhcpv4.WithMessageType(typ),
+		dhcpv4.WithClientIP(ciaddr),
+		dhcpv4.WithOption(pxePRL),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.NumSeconds = 4
+	if bcast {
+		m.SetBroadcast()
+	} else {
+		m.SetUnicast()
+	}
+	for _, o := range opts {
+		m.UpdateOption(o)
+	}
+	return m
+}
+
+// frame returns an Ethernet, optionally 802.1Q tagged, IPv4 and UDP frame.
+func frame(srcMAC net.HardwareAddr, src, dst *net.UDPAddr, vlan uint16, m *dhcpv4.DHCPv4) []byte {
+	payload := m.ToBytes()
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp, uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	ip := make([]byte, 20)
+	ip[0], ip[8], ip[9] = 0x45, 64, 17
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+	copy(ip[12:], src.IP.To4())
+	copy(ip[16:], dst.IP.To4())
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+
+	dstMAC := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if !dst.IP.Equal(net.IPv4bcast) {
+		dstMAC = serverMAC
+	}
+	eth := append(append([]byte{}, dstMAC...), srcMAC...)
+	if vlan != 0 {
+		eth = append(eth, 0x81, 0x00, byte(vlan>>8), byte(vlan))
+	}
+	eth = append(eth, 0x08, 0x00)
+	return append(append(eth, ip...), udp...)
+}
+
+// checksum returns the IPv4 header checksum.
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// write writes the frames to a pcap, or pcapng, file in dir.
+func write(name string, ng bool, frames [][]byte) {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	if ng {
+		block := func(typ uint32, body []byte) {
+			for len(body)%4 != 0 {
+				body = append(body, 0)
+			}
+			hdr := make([]byte, 8)
+			le.PutUint32(hdr, typ)
+			le.PutUint32(hdr[4:], uint32(12+len(body)))
+			b.Write(hdr)
+			b.Write(body)
+			b.Write(hdr[4:8])
+		}
+		shb := make([]byte, 16)
+		le.PutUint32(shb, 0x1a2b3c4d)
+		le.PutUint16(shb[4:], 1)
+		le.PutUint64(shb[8:], ^uint64(0))
+		block(0x0a0d0d0a, shb)
+		idb := make([]byte, 8)
+		le.PutUint16(idb, 1)
+		le.PutUint32(idb[4:], 65535)
+		block(1, idb)
+		for i, f := range frames {
+			epb := make([]byte, 20, 20+len(f))
+			t := uint64(ts+i) * 1e6
+			le.PutUint32(epb[4:], uint32(t>>32))
+			le.PutUint32(epb[8:], uint32(t))
+			le.PutUint32(epb[12:], uint32(len(f)))
+			le.PutUint32(epb[16:], uint32(len(f)))
+			block(6, append(epb, f...))
+		}
+	} else {
+		hdr := make([]byte, 24)
+		le.PutUint32(hdr, 0xa1b2c3d4)
+		le.PutUint16(hdr[4:], 2)
+		le.PutUint16(hdr[6:], 4)
+		le.PutUint32(hdr[16:], 65535)
+		le.PutUint32(hdr[20:], 1)
+		b.Write(hdr)
+		for i, f := range frames {
+			rec := make([]byte, 16)
+			le.PutUint32(rec, uint32(ts+i))
+			le.PutUint32(rec[8:], uint32(len(f)))
+			le.PutUint32(rec[12:], uint32(len(f)))
+			b.Write(rec)
+			b.Write(f)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), b.Bytes(), 0o600); err != nil {
+		log.Fatal(err)
+	}
+}
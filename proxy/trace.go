@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans created by the Handler.
+const tracerName = "github.com/jacobweinstock/proxydhcp/proxy"
+
+// startSpan starts the span for handling a packet. It uses the global TracerProvider, which is a no-op unless one is configured.
+func (h *Handler) startSpan(name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(h.Ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// endSpan adds the attributes of the Event to the span and ends it.
+func endSpan(span trace.Span, e Event) {
+	attrs := []attribute.KeyValue{
+		attribute.String("dhcp.listener", e.Listener),
+		attribute.String("dhcp.mac", e.MAC.String()),
+		attribute.String("dhcp.xid", e.TransactionID),
+		attribute.String("dhcp.message_type", e.MessageType),
+		attribute.String("pxe.arch", e.Arch),
+		attribute.String("pxe.client_type", e.ClientType),
+		attribute.String("pxe.user_class", e.UserClass),
+		attribute.String("proxydhcp.outcome", string(e.Outcome)),
+	}
+	if e.IgnoreReason != "" {
+		attrs = append(attrs, attribute.String("proxydhcp.ignore_reason", e.IgnoreReason))
+	}
+	if e.Bootfile != "" {
+		attrs = append(attrs, attribute.String("pxe.bootfile", e.Bootfile))
+	}
+	if e.Decision.Source != "" {
+		attrs = append(attrs,
+			attribute.Bool("proxydhcp.decision.allow", e.Decision.Allow),
+			attribute.String("proxydhcp.decision.reason", e.Decision.Reason),
+			attribute.String("proxydhcp.decision.source", e.Decision.Source),
+		)
+	}
+	if e.Decision.Rule != "" {
+		attrs = append(attrs, attribute.String("proxydhcp.decision.rule", e.Decision.Rule))
+	}
+	span.SetAttributes(attrs...)
+	if e.Err != nil {
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.IgnoreReason)
+	}
+	span.End()
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"inet.af/netaddr"
+)
+
+// spanAllower records the span context it is called with.
+type spanAllower struct {
+	sc trace.SpanContext
+}
+
+func (s *spanAllower) Allow(ctx context.Context, _ net.HardwareAddr) bool {
+	s.sc = trace.SpanContextFromContext(ctx)
+	return true
+}
+
+func TestTrace(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	a := &spanAllower{}
+	h := NewHandler(
+		context.Background(),
+		netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::5"), 69),
+		netaddr.IPPortFrom(netaddr.MustParseIP("2001:db8::4"), 80),
+		&url.URL{Scheme: "http", Host: "[2001:db8::3]:8080"},
+		WithDUID(testDUID6),
+		WithAllower(a),
+	)
+	m := newSolicit6(t, withVendorClass6("PXEClient:Arch:00007:UNDI:003016"), dhcpv6.WithArchType(iana.EFI_X86_64))
+	h.Redirection6(&recordConn{}, &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: dhcpv6.DefaultClientPort}, m)
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %v spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "proxy.Redirection6" {
+		t.Fatalf("span name: got %v", s.Name())
+	}
+	if a.sc.TraceID() != s.SpanContext().TraceID() {
+		t.Fatalf("allower trace id: got %v, want %v", a.sc.TraceID(), s.SpanContext().TraceID())
+	}
+	want := map[attribute.Key]string{
+		"dhcp.mac":          testMAC6.String(),
+		"dhcp.xid":          m.TransactionID.String(),
+		"pxe.arch":          iana.EFI_X86_64.String(),
+		"proxydhcp.outcome": string(OutcomeOffer),
+		"pxe.bootfile":      "tftp://[2001:db8::5]:69/00:01:02:03:04:05/ipxe.efi",
+	}
+	got := map[attribute.Key]string{}
+	for _, kv := range s.Attributes() {
+		got[kv.Key] = kv.Value.Emit()
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("attribute %v: got %q, want %q", k, got[k], v)
+		}
+	}
+	if got["proxydhcp.decision.allow"] != "true" {
+		t.Errorf("attribute proxydhcp.decision.allow: got %q", got["proxydhcp.decision.allow"])
+	}
+}
@@ -0,0 +1,56 @@
+// Package tracing sets up OpenTelemetry tracing for proxydhcp.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// ServiceName is the service.name resource attribute of exported spans.
+const ServiceName = "proxydhcp"
+
+// Config is the configuration for exporting spans.
+type Config struct {
+	// Endpoint is the host:port of the OTLP gRPC collector. Tracing is disabled when empty.
+	Endpoint string
+	// Insecure disables TLS to the collector.
+	Insecure bool
+	// SampleRatio is the fraction of traces, that don't have a sampled parent, to record. 1 records all traces.
+	SampleRatio float64
+}
+
+// Start sets the global TracerProvider to one that exports spans via OTLP to cfg.Endpoint.
+// When cfg.Endpoint is empty the global no-op TracerProvider is left in place.
+// The returned function flushes and stops the exporter.
+func Start(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exp, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp.Shutdown, nil
+}